@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/jobs"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+// runBillCommand runs the billing job once and prints the run, or with
+// -dry-run what it would bill, as JSON. It returns the process exit code,
+// which is non-zero when the run could not be made or failed.
+func runBillCommand(billingRunService *services.BillingRunService, args []string) int {
+	flags := flag.NewFlagSet("bill", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be billed without billing anything")
+	asOfValue := flags.String("as-of", "", "date to dry-run as of, as YYYY-MM-DD or RFC 3339 (default now)")
+	timeout := flags.Duration("timeout", jobs.RunTimeout(), "how long the run may take")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	asOf := time.Now()
+	if *asOfValue != "" {
+		if !*dryRun {
+			fmt.Fprintln(os.Stderr, "-as-of is only supported with -dry-run")
+			return 2
+		}
+
+		var err error
+		asOf, err = parseAsOf(*asOfValue)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -as-of: %v\n", err)
+			return 2
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var result any
+	failed := false
+	if *dryRun {
+		preview, err := billingRunService.DryRun(ctx, asOf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Dry run failed: %v\n", err)
+			return 1
+		}
+		result = preview
+	} else {
+		run, err := billingRunService.Run(ctx)
+		if errors.Is(err, models.ErrBillingRunInProgress) {
+			fmt.Fprintln(os.Stderr, "Another billing run is in progress")
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Billing run failed: %v\n", err)
+			return 1
+		}
+		result = run
+		failed = run.Status == models.BillingRunStatusFailed
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print result: %v\n", err)
+		return 1
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// parseAsOf reads a date, taken as midnight UTC, or a full timestamp.
+func parseAsOf(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -9,9 +9,13 @@ import (
 
 	"github.com/zaher1307/subscription-service/internal/database"
 	"github.com/zaher1307/subscription-service/internal/jobs"
+	"github.com/zaher1307/subscription-service/internal/middleware"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
 	"github.com/zaher1307/subscription-service/internal/repositories"
 	router "github.com/zaher1307/subscription-service/internal/routers"
 	"github.com/zaher1307/subscription-service/internal/services"
+	"github.com/zaher1307/subscription-service/internal/tax"
 )
 
 func main() {
@@ -34,16 +38,54 @@ func main() {
 	}
 	defer db.Close()
 
-	r := router.SetupRouter(db, redis)
+	timeouts, err := middleware.LoadTimeouts()
+	if err != nil {
+		log.Fatalf("Invalid request timeout configuration: %v", err)
+	}
+
+	paymentProvider, err := payments.New(os.Getenv("PAYMENT_PROVIDER"))
+	if err != nil {
+		log.Fatalf("Invalid payment provider configuration: %v", err)
+	}
+
+	// Without a tax table no tax is added to bills.
+	var taxes *tax.Table
+	if path := os.Getenv("TAX_RATES_FILE"); path != "" {
+		taxes, err = tax.Load(path)
+		if err != nil {
+			log.Fatalf("Invalid tax rates file: %v", err)
+		}
+	}
+
+	dunningSchedule, err := models.ParseDunningSchedule(os.Getenv("DUNNING_SCHEDULE"))
+	if err != nil {
+		log.Fatalf("Invalid dunning schedule: %v", err)
+	}
 
 	billingService := services.NewBillingService(
 		repositories.NewSubscriptionRepository(db),
 		repositories.NewProductRepository(db),
 		repositories.NewBillRepository(db),
 		repositories.NewUserRepository(db),
+		repositories.NewUnitOfWork(db),
+		paymentProvider,
+		services.NewLogNotifier(),
+		dunningSchedule,
+		taxes,
 	)
+	billingRunService := services.NewBillingRunService(repositories.NewUnitOfWork(db), billingService, jobs.NewBillingLock(redis))
+
+	// "bill" runs the billing job once from the command line instead of
+	// serving the API.
+	if len(os.Args) > 1 && os.Args[1] == "bill" {
+		code := runBillCommand(billingRunService, os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
+	r := router.SetupRouter(db, redis, timeouts, paymentProvider, taxes, billingService, billingRunService, jobs.RunTimeout())
 
-	jobs.StartBillingJob(billingService, redis)
+	jobs.StartBillingJob(billingRunService)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+type AddOnHandler struct {
+	addOnService services.IAddOnService
+}
+
+func NewAddOnHandler(addOnService services.IAddOnService) *AddOnHandler {
+	return &AddOnHandler{addOnService: addOnService}
+}
+
+func (h *AddOnHandler) Add(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request struct {
+		ProductID int `json:"product_id" binding:"required"`
+		Quantity  int `json:"quantity" binding:"omitempty,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Quantity == 0 {
+		request.Quantity = 1
+	}
+
+	addOn, charge, err := h.addOnService.AddAddOn(c.Request.Context(), id, request.ProductID, request.Quantity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"add_on": addOn}
+	if charge != nil {
+		response["pending_item"] = charge
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+func (h *AddOnHandler) List(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	addOns, err := h.addOnService.ListAddOns(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, addOns)
+}
+
+func (h *AddOnHandler) Remove(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	addOnID, err := strconv.Atoi(c.Param("add_on_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid add-on ID"})
+		return
+	}
+
+	credit, err := h.addOnService.RemoveAddOn(c.Request.Context(), id, addOnID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if credit == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pending_item": credit})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+type BalanceHandler struct {
+	balanceService services.IBalanceService
+}
+
+func NewBalanceHandler(balanceService services.IBalanceService) *BalanceHandler {
+	return &BalanceHandler{balanceService: balanceService}
+}
+
+func (h *BalanceHandler) Get(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	balances, entries, err := h.balanceService.GetBalance(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"balances": balances,
+		"entries":  entries,
+	})
+}
+
+func (h *BalanceHandler) AddCredit(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		Amount models.Money `json:"amount"`
+		Reason string       `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.balanceService.AddCredit(c.Request.Context(), userID, request.Amount, request.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
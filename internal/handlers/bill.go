@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
 	"github.com/zaher1307/subscription-service/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -24,7 +28,7 @@ func (h *BillHandler) GetUserBills(c *gin.Context) {
 		return
 	}
 
-	bills, err := h.billingService.GetUserBills(userID)
+	bills, err := h.billingService.GetUserBills(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -40,7 +44,7 @@ func (h *BillHandler) GetBill(c *gin.Context) {
 		return
 	}
 
-	bill, err := h.billingService.GetBill(id)
+	bill, err := h.billingService.GetBill(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Bill not found"})
 		return
@@ -56,10 +60,59 @@ func (h *BillHandler) PayBill(c *gin.Context) {
 		return
 	}
 
-	if err := h.billingService.PayBill(id); err != nil {
+	var request struct {
+		PaymentMethodID int `json:"payment_method_id"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.billingService.PayBill(c.Request.Context(), id, request.PaymentMethodID); err != nil {
+		var paymentErr *payments.Error
+		if errors.As(err, &paymentErr) {
+			c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error(), "failure_code": paymentErr.Code})
+			return
+		}
+		if errors.Is(err, models.ErrBillNotPending) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Bill paid successfully"})
 }
+
+func (h *BillHandler) Refund(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request struct {
+		Amount int64  `json:"amount"`
+		Reason string `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note, err := h.billingService.RefundBill(c.Request.Context(), id, request.Amount, request.Reason)
+	if err != nil {
+		var paymentErr *payments.Error
+		if errors.As(err, &paymentErr) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "failure_code": paymentErr.Code})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, note)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+type BillingRunHandler struct {
+	billingRunService services.IBillingRunService
+	runTimeout        time.Duration
+}
+
+// NewBillingRunHandler returns the handler for billing runs. Runs it
+// starts may take up to runTimeout.
+func NewBillingRunHandler(billingRunService services.IBillingRunService, runTimeout time.Duration) *BillingRunHandler {
+	return &BillingRunHandler{billingRunService: billingRunService, runTimeout: runTimeout}
+}
+
+// Trigger starts the billing job now and returns the run without waiting
+// for it to finish. With dry_run it reports what the run would bill as of
+// as_of, which defaults to now, instead.
+func (h *BillingRunHandler) Trigger(c *gin.Context) {
+	var request struct {
+		DryRun bool       `json:"dry_run"`
+		AsOf   *time.Time `json:"as_of"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.DryRun {
+		asOf := time.Now()
+		if request.AsOf != nil {
+			asOf = *request.AsOf
+		}
+
+		preview, err := h.billingRunService.DryRun(c.Request.Context(), asOf)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, preview)
+		return
+	}
+
+	if request.AsOf != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "as_of is only supported for dry runs"})
+		return
+	}
+
+	// The run carries on in the background, for as long as a scheduled run
+	// may take, and is followed through GetByID.
+	run, err := h.billingRunService.Start(c.Request.Context(), h.runTimeout)
+	if err != nil {
+		if errors.Is(err, models.ErrBillingRunInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
+
+func (h *BillingRunHandler) List(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	runs, err := h.billingRunService.ListRuns(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+func (h *BillingRunHandler) GetByID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	run, err := h.billingRunService.GetRun(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Billing run not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+type CouponHandler struct {
+	couponService services.ICouponService
+}
+
+func NewCouponHandler(couponService services.ICouponService) *CouponHandler {
+	return &CouponHandler{couponService: couponService}
+}
+
+func (h *CouponHandler) Create(c *gin.Context) {
+	var coupon models.Coupon
+
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.couponService.CreateCoupon(c.Request.Context(), &coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+func (h *CouponHandler) GetByCode(c *gin.Context) {
+	coupon, err := h.couponService.GetCoupon(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
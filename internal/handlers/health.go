@@ -25,18 +25,18 @@ func (h *HealthHandler) Check(c *gin.Context) {
 	dbStatus := "ok"
 	redisStatus := "ok"
 
-	if err := h.DB.Ping(); err != nil {
-		dbStatus = "error"
-		status = "degraded"
-	}
-
 	connTimeout, _ := time.ParseDuration(os.Getenv("REDIS_CONN_TIMEOUT"))
 	if connTimeout == 0 {
 		connTimeout = 5 * time.Second
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), connTimeout)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), connTimeout)
 	defer cancel()
 
+	if err := h.DB.PingContext(ctx); err != nil {
+		dbStatus = "error"
+		status = "degraded"
+	}
+
 	if _, err := h.Redis.Ping(ctx).Result(); err != nil {
 		redisStatus = "error"
 		status = "degraded"
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+type PaymentMethodHandler struct {
+	paymentMethodService services.IPaymentMethodService
+}
+
+func NewPaymentMethodHandler(paymentMethodService services.IPaymentMethodService) *PaymentMethodHandler {
+	return &PaymentMethodHandler{paymentMethodService: paymentMethodService}
+}
+
+func (h *PaymentMethodHandler) Add(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var request struct {
+		payments.PaymentMethodDetails
+		Default bool `json:"default"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	method, err := h.paymentMethodService.AddPaymentMethod(c.Request.Context(), userID, request.PaymentMethodDetails, request.Default)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, method)
+}
+
+func (h *PaymentMethodHandler) List(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	methods, err := h.paymentMethodService.ListPaymentMethods(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, methods)
+}
+
+func (h *PaymentMethodHandler) SetDefault(c *gin.Context) {
+	userID, methodID, ok := paymentMethodParams(c)
+	if !ok {
+		return
+	}
+
+	method, err := h.paymentMethodService.SetDefaultPaymentMethod(c.Request.Context(), userID, methodID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment method not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+func (h *PaymentMethodHandler) Remove(c *gin.Context) {
+	userID, methodID, ok := paymentMethodParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.paymentMethodService.RemovePaymentMethod(c.Request.Context(), userID, methodID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment method not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func paymentMethodParams(c *gin.Context) (int, int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, 0, false
+	}
+
+	methodID, err := strconv.Atoi(c.Param("method_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment method ID"})
+		return 0, 0, false
+	}
+
+	return userID, methodID, true
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/zaher1307/subscription-service/internal/models"
 	"github.com/zaher1307/subscription-service/internal/services"
 )
 
@@ -18,7 +20,7 @@ func NewProductHandler(productService services.IProductService) *ProductHandler
 }
 
 func (h *ProductHandler) GetAll(c *gin.Context) {
-	products, err := h.productService.GetAllProducts()
+	products, err := h.productService.GetAllProducts(c.Request.Context(), c.Query("currency"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -34,7 +36,7 @@ func (h *ProductHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	product, err := h.productService.GetProductByID(id)
+	product, err := h.productService.GetProductByID(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
@@ -42,3 +44,29 @@ func (h *ProductHandler) GetByID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, product)
 }
+
+func (h *ProductHandler) GetPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	quantity, err := strconv.ParseInt(c.DefaultQuery("quantity", "1"), 10, 64)
+	if err != nil || quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity"})
+		return
+	}
+
+	quote, err := h.productService.QuotePrice(c.Request.Context(), id, c.Query("currency"), quantity)
+	if err != nil {
+		if errors.Is(err, models.ErrPriceUnavailable) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/zaher1307/subscription-service/internal/models"
 	"github.com/zaher1307/subscription-service/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -19,8 +23,12 @@ func NewSubscriptionHandler(subscriptionService services.ISubscriptionService) *
 
 func (h *SubscriptionHandler) Create(c *gin.Context) {
 	var request struct {
-		UserID    int `json:"user_id" binding:"required"`
-		ProductID int `json:"product_id" binding:"required"`
+		UserID      int    `json:"user_id" binding:"required"`
+		ProductID   int    `json:"product_id" binding:"required"`
+		AutoCollect bool   `json:"auto_collect"`
+		CouponCode  string `json:"coupon_code"`
+		Currency    string `json:"currency" binding:"omitempty,len=3"`
+		Quantity    int    `json:"quantity" binding:"omitempty,min=1"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -28,8 +36,23 @@ func (h *SubscriptionHandler) Create(c *gin.Context) {
 		return
 	}
 
-	subscription, bill, err := h.subscriptionService.CreateSubscription(request.UserID, request.ProductID)
+	subscription, bill, err := h.subscriptionService.CreateSubscription(c.Request.Context(), services.CreateSubscriptionParams{
+		UserID:      request.UserID,
+		ProductID:   request.ProductID,
+		AutoCollect: request.AutoCollect,
+		CouponCode:  request.CouponCode,
+		Currency:    request.Currency,
+		Quantity:    request.Quantity,
+	})
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidCoupon) || errors.Is(err, models.ErrPriceUnavailable) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, models.ErrSubscriptionExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -47,7 +70,7 @@ func (h *SubscriptionHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	subscription, err := h.subscriptionService.GetSubscription(id)
+	subscription, err := h.subscriptionService.GetSubscription(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
 		return
@@ -55,3 +78,149 @@ func (h *SubscriptionHandler) GetByID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, subscription)
 }
+
+func (h *SubscriptionHandler) Cancel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request struct {
+		Mode    services.CancellationMode `json:"mode"`
+		Reason  string                    `json:"reason"`
+		Prorate bool                      `json:"prorate"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Mode == "" {
+		request.Mode = services.CancelAtPeriodEnd
+	}
+
+	subscription, final, err := h.subscriptionService.CancelSubscription(c.Request.Context(), id, request.Mode, request.Reason, request.Prorate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"subscription": subscription}
+	if final != nil {
+		if final.Status == models.BillStatusCredit {
+			response["credit_bill"] = final
+		} else {
+			response["final_bill"] = final
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *SubscriptionHandler) Pause(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request struct {
+		ResumeAt *time.Time `json:"resume_at"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, err := h.subscriptionService.PauseSubscription(c.Request.Context(), id, request.ResumeAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+func (h *SubscriptionHandler) Resume(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	subscription, err := h.subscriptionService.ResumeSubscription(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+func (h *SubscriptionHandler) ChangePlan(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request struct {
+		ProductID int                     `json:"product_id" binding:"required"`
+		Mode      services.PlanChangeMode `json:"mode"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Mode == "" {
+		request.Mode = services.PlanChangeImmediately
+	}
+
+	subscription, adjustment, err := h.subscriptionService.ChangePlan(c.Request.Context(), id, request.ProductID, request.Mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"subscription": subscription}
+	if adjustment != nil {
+		response["adjustment_bill"] = adjustment
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *SubscriptionHandler) ChangeQuantity(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request struct {
+		Quantity int `json:"quantity" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, adjustment, err := h.subscriptionService.ChangeQuantity(c.Request.Context(), id, request.Quantity)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"subscription": subscription}
+	if adjustment != nil {
+		response["pending_item"] = adjustment
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+type UsageHandler struct {
+	usageService services.IUsageService
+}
+
+func NewUsageHandler(usageService services.IUsageService) *UsageHandler {
+	return &UsageHandler{usageService: usageService}
+}
+
+func (h *UsageHandler) Record(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request struct {
+		IdempotencyKey string    `json:"idempotency_key" binding:"required"`
+		Quantity       int64     `json:"quantity" binding:"min=0"`
+		Timestamp      time.Time `json:"timestamp"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record, created, err := h.usageService.RecordUsage(c.Request.Context(), &models.UsageRecord{
+		SubscriptionID: id,
+		IdempotencyKey: request.IdempotencyKey,
+		Quantity:       request.Quantity,
+		Timestamp:      request.Timestamp,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrUsageKeyReused) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, record)
+		return
+	}
+	c.JSON(http.StatusCreated, record)
+}
+
+func (h *UsageHandler) Get(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	summary, err := h.usageService.GetUsage(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
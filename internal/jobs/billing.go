@@ -2,54 +2,51 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"log"
+	"os"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/robfig/cron/v3"
+
+	"github.com/zaher1307/subscription-service/internal/models"
 	"github.com/zaher1307/subscription-service/internal/services"
 )
 
-func StartBillingJob(billingService *services.BillingService, redis *redis.Client) {
+// defaultRunTimeout bounds a billing run unless BILLING_JOB_TIMEOUT says
+// otherwise.
+const defaultRunTimeout = 10 * time.Minute
+
+// RunTimeout returns how long a billing run may take, from
+// BILLING_JOB_TIMEOUT. Runs started by hand get as long as scheduled ones.
+func RunTimeout() time.Duration {
+	runTimeout, _ := time.ParseDuration(os.Getenv("BILLING_JOB_TIMEOUT"))
+	if runTimeout <= 0 {
+		return defaultRunTimeout
+	}
+	return runTimeout
+}
+
+func StartBillingJob(billingRunService *services.BillingRunService) {
 	c := cron.New(cron.WithLocation(time.UTC))
 
-    _, err := c.AddFunc("0 0 * * *", func() {
-		log.Println("Attempting to run billing job...")
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	runTimeout := RunTimeout()
+
+	_, err := c.AddFunc("0 0 * * *", func() {
+		log.Println("Running billing job...")
+		ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
 		defer cancel()
-		lockKey := "billing_job_lock"
-		lockTTL := 10 * time.Minute
-
-		maxRetries := 3
-		retryDelay := 1 * time.Second
-		var acquired bool
-		var err error
-
-		for i := range maxRetries {
-			acquired, err = redis.SetNX(ctx, lockKey, "locked", lockTTL).Result()
-			if err == nil && acquired {
-				break
-			}
-			log.Printf("Lock acquisition attempt %d failed: %v", i+1, err)
-			time.Sleep(retryDelay)
-			retryDelay *= 2
-		}
 
-		if !acquired {
-			log.Println("Failed to acquire lock after retries")
+		run, err := billingRunService.Run(ctx)
+		if errors.Is(err, models.ErrBillingRunInProgress) {
+			log.Println("Billing job skipped: another run holds the lock")
 			return
 		}
-
-		defer func() {
-			if _, err := redis.Del(ctx, lockKey).Result(); err != nil {
-				log.Printf("Failed to release lock: %v", err)
-			}
-		}()
-
-		log.Println("Lock acquired. Running billing job...")
-		if err := billingService.GenerateBills(); err != nil {
-			log.Printf("Error generating bills: %v", err)
+		if err != nil {
+			log.Printf("Billing job failed: %v", err)
+			return
 		}
+		log.Printf("Billing run %d %s", run.ID, run.Status)
 	})
 	if err != nil {
 		log.Fatalf("Failed to schedule billing job: %v", err)
@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+const (
+	billingLockKey = "billing_job_lock"
+	billingLockTTL = 10 * time.Minute
+	// billingLockRefresh is how often a held lock is extended, well within
+	// its TTL so that a few failed refreshes do not lose it.
+	billingLockRefresh = billingLockTTL / 5
+)
+
+// refreshScript extends the lock while it is still held by the caller.
+var refreshScript = redis.NewScript(`
+	if redis.call("get", KEYS[1]) == ARGV[1] then
+		return redis.call("pexpire", KEYS[1], ARGV[2])
+	end
+	return 0
+`)
+
+// releaseScript deletes the lock only while it is still held by the
+// caller, so that an instance whose lock expired cannot release the lock
+// of the run that took over.
+var releaseScript = redis.NewScript(`
+	if redis.call("get", KEYS[1]) == ARGV[1] then
+		return redis.call("del", KEYS[1])
+	end
+	return 0
+`)
+
+// RedisBillingLock is the billing lock kept in Redis. Its holder extends it
+// for as long as it holds it, and it expires billingLockTTL later in case
+// its holder dies while holding it.
+type RedisBillingLock struct {
+	redis  *redis.Client
+	holder string
+
+	mu   sync.Mutex
+	stop context.CancelCauseFunc
+}
+
+var _ services.BillingLock = (*RedisBillingLock)(nil)
+
+// NewBillingLock returns the billing lock, held in the name of this
+// instance of the service.
+func NewBillingLock(redis *redis.Client) *RedisBillingLock {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &RedisBillingLock{
+		redis:  redis,
+		holder: fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+	}
+}
+
+// Acquire takes the lock unless someone else holds it and keeps it until
+// Release. Failures to reach Redis are retried a few times.
+func (l *RedisBillingLock) Acquire(ctx context.Context) (context.Context, bool, error) {
+	maxRetries := 3
+	retryDelay := 1 * time.Second
+	var acquired bool
+	var err error
+
+	for i := range maxRetries {
+		acquired, err = l.redis.SetNX(ctx, billingLockKey, l.holder, billingLockTTL).Result()
+		if err == nil {
+			break
+		}
+		log.Printf("Lock acquisition attempt %d failed: %v", i+1, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx, false, ctx.Err()
+		case <-time.After(retryDelay):
+		}
+		retryDelay *= 2
+	}
+	if err != nil || !acquired {
+		return ctx, false, err
+	}
+
+	held, stop := context.WithCancelCause(ctx)
+	l.mu.Lock()
+	l.stop = stop
+	l.mu.Unlock()
+
+	go l.keep(held, stop)
+
+	return held, true, nil
+}
+
+// keep extends the lock until it is released. If the lock cannot be
+// extended before it would run out, or someone else holds it by then, held
+// is cancelled with models.ErrBillingLockLost.
+func (l *RedisBillingLock) keep(held context.Context, stop context.CancelCauseFunc) {
+	ticker := time.NewTicker(billingLockRefresh)
+	defer ticker.Stop()
+
+	keptAt := time.Now()
+	for {
+		select {
+		case <-held.Done():
+			return
+		case <-ticker.C:
+		}
+
+		kept, err := refreshScript.Run(held, l.redis, []string{billingLockKey}, l.holder, billingLockTTL.Milliseconds()).Int()
+		switch {
+		case err != nil && time.Since(keptAt) < billingLockTTL-billingLockRefresh:
+			log.Printf("Failed to refresh billing lock: %v", err)
+			continue
+		case err != nil || kept == 0:
+			stop(models.ErrBillingLockLost)
+			return
+		}
+		keptAt = time.Now()
+	}
+}
+
+func (l *RedisBillingLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	if l.stop != nil {
+		l.stop(nil)
+		l.stop = nil
+	}
+	l.mu.Unlock()
+
+	return releaseScript.Run(ctx, l.redis, []string{billingLockKey}, l.holder).Err()
+}
+
+func (l *RedisBillingLock) Holder() string {
+	return l.holder
+}
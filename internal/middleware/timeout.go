@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultRequestTimeout = 10 * time.Second
+
+// Timeouts holds the request deadline applied to every endpoint, with
+// optional overrides keyed by "METHOD /route/path" as registered in gin,
+// e.g. "POST /api/bills/:id/pay".
+type Timeouts struct {
+	Default   time.Duration
+	Endpoints map[string]time.Duration
+}
+
+// LoadTimeouts reads REQUEST_TIMEOUT and ENDPOINT_TIMEOUTS from the
+// environment. ENDPOINT_TIMEOUTS is a comma separated list of
+// "METHOD /route/path=duration" pairs.
+func LoadTimeouts() (Timeouts, error) {
+	timeouts := Timeouts{
+		Default:   defaultRequestTimeout,
+		Endpoints: make(map[string]time.Duration),
+	}
+
+	if value := os.Getenv("REQUEST_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return Timeouts{}, fmt.Errorf("invalid REQUEST_TIMEOUT: %v", err)
+		}
+		timeouts.Default = d
+	}
+
+	for _, pair := range strings.Split(os.Getenv("ENDPOINT_TIMEOUTS"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		endpoint, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return Timeouts{}, fmt.Errorf("invalid ENDPOINT_TIMEOUTS entry %q", pair)
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return Timeouts{}, fmt.Errorf("invalid ENDPOINT_TIMEOUTS entry %q: %v", pair, err)
+		}
+		timeouts.Endpoints[strings.Join(strings.Fields(endpoint), " ")] = d
+	}
+
+	return timeouts, nil
+}
+
+func (t Timeouts) For(method, path string) time.Duration {
+	if d, ok := t.Endpoints[method+" "+path]; ok {
+		return d
+	}
+	return t.Default
+}
+
+// Timeout derives a deadline-bound context from the request context so
+// that database work started by the handler is cancelled when the client
+// disconnects or the endpoint's deadline passes.
+func Timeout(timeouts Timeouts) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := timeouts.For(c.Request.Method, c.FullPath())
+		if d <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
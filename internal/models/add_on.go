@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SubscriptionAddOn is an add-on product attached to a subscription, such
+// as an extra bag of beans on a coffee plan. It is billed with the
+// subscription on the same cycle.
+type SubscriptionAddOn struct {
+	ID             int       `json:"id"`
+	SubscriptionID int       `json:"subscription_id"`
+	ProductID      int       `json:"product_id"`
+	Quantity       int       `json:"quantity"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Address is a postal address. Country is an ISO 3166-1 alpha-2 code and
+// Region the state or province where one applies, e.g. "US" and "NY".
+type Address struct {
+	Line1      string `json:"line1,omitempty"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country" binding:"required,len=2"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// BalanceEntry is one movement on a user's account balance. Positive
+// amounts are credit owed to the user; negative amounts are credit used up,
+// e.g. applied to a bill.
+type BalanceEntry struct {
+	ID             int       `json:"id"`
+	UserID         int       `json:"user_id"`
+	Amount         Money     `json:"amount"`
+	Reason         string    `json:"reason"`
+	BillID         *int      `json:"bill_id,omitempty"`
+	SubscriptionID *int      `json:"subscription_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
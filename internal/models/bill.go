@@ -1,12 +1,114 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
+// ErrPeriodAlreadyBilled is returned when a subscription already has a bill
+// for the billing period.
+var ErrPeriodAlreadyBilled = errors.New("subscription already billed for this period")
+
+// ErrBillNotPending is returned when a bill was paid, written off or
+// otherwise settled while it was being paid.
+var ErrBillNotPending = errors.New("bill is no longer pending")
+
+const (
+	BillStatusPending = "pending"
+	BillStatusPaid    = "paid"
+	// BillStatusCredit marks a bill with a negative amount owed back to
+	// the customer, e.g. the unused part of a cancelled period.
+	BillStatusCredit = "credit"
+	// BillStatusUncollectible marks a bill that dunning gave up on.
+	BillStatusUncollectible = "uncollectible"
+	// BillStatusPartiallyRefunded and BillStatusRefunded mark paid bills
+	// that have had part or all of their amount given back.
+	BillStatusPartiallyRefunded = "partially_refunded"
+	BillStatusRefunded          = "refunded"
+)
+
+const (
+	// BillTypeSubscription covers a full billing period; paying it starts
+	// the subscription's next period.
+	BillTypeSubscription = "subscription"
+	// BillTypeAdjustment settles a mid-period change such as a plan change
+	// or a cancellation and leaves the billing period untouched.
+	BillTypeAdjustment = "adjustment"
+)
+
+// Bill is a request for payment made up of line items. Amount is the sum of
+// the items, Discount the part of it taken off by discount items and Tax
+// the tax it includes. Inclusive tax items count towards Tax but not
+// Amount, since the other items already contain them. PeriodStart is the
+// start of the billing period a subscription bill covers; a subscription has
+// at most one bill per period.
 type Bill struct {
 	ID             int        `json:"id"`
 	SubscriptionID int        `json:"subscription_id"`
-	Amount         float64    `json:"amount"`
+	Type           string     `json:"type"`
+	Amount         Money      `json:"amount"`
+	Discount       Money      `json:"discount"`
+	CouponID       *int       `json:"coupon_id,omitempty"`
+	Tax            Money      `json:"tax"`
+	CreditApplied  Money      `json:"credit_applied"`
+	AmountRefunded Money      `json:"amount_refunded"`
 	Status         string     `json:"status"`
+	PeriodStart    *time.Time `json:"period_start,omitempty"`
 	CreatedAt      time.Time  `json:"created_at"`
 	PaidAt         *time.Time `json:"paid_at,omitempty"`
+
+	Items           []*BillItem       `json:"items,omitempty"`
+	PaymentAttempts []*PaymentAttempt `json:"payment_attempts,omitempty"`
+	DunningAttempts []*DunningAttempt `json:"dunning_attempts,omitempty"`
+	CreditNotes     []*CreditNote     `json:"credit_notes,omitempty"`
+}
+
+// IsPaid reports whether the bill has been paid, whether or not it has been
+// refunded since.
+func (b *Bill) IsPaid() bool {
+	switch b.Status {
+	case BillStatusPaid, BillStatusPartiallyRefunded, BillStatusRefunded:
+		return true
+	default:
+		return false
+	}
+}
+
+// AmountDue is what is left to pay once account credit has been applied.
+// Credit is always applied in the bill's own currency.
+func (b *Bill) AmountDue() Money {
+	return NewMoney(b.Amount.Amount-b.CreditApplied.Amount, b.Amount.Currency)
+}
+
+// AddItem adds a line to the bill and updates the bill's amount and
+// discount to match. All items of a bill share its currency.
+func (b *Bill) AddItem(item *BillItem) error {
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+	item.UnitAmount = NewMoney(item.UnitAmount.Amount, item.UnitAmount.Currency)
+	item.Amount = item.UnitAmount.MulInt(int64(item.Quantity))
+
+	if len(b.Items) == 0 {
+		b.Amount = NewMoney(0, item.Amount.Currency)
+		b.Discount = NewMoney(0, item.Amount.Currency)
+		b.Tax = NewMoney(0, item.Amount.Currency)
+	}
+
+	amount, err := b.Amount.Add(item.Amount)
+	if err != nil {
+		return err
+	}
+	if !item.Inclusive {
+		b.Amount = amount
+	}
+	switch item.Kind {
+	case BillItemKindDiscount:
+		b.Discount.Amount -= item.Amount.Amount
+	case BillItemKindTax:
+		b.Tax.Amount += item.Amount.Amount
+	}
+	b.Items = append(b.Items, item)
+
+	return nil
 }
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+const (
+	// BillItemKindSubscription charges for a billing period of a product.
+	BillItemKindSubscription = "subscription"
+	// BillItemKindAddOn charges for a billing period of an add-on attached
+	// to the subscription.
+	BillItemKindAddOn = "add_on"
+	// BillItemKindUsage charges for a metered product's usage over a
+	// period.
+	BillItemKindUsage = "usage"
+	// BillItemKindProration charges or credits part of a period after a
+	// mid-period change such as a plan change or a cancellation.
+	BillItemKindProration = "proration"
+	// BillItemKindDiscount takes a coupon discount off the bill.
+	BillItemKindDiscount = "discount"
+	// BillItemKindTax is the tax due on the rest of the bill.
+	BillItemKindTax = "tax"
+)
+
+// BillItem is one line of a bill. Its amount is quantity × unit amount and
+// is negative for credits and discounts. Inclusive tax items show the tax
+// already contained in the other items' prices. ProductID is the product the
+// line is for, if any, and decides the rate it is taxed at.
+type BillItem struct {
+	ID          int        `json:"id"`
+	BillID      int        `json:"bill_id"`
+	Kind        string     `json:"kind"`
+	Description string     `json:"description"`
+	Quantity    int        `json:"quantity"`
+	UnitAmount  Money      `json:"unit_amount"`
+	Amount      Money      `json:"amount"`
+	PeriodStart *time.Time `json:"period_start,omitempty"`
+	PeriodEnd   *time.Time `json:"period_end,omitempty"`
+	Inclusive   bool       `json:"inclusive,omitempty"`
+	ProductID   *int       `json:"product_id,omitempty"`
+}
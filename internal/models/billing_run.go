@@ -0,0 +1,67 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrBillingRunInProgress is returned when another billing run holds the
+// billing lock.
+var ErrBillingRunInProgress = errors.New("a billing run is already in progress")
+
+// ErrBillingLockLost stops a billing run that lost the billing lock, so that
+// it cannot overlap with a run that took the lock over.
+var ErrBillingLockLost = errors.New("billing lock lost")
+
+const (
+	BillingRunStatusRunning   = "running"
+	BillingRunStatusCompleted = "completed"
+	BillingRunStatusFailed    = "failed"
+)
+
+// BillingRunFailure records why a billing run could not bill a
+// subscription.
+type BillingRunFailure struct {
+	SubscriptionID int    `json:"subscription_id"`
+	Reason         string `json:"reason"`
+}
+
+// BillingRunReport sums up a run of the billing job. Every subscription is
+// billed on its own, so the ones that failed were left as they were for the
+// next run to pick up.
+type BillingRunReport struct {
+	SubscriptionsScanned int `json:"subscriptions_scanned"`
+	BillsCreated         int `json:"bills_created"`
+	// AlreadyBilled counts subscriptions that another run billed for the
+	// same period first.
+	AlreadyBilled int                 `json:"already_billed"`
+	Failures      []BillingRunFailure `json:"failures"`
+}
+
+// AddFailure records that the subscription could not be billed.
+func (r *BillingRunReport) AddFailure(subscriptionID int, err error) {
+	r.Failures = append(r.Failures, BillingRunFailure{SubscriptionID: subscriptionID, Reason: err.Error()})
+}
+
+// BillingRun is the recorded history of one run of the billing job.
+// LockHolder names the instance that held the billing lock. A run that is
+// still running without a FinishedAt long after it started was cut short,
+// for instance by the process being stopped. Error is set when the run
+// stopped before it reached every subscription.
+type BillingRun struct {
+	ID         int        `json:"id"`
+	Status     string     `json:"status"`
+	LockHolder string     `json:"lock_holder"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	BillingRunReport
+}
+
+// BillingPreview is what a billing run would do as of AsOf: the report it
+// would give and the bills it would create.
+type BillingPreview struct {
+	AsOf time.Time `json:"as_of"`
+	BillingRunReport
+	Bills []*Bill `json:"bills"`
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	CouponDiscountPercent = "percent"
+	CouponDiscountFixed   = "fixed"
+)
+
+const (
+	// CouponDurationOnce discounts the first bill only.
+	CouponDurationOnce = "once"
+	// CouponDurationRepeating discounts the first DurationCycles bills.
+	CouponDurationRepeating = "repeating"
+	// CouponDurationForever discounts every bill of the subscription.
+	CouponDurationForever = "forever"
+)
+
+// ErrInvalidCoupon is returned when a coupon cannot be redeemed, e.g.
+// because it has expired or does not cover the product.
+var ErrInvalidCoupon = errors.New("invalid coupon")
+
+type Coupon struct {
+	ID             int        `json:"id"`
+	Code           string     `json:"code"`
+	DiscountType   string     `json:"discount_type"`
+	PercentOff     int        `json:"percent_off,omitempty"`
+	AmountOff      *Money     `json:"amount_off,omitempty"`
+	Duration       string     `json:"duration"`
+	DurationCycles int        `json:"duration_cycles,omitempty"`
+	MaxRedemptions *int       `json:"max_redemptions,omitempty"`
+	TimesRedeemed  int        `json:"times_redeemed"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	// ProductIDs restricts the coupon to these products; empty means any.
+	ProductIDs []int     `json:"product_ids,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Validate checks that the coupon is well formed before it is saved.
+func (c *Coupon) Validate() error {
+	if c.Code == "" {
+		return errors.New("coupon code is required")
+	}
+
+	switch c.DiscountType {
+	case CouponDiscountPercent:
+		if c.PercentOff < 1 || c.PercentOff > 100 {
+			return errors.New("percent_off must be between 1 and 100")
+		}
+		if c.AmountOff != nil {
+			return errors.New("amount_off is only allowed on fixed coupons")
+		}
+	case CouponDiscountFixed:
+		if c.AmountOff == nil || c.AmountOff.Amount <= 0 || c.AmountOff.Currency == "" {
+			return errors.New("fixed coupons need a positive amount_off with a currency")
+		}
+		if c.PercentOff != 0 {
+			return errors.New("percent_off is only allowed on percent coupons")
+		}
+	default:
+		return fmt.Errorf("unknown discount type %q", c.DiscountType)
+	}
+
+	switch c.Duration {
+	case CouponDurationOnce, CouponDurationForever:
+		if c.DurationCycles != 0 {
+			return fmt.Errorf("duration_cycles is only allowed on %s coupons", CouponDurationRepeating)
+		}
+	case CouponDurationRepeating:
+		if c.DurationCycles < 1 {
+			return errors.New("duration_cycles must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown coupon duration %q", c.Duration)
+	}
+
+	if c.MaxRedemptions != nil && *c.MaxRedemptions < 1 {
+		return errors.New("max_redemptions must be positive")
+	}
+
+	return nil
+}
+
+// Cycles returns how many bills the coupon discounts, or nil if it
+// discounts every bill.
+func (c *Coupon) Cycles() *int {
+	var cycles int
+	switch c.Duration {
+	case CouponDurationOnce:
+		cycles = 1
+	case CouponDurationRepeating:
+		cycles = c.DurationCycles
+	default:
+		return nil
+	}
+	return &cycles
+}
+
+// AppliesTo reports whether the coupon covers the product.
+func (c *Coupon) AppliesTo(productID int) bool {
+	return len(c.ProductIDs) == 0 || slices.Contains(c.ProductIDs, productID)
+}
+
+// CheckRedeemable reports why the coupon cannot be redeemed for the product
+// at the given price and time, if it cannot.
+func (c *Coupon) CheckRedeemable(productID int, price Money, now time.Time) error {
+	if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+		return fmt.Errorf("%w: coupon %s has expired", ErrInvalidCoupon, c.Code)
+	}
+	if c.MaxRedemptions != nil && c.TimesRedeemed >= *c.MaxRedemptions {
+		return fmt.Errorf("%w: coupon %s has reached its redemption limit", ErrInvalidCoupon, c.Code)
+	}
+	if !c.AppliesTo(productID) {
+		return fmt.Errorf("%w: coupon %s does not apply to product %d", ErrInvalidCoupon, c.Code, productID)
+	}
+	if c.AmountOff != nil && c.AmountOff.Currency != price.Currency {
+		return fmt.Errorf("%w: coupon %s is in %s, not %s", ErrInvalidCoupon, c.Code, c.AmountOff.Currency, price.Currency)
+	}
+	return nil
+}
+
+// Discount returns how much the coupon takes off amount. It never exceeds
+// amount, so a discounted bill cannot go negative.
+func (c *Coupon) Discount(amount Money) (Money, error) {
+	if amount.Amount <= 0 {
+		return NewMoney(0, amount.Currency), nil
+	}
+
+	var discount Money
+	switch c.DiscountType {
+	case CouponDiscountPercent:
+		discount = amount.MulRat(int64(c.PercentOff), 100)
+	case CouponDiscountFixed:
+		if err := amount.checkCurrency(*c.AmountOff); err != nil {
+			return Money{}, err
+		}
+		discount = *c.AmountOff
+	default:
+		return Money{}, fmt.Errorf("unknown discount type %q", c.DiscountType)
+	}
+
+	if discount.Amount > amount.Amount {
+		discount.Amount = amount.Amount
+	}
+	return discount, nil
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// CreditNote records money given back against a paid bill. Its amount is
+// positive, in the bill's currency.
+type CreditNote struct {
+	ID                int       `json:"id"`
+	BillID            int       `json:"bill_id"`
+	Amount            Money     `json:"amount"`
+	Reason            string    `json:"reason,omitempty"`
+	ProviderReference string    `json:"provider_reference,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DunningActionRemind sends the customer a payment reminder and moves
+	// the subscription to past_due.
+	DunningActionRemind = "remind"
+	// DunningActionCancel gives up on the bill and cancels the subscription.
+	DunningActionCancel = "cancel"
+	// DunningActionMarkUnpaid gives up on collecting the bill but keeps the
+	// subscription around as unpaid until the customer pays.
+	DunningActionMarkUnpaid = "mark_unpaid"
+)
+
+type DunningStep struct {
+	AfterDays int    `json:"after_days"`
+	Action    string `json:"action"`
+}
+
+// DunningSchedule lists what to do about an unpaid bill and when, counted
+// in days from the bill's creation. It is written as comma separated
+// "days:action" pairs, e.g. "1:remind,3:remind,7:remind,14:cancel".
+type DunningSchedule []DunningStep
+
+var DefaultDunningSchedule = DunningSchedule{
+	{AfterDays: 1, Action: DunningActionRemind},
+	{AfterDays: 3, Action: DunningActionRemind},
+	{AfterDays: 7, Action: DunningActionRemind},
+	{AfterDays: 14, Action: DunningActionCancel},
+}
+
+func ParseDunningSchedule(value string) (DunningSchedule, error) {
+	schedule := make(DunningSchedule, 0)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		days, action, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid dunning step %q, expected days:action", pair)
+		}
+
+		afterDays, err := strconv.Atoi(strings.TrimSpace(days))
+		if err != nil || afterDays < 0 {
+			return nil, fmt.Errorf("invalid dunning step %q: days must be a non-negative integer", pair)
+		}
+
+		step := DunningStep{AfterDays: afterDays, Action: strings.TrimSpace(action)}
+		switch step.Action {
+		case DunningActionRemind, DunningActionCancel, DunningActionMarkUnpaid:
+		default:
+			return nil, fmt.Errorf("invalid dunning step %q: unknown action %q", pair, step.Action)
+		}
+
+		if n := len(schedule); n > 0 {
+			if schedule[n-1].Action != DunningActionRemind {
+				return nil, fmt.Errorf("invalid dunning step %q: no step may follow %q", pair, schedule[n-1].Action)
+			}
+			if afterDays <= schedule[n-1].AfterDays {
+				return nil, fmt.Errorf("invalid dunning step %q: days must be increasing", pair)
+			}
+		}
+
+		schedule = append(schedule, step)
+	}
+
+	return schedule, nil
+}
+
+func (d DunningSchedule) String() string {
+	steps := make([]string, len(d))
+	for i, step := range d {
+		steps[i] = fmt.Sprintf("%d:%s", step.AfterDays, step.Action)
+	}
+	return strings.Join(steps, ",")
+}
+
+// Scan reads a schedule stored in its string form. NULL scans to a nil
+// schedule, meaning "use the default".
+func (d *DunningSchedule) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		schedule, err := ParseDunningSchedule(value)
+		*d = schedule
+		return err
+	case []byte:
+		schedule, err := ParseDunningSchedule(string(value))
+		*d = schedule
+		return err
+	default:
+		return fmt.Errorf("cannot scan %T into DunningSchedule", src)
+	}
+}
+
+func (d DunningSchedule) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, nil
+	}
+	return d.String(), nil
+}
+
+// DunningAttempt records a dunning step that was carried out for a bill.
+type DunningAttempt struct {
+	ID        int       `json:"id"`
+	BillID    int       `json:"bill_id"`
+	Step      int       `json:"step"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
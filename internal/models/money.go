@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const DefaultCurrency = "USD"
+
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// currencyExponents lists ISO 4217 currencies whose minor unit is not
+// hundredths. Every other currency is assumed to have two decimals.
+var currencyExponents = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"IQD": 3,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+func CurrencyExponent(currency string) int {
+	if exp, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// Money is an exact amount in the minor unit of an ISO 4217 currency,
+// e.g. {Amount: 1999, Currency: "USD"} is $19.99 and
+// {Amount: 1999, Currency: "JPY"} is ¥1999.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.checkCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.checkCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) MulInt(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// MulRat multiplies m by numerator/denominator and rounds the result to
+// the nearest minor unit, with halves rounded away from zero. It is the
+// building block for proration and percentage discounts.
+func (m Money) MulRat(numerator, denominator int64) Money {
+	if denominator == 0 {
+		panic("models: MulRat with zero denominator")
+	}
+
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(numerator))
+	den := big.NewInt(denominator)
+	if den.Sign() < 0 {
+		product.Neg(product)
+		den.Neg(den)
+	}
+
+	quotient, remainder := new(big.Int).QuoRem(product, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(product.Sign())))
+	}
+
+	return Money{Amount: quotient.Int64(), Currency: m.Currency}
+}
+
+// String formats m in major units, e.g. "19.99 USD".
+func (m Money) String() string {
+	exp := CurrencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	if exp == 0 {
+		return fmt.Sprintf("%s%d %s", sign, amount, m.Currency)
+	}
+
+	unit := int64(1)
+	for range exp {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/unit, exp, amount%unit, m.Currency)
+}
+
+func (m Money) checkCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+const (
+	PaymentAttemptStatusSucceeded = "succeeded"
+	PaymentAttemptStatusFailed    = "failed"
+)
+
+// PaymentAttempt records one charge of a bill through a payment provider,
+// successful or not.
+type PaymentAttempt struct {
+	ID                int        `json:"id"`
+	BillID            int        `json:"bill_id"`
+	Provider          string     `json:"provider"`
+	Amount            Money      `json:"amount"`
+	Status            string     `json:"status"`
+	ProviderReference string     `json:"provider_reference,omitempty"`
+	FailureCode       string     `json:"failure_code,omitempty"`
+	StartedAt         time.Time  `json:"started_at"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// PaymentMethod is a card or bank account saved by a user. Only the
+// provider's token and a few display details are stored, never the full
+// card or account number.
+type PaymentMethod struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Type      string    `json:"type"`
+	Token     string    `json:"-"`
+	Last4     string    `json:"last4"`
+	ExpMonth  *int      `json:"exp_month,omitempty"`
+	ExpYear   *int      `json:"exp_year,omitempty"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// PendingItem is a line waiting to be added to a subscription's next bill,
+// such as the prorated charge for seats added part way through a period.
+// BillID is set once it has been billed.
+type PendingItem struct {
+	ID             int        `json:"id"`
+	SubscriptionID int        `json:"subscription_id"`
+	Kind           string     `json:"kind"`
+	Description    string     `json:"description"`
+	Quantity       int        `json:"quantity"`
+	UnitAmount     Money      `json:"unit_amount"`
+	PeriodStart    *time.Time `json:"period_start,omitempty"`
+	PeriodEnd      *time.Time `json:"period_end,omitempty"`
+	BillID         *int       `json:"bill_id,omitempty"`
+	ProductID      *int       `json:"product_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// BillItem returns the bill line for the pending item.
+func (p *PendingItem) BillItem() *BillItem {
+	return &BillItem{
+		Kind:        p.Kind,
+		Description: p.Description,
+		Quantity:    p.Quantity,
+		UnitAmount:  p.UnitAmount,
+		PeriodStart: p.PeriodStart,
+		PeriodEnd:   p.PeriodEnd,
+		ProductID:   p.ProductID,
+	}
+}
@@ -1,11 +1,197 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	BillingIntervalWeek  = "week"
+	BillingIntervalMonth = "month"
+	BillingIntervalYear  = "year"
+)
+
+// TaxCategoryStandard is the tax category of products that have not been
+// given one of their own.
+const TaxCategoryStandard = "standard"
+
+const (
+	// UsageTypeLicensed products are billed in advance for each period.
+	UsageTypeLicensed = "licensed"
+	// UsageTypeMetered products are billed in arrears for the usage
+	// reported during each period.
+	UsageTypeMetered = "metered"
+)
+
+// How the usage records of a period are combined into the quantity billed.
+const (
+	UsageAggregationSum  = "sum"
+	UsageAggregationMax  = "max"
+	UsageAggregationLast = "last"
+)
+
+// Pricing schemes set how the price of a quantity of a product is worked
+// out.
+const (
+	// PricingSchemeFlat charges Price whatever the quantity.
+	PricingSchemeFlat = "flat"
+	// PricingSchemePerUnit charges Price for every unit.
+	PricingSchemePerUnit = "per_unit"
+	// PricingSchemeGraduated charges each unit at the rate of the tier it
+	// falls in, so a quantity spanning several tiers is priced in parts.
+	PricingSchemeGraduated = "graduated"
+	// PricingSchemeVolume charges every unit at the rate of the tier the
+	// whole quantity falls in.
+	PricingSchemeVolume = "volume"
+	// PricingSchemePackage charges Price for every PackageSize units or
+	// part of them.
+	PricingSchemePackage = "package"
+)
+
+// ErrPriceUnavailable is returned when a product is not sold in the
+// requested currency.
+var ErrPriceUnavailable = errors.New("price unavailable")
+
+// PriceTier is the unit price of the units up to and including UpTo, after
+// those covered by the tiers before it. The last tier has no UpTo.
+type PriceTier struct {
+	UpTo       *int64 `json:"up_to"`
+	UnitAmount Money  `json:"unit_amount"`
+}
 
 type Product struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       Money  `json:"price"`
+	// Prices lists the product's price in every currency it is sold in,
+	// starting with Price, its price in its default currency.
+	Prices               []Money         `json:"prices,omitempty"`
+	BillingInterval      string          `json:"billing_interval"`
+	BillingIntervalCount int             `json:"billing_interval_count"`
+	TrialDays            int             `json:"trial_days"`
+	DunningSchedule      DunningSchedule `json:"dunning_schedule,omitempty"`
+	TaxCategory          string          `json:"tax_category"`
+	UsageType            string          `json:"usage_type"`
+	// AddOn products are not subscribed to on their own but attached to
+	// another subscription.
+	AddOn bool `json:"add_on"`
+	// UsageAggregation is how a metered product's usage is combined over
+	// a period: its sum, its maximum or the last value reported.
+	UsageAggregation string `json:"usage_aggregation,omitempty"`
+	// PricingScheme is how the price of a quantity, of seats or of usage,
+	// is worked out. Products without one are priced per unit.
+	PricingScheme string `json:"pricing_scheme"`
+	// Tiers are the rates of the graduated and volume pricing schemes.
+	Tiers []PriceTier `json:"tiers,omitempty"`
+	// PackageSize is the number of units Price buys under the package
+	// pricing scheme.
+	PackageSize int       `json:"package_size,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
+
+// PriceLine is the part of a price charged at one rate.
+type PriceLine struct {
+	Description string `json:"description"`
+	Quantity    int64  `json:"quantity"`
+	UnitAmount  Money  `json:"unit_amount"`
+	Amount      Money  `json:"amount"`
+}
+
+// PriceQuote is what a quantity of a product costs for one billing period.
+type PriceQuote struct {
+	ProductID     int         `json:"product_id"`
+	PricingScheme string      `json:"pricing_scheme"`
+	Quantity      int64       `json:"quantity"`
+	Lines         []PriceLine `json:"lines"`
+	Amount        Money       `json:"amount"`
+}
+
+func (p *Product) IsMetered() bool {
+	return p.UsageType == UsageTypeMetered
+}
+
+// Scheme returns the product's pricing scheme.
+func (p *Product) Scheme() string {
+	if p.PricingScheme == "" {
+		return PricingSchemePerUnit
+	}
+	return p.PricingScheme
+}
+
+// PriceIn returns the product's price in currency, or its default price
+// when currency is empty.
+func (p *Product) PriceIn(currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == p.Price.Currency {
+		return p.Price, nil
+	}
+
+	for _, price := range p.Prices {
+		if price.Currency == currency {
+			return price, nil
+		}
+	}
+
+	return Money{}, fmt.Errorf("%w: product %d is not sold in %s", ErrPriceUnavailable, p.ID, currency)
+}
+
+// TiersIn returns the product's price tiers in currency, or in its default
+// currency when currency is empty.
+func (p *Product) TiersIn(currency string) []PriceTier {
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		currency = p.Price.Currency
+	}
+
+	var tiers []PriceTier
+	for _, tier := range p.Tiers {
+		if tier.UnitAmount.Currency == currency {
+			tiers = append(tiers, tier)
+		}
+	}
+	return tiers
+}
+
+// NextBillingDate returns the first billing date strictly after `after` on
+// the product's schedule anchored at anchor, e.g. every 3 months for a
+// quarterly plan. Month and year intervals keep the anchor's day of month,
+// clamped to the last day of shorter months, so a subscription anchored on
+// Jan 31 bills on Feb 28 (or 29), then Mar 31, then Apr 30.
+func (p *Product) NextBillingDate(anchor, after time.Time) time.Time {
+	count := p.BillingIntervalCount
+	if count < 1 {
+		count = 1
+	}
+
+	for n := count; ; n += count {
+		if next := addBillingIntervals(anchor, p.BillingInterval, n); next.After(after) {
+			return next
+		}
+	}
+}
+
+func addBillingIntervals(anchor time.Time, interval string, n int) time.Time {
+	switch interval {
+	case BillingIntervalWeek:
+		return anchor.AddDate(0, 0, 7*n)
+	case BillingIntervalYear:
+		return addMonthsClamped(anchor, 12*n)
+	default:
+		return addMonthsClamped(anchor, n)
+	}
+}
+
+// addMonthsClamped is time.AddDate for months without normalisation: Jan 31
+// plus one month is Feb 28 (or 29) rather than Mar 3.
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	firstOfMonth := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	if lastDay := firstOfMonth.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
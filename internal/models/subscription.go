@@ -1,13 +1,47 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+// ErrSubscriptionExists is returned when a user who already has a
+// subscription to a product, other than a cancelled one, would get another.
+var ErrSubscriptionExists = errors.New("user already has an active subscription for this product")
+
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusHold      = "hold"
+	SubscriptionStatusCancelled = "cancelled"
+	SubscriptionStatusPaused    = "paused"
+	SubscriptionStatusTrialing  = "trialing"
+	SubscriptionStatusPastDue   = "past_due"
+	SubscriptionStatusUnpaid    = "unpaid"
+)
 
 type Subscription struct {
-	ID              int       `json:"id"`
-	UserID          int       `json:"user_id"`
-	ProductID       int       `json:"product_id"`
-	StartDate       time.Time `json:"start_date"`
-	NextBillingDate time.Time `json:"next_billing_date"`
-	Status          string    `json:"status"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID        int    `json:"id"`
+	UserID    int    `json:"user_id"`
+	ProductID int    `json:"product_id"`
+	Currency  string `json:"currency"`
+	// Quantity is the number of units, such as seats, of the product the
+	// subscription pays for each period.
+	Quantity           int        `json:"quantity"`
+	PendingProductID   *int       `json:"pending_product_id,omitempty"`
+	BillingAnchor      time.Time  `json:"billing_anchor"`
+	StartDate          time.Time  `json:"start_date"`
+	NextBillingDate    time.Time  `json:"next_billing_date"`
+	Status             string     `json:"status"`
+	TrialEndsAt        *time.Time `json:"trial_ends_at,omitempty"`
+	CancelAtPeriodEnd  bool       `json:"cancel_at_period_end"`
+	CancelledAt        *time.Time `json:"cancelled_at,omitempty"`
+	CancellationReason string     `json:"cancellation_reason,omitempty"`
+	PausedAt           *time.Time `json:"paused_at,omitempty"`
+	ResumeAt           *time.Time `json:"resume_at,omitempty"`
+	AutoCollect        bool       `json:"auto_collect"`
+	CouponID           *int       `json:"coupon_id,omitempty"`
+	// CouponCyclesLeft counts the bills the coupon still discounts; it is
+	// nil for coupons that last forever.
+	CouponCyclesLeft *int      `json:"coupon_cycles_left,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUsageKeyReused is returned when a usage record is reported again with
+// the idempotency key of an earlier, different record.
+var ErrUsageKeyReused = errors.New("idempotency key already used for a different usage record")
+
+// UsageRecord is a quantity of a metered product used by a subscription at
+// a point in time. Clients retry reports safely by reusing the
+// IdempotencyKey.
+type UsageRecord struct {
+	ID             int       `json:"id"`
+	SubscriptionID int       `json:"subscription_id"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	Quantity       int64     `json:"quantity"`
+	Timestamp      time.Time `json:"timestamp"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// UsageSummary is a subscription's usage over a billing period.
+type UsageSummary struct {
+	PeriodStart time.Time      `json:"period_start"`
+	PeriodEnd   time.Time      `json:"period_end"`
+	Aggregation string         `json:"aggregation"`
+	Quantity    int64          `json:"quantity"`
+	Records     []*UsageRecord `json:"records"`
+}
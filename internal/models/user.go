@@ -3,8 +3,16 @@ package models
 import "time"
 
 type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
+	ID                     int      `json:"id"`
+	Name                   string   `json:"name"`
+	Email                  string   `json:"email"`
+	DefaultPaymentMethodID *int     `json:"default_payment_method_id"`
+	BillingAddress         *Address `json:"billing_address,omitempty"`
+	// TaxID is the business tax number, e.g. an EU VAT ID, of customers
+	// buying as a business.
+	TaxID string `json:"tax_id,omitempty"`
+	// Currency is the currency the user's subscriptions are billed in
+	// unless another is chosen when subscribing.
+	Currency  string    `json:"currency,omitempty" binding:"omitempty,len=3"`
 	CreatedAt time.Time `json:"created_at"`
 }
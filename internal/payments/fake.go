@@ -0,0 +1,168 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeDecline Outcome = "decline"
+	OutcomeTimeout Outcome = "timeout"
+)
+
+// Card numbers that make the fake provider fail every charge against the
+// resulting token, for exercising failure paths through the API.
+const (
+	FakeCardDecline = "4000000000000002"
+	FakeCardTimeout = "4000000000000119"
+)
+
+// FakeProvider is an in-process PaymentProvider for tests and local
+// development. Outcomes queued with Script are used first, one per charge
+// or refund; after that the outcome is decided by the payment method.
+type FakeProvider struct {
+	mu       sync.Mutex
+	script   []Outcome
+	tokens   map[string]Outcome
+	charges  map[string]*fakeCharge
+	requests map[string]any
+	seq      int
+}
+
+type fakeCharge struct {
+	amount   models.Money
+	refunded models.Money
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		tokens:   make(map[string]Outcome),
+		charges:  make(map[string]*fakeCharge),
+		requests: make(map[string]any),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// Script queues outcomes for the next charges and refunds.
+func (p *FakeProvider) Script(outcomes ...Outcome) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.script = append(p.script, outcomes...)
+}
+
+func (p *FakeProvider) Tokenize(ctx context.Context, details PaymentMethodDetails) (*PaymentMethodToken, error) {
+	if details.Type != PaymentMethodCard && details.Type != PaymentMethodBankAccount {
+		return nil, fmt.Errorf("unsupported payment method type %q", details.Type)
+	}
+	if len(details.Number) < 4 {
+		return nil, errors.New("payment method number is too short")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	token := fmt.Sprintf("fake_tok_%d", p.seq)
+	switch details.Number {
+	case FakeCardDecline:
+		p.tokens[token] = OutcomeDecline
+	case FakeCardTimeout:
+		p.tokens[token] = OutcomeTimeout
+	}
+
+	return &PaymentMethodToken{
+		Token: token,
+		Type:  details.Type,
+		Last4: details.Number[len(details.Number)-4:],
+	}, nil
+}
+
+func (p *FakeProvider) Charge(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if previous, ok := p.requests[req.IdempotencyKey].(*Charge); ok && req.IdempotencyKey != "" {
+		return previous, nil
+	}
+
+	if err := p.fail(ctx, p.tokens[req.PaymentMethod]); err != nil {
+		return nil, err
+	}
+
+	p.seq++
+	charge := &Charge{Reference: fmt.Sprintf("fake_ch_%d", p.seq), Amount: req.Amount}
+	p.charges[charge.Reference] = &fakeCharge{amount: req.Amount, refunded: models.NewMoney(0, req.Amount.Currency)}
+	if req.IdempotencyKey != "" {
+		p.requests[req.IdempotencyKey] = charge
+	}
+
+	return charge, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if previous, ok := p.requests[req.IdempotencyKey].(*Refund); ok && req.IdempotencyKey != "" {
+		return previous, nil
+	}
+
+	charge, ok := p.charges[req.ChargeReference]
+	if !ok {
+		return nil, fmt.Errorf("charge %s not found", req.ChargeReference)
+	}
+
+	refunded, err := charge.refunded.Add(req.Amount)
+	if err != nil {
+		return nil, err
+	}
+	if remaining, _ := charge.amount.Sub(refunded); remaining.IsNegative() {
+		return nil, fmt.Errorf("refund of %s exceeds what is left of charge %s", req.Amount, req.ChargeReference)
+	}
+
+	if err := p.fail(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	charge.refunded = refunded
+	p.seq++
+	refund := &Refund{Reference: fmt.Sprintf("fake_re_%d", p.seq), Amount: req.Amount}
+	if req.IdempotencyKey != "" {
+		p.requests[req.IdempotencyKey] = refund
+	}
+
+	return refund, nil
+}
+
+// fail consumes the next scripted outcome, falling back to the given one,
+// and returns the matching error. The caller must hold p.mu.
+func (p *FakeProvider) fail(ctx context.Context, fallback Outcome) error {
+	if err := ctx.Err(); err != nil {
+		return &Error{Code: FailureCodeTimeout, Message: err.Error()}
+	}
+
+	outcome := fallback
+	if len(p.script) > 0 {
+		outcome = p.script[0]
+		p.script = p.script[1:]
+	}
+
+	switch outcome {
+	case OutcomeDecline:
+		return &Error{Code: FailureCodeDeclined, Message: "the card was declined"}
+	case OutcomeTimeout:
+		return &Error{Code: FailureCodeTimeout, Message: "the payment provider did not respond in time"}
+	default:
+		return nil
+	}
+}
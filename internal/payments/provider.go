@@ -0,0 +1,101 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+const (
+	PaymentMethodCard        = "card"
+	PaymentMethodBankAccount = "bank_account"
+)
+
+// Failure codes reported by providers. Providers may report codes of their
+// own; these are the ones the service itself relies on.
+const (
+	FailureCodeDeclined      = "card_declined"
+	FailureCodeTimeout       = "timeout"
+	FailureCodeProviderError = "provider_error"
+)
+
+// PaymentProvider moves money through an external payment gateway. The
+// service never sees raw card or bank details after Tokenize; every other
+// call refers to the returned token.
+type PaymentProvider interface {
+	Name() string
+	Tokenize(ctx context.Context, details PaymentMethodDetails) (*PaymentMethodToken, error)
+	Charge(ctx context.Context, req ChargeRequest) (*Charge, error)
+	Refund(ctx context.Context, req RefundRequest) (*Refund, error)
+}
+
+type PaymentMethodDetails struct {
+	Type     string `json:"type" binding:"required"`
+	Number   string `json:"number" binding:"required"`
+	ExpMonth int    `json:"exp_month,omitempty"`
+	ExpYear  int    `json:"exp_year,omitempty"`
+}
+
+type PaymentMethodToken struct {
+	Token string
+	Type  string
+	Last4 string
+}
+
+type ChargeRequest struct {
+	Amount        models.Money
+	PaymentMethod string
+	// IdempotencyKey lets the provider recognise a retried request so the
+	// customer is not charged twice.
+	IdempotencyKey string
+}
+
+type Charge struct {
+	Reference string
+	Amount    models.Money
+}
+
+type RefundRequest struct {
+	ChargeReference string
+	Amount          models.Money
+	IdempotencyKey  string
+}
+
+type Refund struct {
+	Reference string
+	Amount    models.Money
+}
+
+// Error is returned by providers when a payment is refused or could not be
+// completed, e.g. a declined card or a gateway timeout.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("payment failed: %s (%s)", e.Message, e.Code)
+}
+
+// FailureCode returns the provider failure code carried by err, or
+// FailureCodeProviderError when err is not a payment *Error.
+func FailureCode(err error) string {
+	var paymentErr *Error
+	if errors.As(err, &paymentErr) {
+		return paymentErr.Code
+	}
+	return FailureCodeProviderError
+}
+
+// New returns the provider configured by name. Only the in-process fake is
+// available so far; it is also the default.
+func New(name string) (PaymentProvider, error) {
+	switch name {
+	case "", "fake":
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
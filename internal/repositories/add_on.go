@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+const addOnColumns = `id, subscription_id, product_id, quantity, created_at`
+
+func scanAddOn(row rowScanner) (*models.SubscriptionAddOn, error) {
+	var addOn models.SubscriptionAddOn
+	err := row.Scan(
+		&addOn.ID,
+		&addOn.SubscriptionID,
+		&addOn.ProductID,
+		&addOn.Quantity,
+		&addOn.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &addOn, nil
+}
+
+type AddOnRepository struct {
+	DB DBTX
+}
+
+func NewAddOnRepository(db DBTX) *AddOnRepository {
+	return &AddOnRepository{DB: db}
+}
+
+func (r *AddOnRepository) Create(ctx context.Context, addOn *models.SubscriptionAddOn) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO subscription_add_ons (subscription_id, product_id, quantity)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(ctx, addOn.SubscriptionID, addOn.ProductID, addOn.Quantity).Scan(&addOn.ID, &addOn.CreatedAt)
+}
+
+func (r *AddOnRepository) GetByID(ctx context.Context, id int) (*models.SubscriptionAddOn, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+addOnColumns+`
+		FROM subscription_add_ons
+		WHERE id = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	addOn, err := scanAddOn(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("add-on %d not found", id)
+		}
+		return nil, err
+	}
+
+	return addOn, nil
+}
+
+// GetBySubscriptionID returns the add-ons attached to the subscription,
+// oldest first.
+func (r *AddOnRepository) GetBySubscriptionID(ctx context.Context, subscriptionID int) ([]*models.SubscriptionAddOn, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+addOnColumns+`
+		FROM subscription_add_ons
+		WHERE subscription_id = $1
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addOns := make([]*models.SubscriptionAddOn, 0)
+	for rows.Next() {
+		addOn, err := scanAddOn(rows)
+		if err != nil {
+			return nil, err
+		}
+		addOns = append(addOns, addOn)
+	}
+
+	return addOns, rows.Err()
+}
+
+func (r *AddOnRepository) Delete(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		DELETE FROM subscription_add_ons
+		WHERE id = $1
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
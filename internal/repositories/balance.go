@@ -0,0 +1,127 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+type BalanceRepository struct {
+	DB DBTX
+}
+
+func NewBalanceRepository(db DBTX) *BalanceRepository {
+	return &BalanceRepository{DB: db}
+}
+
+func (r *BalanceRepository) Create(ctx context.Context, entry *models.BalanceEntry) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO balance_entries (user_id, amount, currency, reason, bill_id, subscription_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(
+		ctx,
+		entry.UserID,
+		entry.Amount.Amount,
+		entry.Amount.Currency,
+		entry.Reason,
+		entry.BillID,
+		entry.SubscriptionID,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+func (r *BalanceRepository) GetByUserID(ctx context.Context, userID int) ([]*models.BalanceEntry, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT id, user_id, amount, currency, reason, bill_id, subscription_id, created_at
+		FROM balance_entries
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*models.BalanceEntry, 0)
+	for rows.Next() {
+		var entry models.BalanceEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.Amount.Amount,
+			&entry.Amount.Currency,
+			&entry.Reason,
+			&entry.BillID,
+			&entry.SubscriptionID,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, nil
+}
+
+// GetBalances returns the user's balance in every currency they have
+// entries in, including currencies whose balance has come back to zero.
+func (r *BalanceRepository) GetBalances(ctx context.Context, userID int) ([]models.Money, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0), currency
+		FROM balance_entries
+		WHERE user_id = $1
+		GROUP BY currency
+		ORDER BY currency
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make([]models.Money, 0)
+	for rows.Next() {
+		var balance models.Money
+		if err := rows.Scan(&balance.Amount, &balance.Currency); err != nil {
+			return nil, err
+		}
+		balances = append(balances, balance)
+	}
+
+	return balances, nil
+}
+
+// GetBalance returns the user's balance in one currency. It locks the user
+// row so that concurrent transactions cannot spend the same credit twice.
+func (r *BalanceRepository) GetBalance(ctx context.Context, userID int, currency string) (models.Money, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT COALESCE(SUM(e.amount), 0)
+		FROM (SELECT id FROM users WHERE id = $1 FOR UPDATE) u
+		LEFT JOIN balance_entries e ON e.user_id = u.id AND e.currency = $2
+	`)
+	if err != nil {
+		return models.Money{}, err
+	}
+	defer stmt.Close()
+
+	balance := models.NewMoney(0, currency)
+	err = stmt.QueryRowContext(ctx, userID, currency).Scan(&balance.Amount)
+	return balance, err
+}
@@ -1,25 +1,76 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/zaher1307/subscription-service/internal/models"
 )
 
+const billColumns = `
+	b.id, b.subscription_id, b.type, b.amount, b.currency, b.discount, b.coupon_id, b.tax, b.credit_applied, b.amount_refunded, b.status,
+	b.period_start, b.created_at, b.paid_at
+`
+
+// billsPeriodConstraint keeps a subscription to one bill per period.
+const billsPeriodConstraint = "bills_subscription_id_period_start_key"
+
+func scanBill(row rowScanner) (*models.Bill, error) {
+	var bill models.Bill
+	err := row.Scan(
+		&bill.ID,
+		&bill.SubscriptionID,
+		&bill.Type,
+		&bill.Amount.Amount,
+		&bill.Amount.Currency,
+		&bill.Discount.Amount,
+		&bill.CouponID,
+		&bill.Tax.Amount,
+		&bill.CreditApplied.Amount,
+		&bill.AmountRefunded.Amount,
+		&bill.Status,
+		&bill.PeriodStart,
+		&bill.CreatedAt,
+		&bill.PaidAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	bill.Discount.Currency = bill.Amount.Currency
+	bill.Tax.Currency = bill.Amount.Currency
+	bill.CreditApplied.Currency = bill.Amount.Currency
+	bill.AmountRefunded.Currency = bill.Amount.Currency
+
+	return &bill, nil
+}
+
 type BillRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewBillRepository(db *sql.DB) *BillRepository {
+func NewBillRepository(db DBTX) *BillRepository {
 	return &BillRepository{DB: db}
 }
 
-func (r *BillRepository) Create(bill *models.Bill) error {
-	stmt, err := r.DB.Prepare(`
-		INSERT INTO bills (subscription_id, amount, status, paid_at)
-		VALUES ($1, $2, $3, $4)
+func (r *BillRepository) Create(ctx context.Context, bill *models.Bill) error {
+	if bill.Type == "" {
+		bill.Type = models.BillTypeSubscription
+	}
+	bill.Discount = models.NewMoney(bill.Discount.Amount, bill.Amount.Currency)
+	bill.Tax = models.NewMoney(bill.Tax.Amount, bill.Amount.Currency)
+	bill.CreditApplied = models.NewMoney(bill.CreditApplied.Amount, bill.Amount.Currency)
+	bill.AmountRefunded = models.NewMoney(0, bill.Amount.Currency)
+
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO bills (
+			subscription_id, type, amount, currency, discount, coupon_id, tax, credit_applied, status, period_start, paid_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		RETURNING id, created_at
 	`)
 	if err != nil {
@@ -27,34 +78,133 @@ func (r *BillRepository) Create(bill *models.Bill) error {
 	}
 	defer stmt.Close()
 
-	return stmt.QueryRow(
+	err = stmt.QueryRowContext(
+		ctx,
 		bill.SubscriptionID,
-		bill.Amount,
+		bill.Type,
+		bill.Amount.Amount,
+		bill.Amount.Currency,
+		bill.Discount.Amount,
+		bill.CouponID,
+		bill.Tax.Amount,
+		bill.CreditApplied.Amount,
 		bill.Status,
+		bill.PeriodStart,
 		bill.PaidAt,
 	).Scan(&bill.ID, &bill.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == billsPeriodConstraint {
+			return fmt.Errorf("%w: subscription %d, period starting %s", models.ErrPeriodAlreadyBilled, bill.SubscriptionID, bill.PeriodStart.Format(time.RFC3339))
+		}
+		return err
+	}
+
+	return r.createItems(ctx, bill)
 }
 
-func (r *BillRepository) GetByID(id int) (*models.Bill, error) {
-	stmt, err := r.DB.Prepare(`
-		SELECT id, subscription_id, amount, status, created_at, paid_at
-		FROM bills
-		WHERE id = $1
+// createItems stores the bill's line items alongside it.
+func (r *BillRepository) createItems(ctx context.Context, bill *models.Bill) error {
+	if len(bill.Items) == 0 {
+		return nil
+	}
+
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO bill_items (
+			bill_id, kind, description, quantity, unit_amount, amount, currency, period_start, period_end, inclusive,
+			product_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range bill.Items {
+		item.BillID = bill.ID
+		err := stmt.QueryRowContext(
+			ctx,
+			item.BillID,
+			item.Kind,
+			item.Description,
+			item.Quantity,
+			item.UnitAmount.Amount,
+			item.Amount.Amount,
+			item.Amount.Currency,
+			item.PeriodStart,
+			item.PeriodEnd,
+			item.Inclusive,
+			item.ProductID,
+		).Scan(&item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetItems returns the bill's line items in the order they were added.
+func (r *BillRepository) GetItems(ctx context.Context, billID int) ([]*models.BillItem, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT
+			id, bill_id, kind, description, quantity, unit_amount, amount, currency, period_start, period_end,
+			inclusive, product_id
+		FROM bill_items
+		WHERE bill_id = $1
+		ORDER BY id
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	var bill models.Bill
-	err = stmt.QueryRow(id).Scan(
-		&bill.ID,
-		&bill.SubscriptionID,
-		&bill.Amount,
-		&bill.Status,
-		&bill.CreatedAt,
-		&bill.PaidAt,
-	)
+	rows, err := stmt.QueryContext(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.BillItem, 0)
+	for rows.Next() {
+		var item models.BillItem
+		if err := rows.Scan(
+			&item.ID,
+			&item.BillID,
+			&item.Kind,
+			&item.Description,
+			&item.Quantity,
+			&item.UnitAmount.Amount,
+			&item.Amount.Amount,
+			&item.Amount.Currency,
+			&item.PeriodStart,
+			&item.PeriodEnd,
+			&item.Inclusive,
+			&item.ProductID,
+		); err != nil {
+			return nil, err
+		}
+		item.UnitAmount.Currency = item.Amount.Currency
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *BillRepository) GetByID(ctx context.Context, id int) (*models.Bill, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+billColumns+`
+		FROM bills b
+		WHERE b.id = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	bill, err := scanBill(stmt.QueryRowContext(ctx, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("bill %d not found", id)
@@ -62,12 +212,36 @@ func (r *BillRepository) GetByID(id int) (*models.Bill, error) {
 		return nil, err
 	}
 
-	return &bill, nil
+	return bill, nil
 }
 
-func (r *BillRepository) GetByUserID(userID int) ([]*models.Bill, error) {
-	stmt, err := r.DB.Prepare(`
-		SELECT b.id, b.subscription_id, b.amount, b.status, b.created_at, b.paid_at
+// LockByID reads a bill and locks it for the rest of the transaction.
+func (r *BillRepository) LockByID(ctx context.Context, id int) (*models.Bill, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+billColumns+`
+		FROM bills b
+		WHERE b.id = $1
+		FOR UPDATE
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	bill, err := scanBill(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("bill %d not found", id)
+		}
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+func (r *BillRepository) GetByUserID(ctx context.Context, userID int) ([]*models.Bill, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+billColumns+`
 		FROM bills b
 		JOIN subscriptions s ON b.subscription_id = s.id
 		WHERE s.user_id = $1
@@ -77,7 +251,7 @@ func (r *BillRepository) GetByUserID(userID int) ([]*models.Bill, error) {
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(userID)
+	rows, err := stmt.QueryContext(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -85,28 +259,141 @@ func (r *BillRepository) GetByUserID(userID int) ([]*models.Bill, error) {
 
 	bills := make([]*models.Bill, 0)
 	for rows.Next() {
-		var bill models.Bill
-		if err := rows.Scan(
-			&bill.ID,
-			&bill.SubscriptionID,
-			&bill.Amount,
-			&bill.Status,
-			&bill.CreatedAt,
-			&bill.PaidAt,
-		); err != nil {
+		bill, err := scanBill(rows)
+		if err != nil {
 			return nil, err
 		}
-		bills = append(bills, &bill)
+		bills = append(bills, bill)
 	}
 
 	return bills, nil
 }
 
-func (r *BillRepository) MarkAsPaid(id int) error {
-	stmt, err := r.DB.Prepare(`
+// GetOverdue returns the pending period bills whose subscription is still
+// waiting for payment, oldest first.
+func (r *BillRepository) GetOverdue(ctx context.Context) ([]*models.Bill, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+billColumns+`
+		FROM bills b
+		JOIN subscriptions s ON b.subscription_id = s.id
+		WHERE b.status = 'pending' AND b.type = 'subscription' AND s.status IN ('hold', 'past_due')
+		ORDER BY b.created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bills := make([]*models.Bill, 0)
+	for rows.Next() {
+		bill, err := scanBill(rows)
+		if err != nil {
+			return nil, err
+		}
+		bills = append(bills, bill)
+	}
+
+	return bills, nil
+}
+
+// GetUncollected returns the pending period bills of auto-collected
+// subscriptions that were never charged, as when the billing job stopped
+// between creating a renewal bill and collecting it, oldest first.
+func (r *BillRepository) GetUncollected(ctx context.Context) ([]*models.Bill, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+billColumns+`
+		FROM bills b
+		JOIN subscriptions s ON b.subscription_id = s.id
+		WHERE b.status = 'pending' AND b.type = 'subscription' AND s.status = 'hold' AND s.auto_collect
+			AND NOT EXISTS (SELECT 1 FROM payment_attempts p WHERE p.bill_id = b.id)
+		ORDER BY b.created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bills := make([]*models.Bill, 0)
+	for rows.Next() {
+		bill, err := scanBill(rows)
+		if err != nil {
+			return nil, err
+		}
+		bills = append(bills, bill)
+	}
+
+	return bills, rows.Err()
+}
+
+// MarkUncollectible writes off a bill that is still pending.
+func (r *BillRepository) MarkUncollectible(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE bills
+		SET status = 'uncollectible'
+		WHERE id = $1 AND status = 'pending'
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
+
+// MarkOpenUncollectible writes off the subscription's pending period bills,
+// which can no longer be collected once it is cancelled.
+func (r *BillRepository) MarkOpenUncollectible(ctx context.Context, subscriptionID int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE bills
+		SET status = 'uncollectible'
+		WHERE subscription_id = $1 AND type = 'subscription' AND status = 'pending'
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, subscriptionID)
+	return err
+}
+
+// UpdateRefunded stores the total refunded so far and the status that goes
+// with it.
+func (r *BillRepository) UpdateRefunded(ctx context.Context, id int, refunded models.Money, status string) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE bills
+		SET amount_refunded = $1, status = $2
+		WHERE id = $3
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, refunded.Amount, status, id)
+	return err
+}
+
+// MarkAsPaid marks a pending bill paid. It returns models.ErrBillNotPending
+// if the bill has been settled some other way in the meantime.
+func (r *BillRepository) MarkAsPaid(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
 		UPDATE bills
 		SET status = 'paid', paid_at = $1
-		WHERE id = $2
+		WHERE id = $2 AND status = 'pending'
 	`)
 	if err != nil {
 		return err
@@ -114,7 +401,7 @@ func (r *BillRepository) MarkAsPaid(id int) error {
 	defer stmt.Close()
 
 	now := time.Now()
-	result, err := stmt.Exec(now, id)
+	result, err := stmt.ExecContext(ctx, now, id)
 	if err != nil {
 		return err
 	}
@@ -125,7 +412,7 @@ func (r *BillRepository) MarkAsPaid(id int) error {
 	}
 
 	if rowsAffected == 0 {
-		return sql.ErrNoRows
+		return fmt.Errorf("%w: bill %d", models.ErrBillNotPending, id)
 	}
 
 	return nil
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+const billingRunColumns = `
+	id, status, lock_holder, started_at, finished_at, error, subscriptions_scanned, bills_created, already_billed
+`
+
+func scanBillingRun(row rowScanner) (*models.BillingRun, error) {
+	var run models.BillingRun
+	var runErr sql.NullString
+	err := row.Scan(
+		&run.ID,
+		&run.Status,
+		&run.LockHolder,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&runErr,
+		&run.SubscriptionsScanned,
+		&run.BillsCreated,
+		&run.AlreadyBilled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	run.Error = runErr.String
+
+	return &run, nil
+}
+
+type BillingRunRepository struct {
+	DB DBTX
+}
+
+func NewBillingRunRepository(db DBTX) *BillingRunRepository {
+	return &BillingRunRepository{DB: db}
+}
+
+// Create records the start of a run.
+func (r *BillingRunRepository) Create(ctx context.Context, run *models.BillingRun) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO billing_runs (status, lock_holder, started_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(ctx, run.Status, run.LockHolder, run.StartedAt).Scan(&run.ID)
+}
+
+// Finish records the outcome of a run together with its failures.
+func (r *BillingRunRepository) Finish(ctx context.Context, run *models.BillingRun) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE billing_runs
+		SET status = $1, finished_at = $2, error = NULLIF($3, ''),
+			subscriptions_scanned = $4, bills_created = $5, already_billed = $6
+		WHERE id = $7
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(
+		ctx,
+		run.Status,
+		run.FinishedAt,
+		run.Error,
+		run.SubscriptionsScanned,
+		run.BillsCreated,
+		run.AlreadyBilled,
+		run.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return r.createFailures(ctx, run)
+}
+
+func (r *BillingRunRepository) createFailures(ctx context.Context, run *models.BillingRun) error {
+	if len(run.Failures) == 0 {
+		return nil
+	}
+
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO billing_run_failures (billing_run_id, subscription_id, reason)
+		VALUES ($1, $2, $3)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, failure := range run.Failures {
+		if _, err := stmt.ExecContext(ctx, run.ID, failure.SubscriptionID, failure.Reason); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *BillingRunRepository) GetByID(ctx context.Context, id int) (*models.BillingRun, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+billingRunColumns+`
+		FROM billing_runs
+		WHERE id = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	run, err := scanBillingRun(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("billing run %d not found", id)
+		}
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// GetRecent returns the latest limit runs, newest first.
+func (r *BillingRunRepository) GetRecent(ctx context.Context, limit int) ([]*models.BillingRun, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+billingRunColumns+`
+		FROM billing_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]*models.BillingRun, 0)
+	for rows.Next() {
+		run, err := scanBillingRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetFailures returns the subscriptions the run could not bill, in the
+// order it came across them.
+func (r *BillingRunRepository) GetFailures(ctx context.Context, runID int) ([]models.BillingRunFailure, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT subscription_id, reason
+		FROM billing_run_failures
+		WHERE billing_run_id = $1
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := make([]models.BillingRunFailure, 0)
+	for rows.Next() {
+		var failure models.BillingRunFailure
+		if err := rows.Scan(&failure.SubscriptionID, &failure.Reason); err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+
+	return failures, rows.Err()
+}
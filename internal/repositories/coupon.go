@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+const couponColumns = `
+	id, code, discount_type, percent_off, amount_off, currency, duration, duration_cycles,
+	max_redemptions, times_redeemed, expires_at, created_at
+`
+
+func scanCoupon(row rowScanner) (*models.Coupon, error) {
+	var coupon models.Coupon
+	var percentOff, durationCycles sql.NullInt64
+	var amountOff sql.NullInt64
+	var currency sql.NullString
+	err := row.Scan(
+		&coupon.ID,
+		&coupon.Code,
+		&coupon.DiscountType,
+		&percentOff,
+		&amountOff,
+		&currency,
+		&coupon.Duration,
+		&durationCycles,
+		&coupon.MaxRedemptions,
+		&coupon.TimesRedeemed,
+		&coupon.ExpiresAt,
+		&coupon.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	coupon.PercentOff = int(percentOff.Int64)
+	coupon.DurationCycles = int(durationCycles.Int64)
+	if amountOff.Valid {
+		amount := models.NewMoney(amountOff.Int64, currency.String)
+		coupon.AmountOff = &amount
+	}
+
+	return &coupon, nil
+}
+
+type CouponRepository struct {
+	DB DBTX
+}
+
+func NewCouponRepository(db DBTX) *CouponRepository {
+	return &CouponRepository{DB: db}
+}
+
+func (r *CouponRepository) Create(ctx context.Context, coupon *models.Coupon) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO coupons (
+			code, discount_type, percent_off, amount_off, currency, duration, duration_cycles,
+			max_redemptions, expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, times_redeemed, created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	var percentOff, durationCycles, amountOff sql.NullInt64
+	var currency sql.NullString
+	if coupon.PercentOff != 0 {
+		percentOff = sql.NullInt64{Int64: int64(coupon.PercentOff), Valid: true}
+	}
+	if coupon.DurationCycles != 0 {
+		durationCycles = sql.NullInt64{Int64: int64(coupon.DurationCycles), Valid: true}
+	}
+	if coupon.AmountOff != nil {
+		amountOff = sql.NullInt64{Int64: coupon.AmountOff.Amount, Valid: true}
+		currency = sql.NullString{String: coupon.AmountOff.Currency, Valid: true}
+	}
+
+	err = stmt.QueryRowContext(
+		ctx,
+		coupon.Code,
+		coupon.DiscountType,
+		percentOff,
+		amountOff,
+		currency,
+		coupon.Duration,
+		durationCycles,
+		coupon.MaxRedemptions,
+		coupon.ExpiresAt,
+	).Scan(&coupon.ID, &coupon.TimesRedeemed, &coupon.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if len(coupon.ProductIDs) == 0 {
+		return nil
+	}
+
+	productStmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO coupon_products (coupon_id, product_id)
+		VALUES ($1, $2)
+	`)
+	if err != nil {
+		return err
+	}
+	defer productStmt.Close()
+
+	for _, productID := range coupon.ProductIDs {
+		if _, err := productStmt.ExecContext(ctx, coupon.ID, productID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *CouponRepository) GetByID(ctx context.Context, id int) (*models.Coupon, error) {
+	return r.getCoupon(ctx, "id = $1", id, fmt.Sprintf("coupon %d not found", id))
+}
+
+func (r *CouponRepository) GetByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	return r.getCoupon(ctx, "code = $1", code, fmt.Sprintf("coupon %s not found", code))
+}
+
+func (r *CouponRepository) getCoupon(ctx context.Context, where string, arg any, notFound string) (*models.Coupon, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+couponColumns+`
+		FROM coupons
+		WHERE `+where)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	coupon, err := scanCoupon(stmt.QueryRowContext(ctx, arg))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", models.ErrInvalidCoupon, notFound)
+		}
+		return nil, err
+	}
+
+	coupon.ProductIDs, err = r.getProductIDs(ctx, coupon.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return coupon, nil
+}
+
+func (r *CouponRepository) getProductIDs(ctx context.Context, couponID int) ([]int, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT product_id
+		FROM coupon_products
+		WHERE coupon_id = $1
+		ORDER BY product_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, couponID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var productIDs []int
+	for rows.Next() {
+		var productID int
+		if err := rows.Scan(&productID); err != nil {
+			return nil, err
+		}
+		productIDs = append(productIDs, productID)
+	}
+
+	return productIDs, rows.Err()
+}
+
+// Redeem counts one more redemption of the coupon. The limit is checked in
+// the same statement so that concurrent redemptions cannot exceed it.
+func (r *CouponRepository) Redeem(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE coupons
+		SET times_redeemed = times_redeemed + 1
+		WHERE id = $1 AND (max_redemptions IS NULL OR times_redeemed < max_redemptions)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: coupon %d has reached its redemption limit", models.ErrInvalidCoupon, id)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+type CreditNoteRepository struct {
+	DB DBTX
+}
+
+func NewCreditNoteRepository(db DBTX) *CreditNoteRepository {
+	return &CreditNoteRepository{DB: db}
+}
+
+func (r *CreditNoteRepository) Create(ctx context.Context, note *models.CreditNote) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO credit_notes (bill_id, amount, currency, reason, provider_reference)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(
+		ctx,
+		note.BillID,
+		note.Amount.Amount,
+		note.Amount.Currency,
+		sql.NullString{String: note.Reason, Valid: note.Reason != ""},
+		sql.NullString{String: note.ProviderReference, Valid: note.ProviderReference != ""},
+	).Scan(&note.ID, &note.CreatedAt)
+}
+
+func (r *CreditNoteRepository) GetByBillID(ctx context.Context, billID int) ([]*models.CreditNote, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT id, bill_id, amount, currency, reason, provider_reference, created_at
+		FROM credit_notes
+		WHERE bill_id = $1
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := make([]*models.CreditNote, 0)
+	for rows.Next() {
+		var note models.CreditNote
+		var reason, providerReference sql.NullString
+		if err := rows.Scan(
+			&note.ID,
+			&note.BillID,
+			&note.Amount.Amount,
+			&note.Amount.Currency,
+			&reason,
+			&providerReference,
+			&note.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		note.Reason = reason.String
+		note.ProviderReference = providerReference.String
+		notes = append(notes, &note)
+	}
+
+	return notes, nil
+}
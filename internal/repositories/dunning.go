@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+type DunningRepository struct {
+	DB DBTX
+}
+
+func NewDunningRepository(db DBTX) *DunningRepository {
+	return &DunningRepository{DB: db}
+}
+
+func (r *DunningRepository) Create(ctx context.Context, attempt *models.DunningAttempt) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO dunning_attempts (bill_id, step, action)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(ctx, attempt.BillID, attempt.Step, attempt.Action).Scan(&attempt.ID, &attempt.CreatedAt)
+}
+
+func (r *DunningRepository) GetByBillID(ctx context.Context, billID int) ([]*models.DunningAttempt, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT id, bill_id, step, action, created_at
+		FROM dunning_attempts
+		WHERE bill_id = $1
+		ORDER BY step
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := make([]*models.DunningAttempt, 0)
+	for rows.Next() {
+		var attempt models.DunningAttempt
+		if err := rows.Scan(
+			&attempt.ID,
+			&attempt.BillID,
+			&attempt.Step,
+			&attempt.Action,
+			&attempt.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+
+	return attempts, nil
+}
@@ -1,37 +1,132 @@
 package repositories
 
 import (
+	"context"
 	"time"
 
 	"github.com/zaher1307/subscription-service/internal/models"
 )
 
 type ISubscriptionRepository interface {
-	Create(subscription *models.Subscription) error
-	GetByID(id int) (*models.Subscription, error)
-	GetActiveByUserAndProduct(userID, productID int) (*models.Subscription, error)
-	GetDueForBilling(date time.Time) ([]*models.Subscription, error)
-	UpdateNextBillingDate(id int, nextDate time.Time) error
-	UpdateStartDate(id int, nextDate time.Time) error
-	HoldSubscription(id int) error
-	ActivateSubscription(id int) error
+	Create(ctx context.Context, subscription *models.Subscription) error
+	GetByID(ctx context.Context, id int) (*models.Subscription, error)
+	LockByID(ctx context.Context, id int) (*models.Subscription, error)
+	ShareLockByID(ctx context.Context, id int) (*models.Subscription, error)
+	GetActiveByUserAndProduct(ctx context.Context, userID, productID int) (*models.Subscription, error)
+	GetDueForBilling(ctx context.Context, date time.Time) ([]*models.Subscription, error)
+	LockDueForBilling(ctx context.Context, id int, date time.Time) (*models.Subscription, error)
+	UpdateNextBillingDate(ctx context.Context, id int, nextDate time.Time) error
+	UpdateStartDate(ctx context.Context, id int, nextDate time.Time) error
+	UpdateBillingAnchor(ctx context.Context, id int, anchor time.Time) error
+	HoldSubscription(ctx context.Context, id int) error
+	ActivateSubscription(ctx context.Context, id int) error
+	MarkPastDue(ctx context.Context, id int) error
+	MarkUnpaid(ctx context.Context, id int) error
+	ScheduleCancellation(ctx context.Context, id int, reason string) error
+	Cancel(ctx context.Context, id int, cancelledAt time.Time, reason string) error
+	GetDueForResume(ctx context.Context, date time.Time) ([]*models.Subscription, error)
+	Pause(ctx context.Context, id int, pausedAt time.Time, resumeAt *time.Time) error
+	Resume(ctx context.Context, id int, billingAnchor, startDate, nextBillingDate time.Time) error
+	ChangeProduct(ctx context.Context, id, productID int) error
+	SchedulePlanChange(ctx context.Context, id int, productID *int) error
+	HasUsedTrial(ctx context.Context, userID, productID int) (bool, error)
+	UseCouponCycle(ctx context.Context, id int) error
+	UpdateQuantity(ctx context.Context, id, quantity int) error
 }
 
 type IProductRepository interface {
-	GetAll() ([]*models.Product, error)
-	GetByID(id int) (*models.Product, error)
+	GetAll(ctx context.Context) ([]*models.Product, error)
+	GetByID(ctx context.Context, id int) (*models.Product, error)
 }
 
 type IBillRepository interface {
-	Create(bill *models.Bill) error
-	GetByID(id int) (*models.Bill, error)
-	GetByUserID(userID int) ([]*models.Bill, error)
-	MarkAsPaid(id int) error
+	Create(ctx context.Context, bill *models.Bill) error
+	GetByID(ctx context.Context, id int) (*models.Bill, error)
+	LockByID(ctx context.Context, id int) (*models.Bill, error)
+	GetItems(ctx context.Context, billID int) ([]*models.BillItem, error)
+	GetByUserID(ctx context.Context, userID int) ([]*models.Bill, error)
+	MarkAsPaid(ctx context.Context, id int) error
+	GetOverdue(ctx context.Context) ([]*models.Bill, error)
+	GetUncollected(ctx context.Context) ([]*models.Bill, error)
+	MarkUncollectible(ctx context.Context, id int) error
+	MarkOpenUncollectible(ctx context.Context, subscriptionID int) error
+	UpdateRefunded(ctx context.Context, id int, refunded models.Money, status string) error
 }
 
 type IUserRepository interface {
-	Create(user *models.User) error
-	GetByID(id int) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	UpdateBillingDetails(ctx context.Context, user *models.User) error
+}
+
+type IDunningRepository interface {
+	Create(ctx context.Context, attempt *models.DunningAttempt) error
+	GetByBillID(ctx context.Context, billID int) ([]*models.DunningAttempt, error)
+}
+
+type IPaymentAttemptRepository interface {
+	Create(ctx context.Context, attempt *models.PaymentAttempt) error
+	GetByBillID(ctx context.Context, billID int) ([]*models.PaymentAttempt, error)
+}
+
+type IPaymentMethodRepository interface {
+	Create(ctx context.Context, method *models.PaymentMethod) error
+	GetByID(ctx context.Context, id int) (*models.PaymentMethod, error)
+	GetByUserID(ctx context.Context, userID int) ([]*models.PaymentMethod, error)
+	GetDefaultByUserID(ctx context.Context, userID int) (*models.PaymentMethod, error)
+	SetDefault(ctx context.Context, userID, id int) error
+	Delete(ctx context.Context, id int) error
+}
+
+type ICreditNoteRepository interface {
+	Create(ctx context.Context, note *models.CreditNote) error
+	GetByBillID(ctx context.Context, billID int) ([]*models.CreditNote, error)
+}
+
+type IBalanceRepository interface {
+	Create(ctx context.Context, entry *models.BalanceEntry) error
+	GetByUserID(ctx context.Context, userID int) ([]*models.BalanceEntry, error)
+	GetBalances(ctx context.Context, userID int) ([]models.Money, error)
+	GetBalance(ctx context.Context, userID int, currency string) (models.Money, error)
+}
+
+type ICouponRepository interface {
+	Create(ctx context.Context, coupon *models.Coupon) error
+	GetByID(ctx context.Context, id int) (*models.Coupon, error)
+	GetByCode(ctx context.Context, code string) (*models.Coupon, error)
+	Redeem(ctx context.Context, id int) error
+}
+
+type IPendingItemRepository interface {
+	Create(ctx context.Context, item *models.PendingItem) error
+	GetUnbilled(ctx context.Context, subscriptionID int) ([]*models.PendingItem, error)
+	MarkBilled(ctx context.Context, ids []int, billID int) error
+}
+
+type IAddOnRepository interface {
+	Create(ctx context.Context, addOn *models.SubscriptionAddOn) error
+	GetByID(ctx context.Context, id int) (*models.SubscriptionAddOn, error)
+	GetBySubscriptionID(ctx context.Context, subscriptionID int) ([]*models.SubscriptionAddOn, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type IUsageRepository interface {
+	Create(ctx context.Context, record *models.UsageRecord) (*models.UsageRecord, bool, error)
+	GetForPeriod(ctx context.Context, subscriptionID int, from, to time.Time) ([]*models.UsageRecord, error)
+	Aggregate(ctx context.Context, subscriptionID int, aggregation string, from, to time.Time) (int64, error)
+}
+
+type IBillingRunRepository interface {
+	Create(ctx context.Context, run *models.BillingRun) error
+	Finish(ctx context.Context, run *models.BillingRun) error
+	GetByID(ctx context.Context, id int) (*models.BillingRun, error)
+	GetRecent(ctx context.Context, limit int) ([]*models.BillingRun, error)
+	GetFailures(ctx context.Context, runID int) ([]models.BillingRunFailure, error)
+}
+
+type IUnitOfWork interface {
+	Do(ctx context.Context, fn func(repos *Repositories) error) error
 }
 
 var _ ISubscriptionRepository = (*SubscriptionRepository)(nil)
+var _ IUnitOfWork = (*UnitOfWork)(nil)
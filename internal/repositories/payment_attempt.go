@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+type PaymentAttemptRepository struct {
+	DB DBTX
+}
+
+func NewPaymentAttemptRepository(db DBTX) *PaymentAttemptRepository {
+	return &PaymentAttemptRepository{DB: db}
+}
+
+func (r *PaymentAttemptRepository) Create(ctx context.Context, attempt *models.PaymentAttempt) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO payment_attempts (
+			bill_id, provider, amount, currency, status, provider_reference, failure_code,
+			started_at, completed_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(
+		ctx,
+		attempt.BillID,
+		attempt.Provider,
+		attempt.Amount.Amount,
+		attempt.Amount.Currency,
+		attempt.Status,
+		sql.NullString{String: attempt.ProviderReference, Valid: attempt.ProviderReference != ""},
+		sql.NullString{String: attempt.FailureCode, Valid: attempt.FailureCode != ""},
+		attempt.StartedAt,
+		attempt.CompletedAt,
+	).Scan(&attempt.ID)
+}
+
+func (r *PaymentAttemptRepository) GetByBillID(ctx context.Context, billID int) ([]*models.PaymentAttempt, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT id, bill_id, provider, amount, currency, status, provider_reference, failure_code,
+			started_at, completed_at
+		FROM payment_attempts
+		WHERE bill_id = $1
+		ORDER BY started_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := make([]*models.PaymentAttempt, 0)
+	for rows.Next() {
+		var attempt models.PaymentAttempt
+		var providerReference, failureCode sql.NullString
+		if err := rows.Scan(
+			&attempt.ID,
+			&attempt.BillID,
+			&attempt.Provider,
+			&attempt.Amount.Amount,
+			&attempt.Amount.Currency,
+			&attempt.Status,
+			&providerReference,
+			&failureCode,
+			&attempt.StartedAt,
+			&attempt.CompletedAt,
+		); err != nil {
+			return nil, err
+		}
+		attempt.ProviderReference = providerReference.String
+		attempt.FailureCode = failureCode.String
+		attempts = append(attempts, &attempt)
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+const paymentMethodColumns = `
+	id, user_id, type, token, last4, exp_month, exp_year, is_default, created_at
+`
+
+func scanPaymentMethod(row rowScanner) (*models.PaymentMethod, error) {
+	var method models.PaymentMethod
+	err := row.Scan(
+		&method.ID,
+		&method.UserID,
+		&method.Type,
+		&method.Token,
+		&method.Last4,
+		&method.ExpMonth,
+		&method.ExpYear,
+		&method.IsDefault,
+		&method.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &method, nil
+}
+
+type PaymentMethodRepository struct {
+	DB DBTX
+}
+
+func NewPaymentMethodRepository(db DBTX) *PaymentMethodRepository {
+	return &PaymentMethodRepository{DB: db}
+}
+
+func (r *PaymentMethodRepository) Create(ctx context.Context, method *models.PaymentMethod) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO payment_methods (user_id, type, token, last4, exp_month, exp_year, is_default)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(
+		ctx,
+		method.UserID,
+		method.Type,
+		method.Token,
+		method.Last4,
+		method.ExpMonth,
+		method.ExpYear,
+		method.IsDefault,
+	).Scan(&method.ID, &method.CreatedAt)
+}
+
+func (r *PaymentMethodRepository) GetByID(ctx context.Context, id int) (*models.PaymentMethod, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+paymentMethodColumns+`
+		FROM payment_methods
+		WHERE id = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	method, err := scanPaymentMethod(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("payment method %d not found", id)
+		}
+		return nil, err
+	}
+
+	return method, nil
+}
+
+func (r *PaymentMethodRepository) GetByUserID(ctx context.Context, userID int) ([]*models.PaymentMethod, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+paymentMethodColumns+`
+		FROM payment_methods
+		WHERE user_id = $1
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	methods := make([]*models.PaymentMethod, 0)
+	for rows.Next() {
+		method, err := scanPaymentMethod(rows)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+
+	return methods, nil
+}
+
+// GetDefaultByUserID returns the user's default payment method, or nil if
+// the user has none.
+func (r *PaymentMethodRepository) GetDefaultByUserID(ctx context.Context, userID int) (*models.PaymentMethod, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+paymentMethodColumns+`
+		FROM payment_methods
+		WHERE user_id = $1 AND is_default
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	method, err := scanPaymentMethod(stmt.QueryRowContext(ctx, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return method, nil
+}
+
+// SetDefault makes the method its user's only default payment method. The
+// old default is cleared first, since the index allowing one default per
+// user is checked row by row; callers run it in a unit of work so the user
+// is never left without a default.
+func (r *PaymentMethodRepository) SetDefault(ctx context.Context, userID, id int) error {
+	unset, err := r.DB.PrepareContext(ctx, `
+		UPDATE payment_methods
+		SET is_default = FALSE
+		WHERE user_id = $1 AND is_default AND id <> $2
+	`)
+	if err != nil {
+		return err
+	}
+	defer unset.Close()
+
+	if _, err := unset.ExecContext(ctx, userID, id); err != nil {
+		return err
+	}
+
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE payment_methods
+		SET is_default = TRUE
+		WHERE user_id = $1 AND id = $2
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, userID, id)
+	return err
+}
+
+func (r *PaymentMethodRepository) Delete(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		DELETE FROM payment_methods
+		WHERE id = $1
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+type PendingItemRepository struct {
+	DB DBTX
+}
+
+func NewPendingItemRepository(db DBTX) *PendingItemRepository {
+	return &PendingItemRepository{DB: db}
+}
+
+func (r *PendingItemRepository) Create(ctx context.Context, item *models.PendingItem) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO pending_items (
+			subscription_id, kind, description, quantity, unit_amount, currency, period_start, period_end, product_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	return stmt.QueryRowContext(
+		ctx,
+		item.SubscriptionID,
+		item.Kind,
+		item.Description,
+		item.Quantity,
+		item.UnitAmount.Amount,
+		item.UnitAmount.Currency,
+		item.PeriodStart,
+		item.PeriodEnd,
+		item.ProductID,
+	).Scan(&item.ID, &item.CreatedAt)
+}
+
+// GetUnbilled returns the subscription's items that are not on a bill yet,
+// oldest first.
+func (r *PendingItemRepository) GetUnbilled(ctx context.Context, subscriptionID int) ([]*models.PendingItem, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT
+			id, subscription_id, kind, description, quantity, unit_amount, currency, period_start, period_end,
+			bill_id, product_id, created_at
+		FROM pending_items
+		WHERE subscription_id = $1 AND bill_id IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]*models.PendingItem, 0)
+	for rows.Next() {
+		var item models.PendingItem
+		if err := rows.Scan(
+			&item.ID,
+			&item.SubscriptionID,
+			&item.Kind,
+			&item.Description,
+			&item.Quantity,
+			&item.UnitAmount.Amount,
+			&item.UnitAmount.Currency,
+			&item.PeriodStart,
+			&item.PeriodEnd,
+			&item.BillID,
+			&item.ProductID,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// MarkBilled records that the items with the given IDs are on the bill.
+func (r *PendingItemRepository) MarkBilled(ctx context.Context, ids []int, billID int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE pending_items
+		SET bill_id = $1
+		WHERE id = ANY($2)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	itemIDs := make([]int64, len(ids))
+	for i, id := range ids {
+		itemIDs[i] = int64(id)
+	}
+
+	_, err = stmt.ExecContext(ctx, billID, pq.Array(itemIDs))
+	return err
+}
@@ -1,23 +1,63 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
+	"github.com/lib/pq"
+
 	"github.com/zaher1307/subscription-service/internal/models"
 )
 
+const productColumns = `
+	id, name, description, price, currency, billing_interval, billing_interval_count,
+	trial_days, dunning_schedule, tax_category, usage_type, add_on, usage_aggregation,
+	pricing_scheme, package_size, created_at
+`
+
+func scanProduct(row rowScanner) (*models.Product, error) {
+	var product models.Product
+	var usageAggregation sql.NullString
+	var packageSize sql.NullInt64
+	err := row.Scan(
+		&product.ID,
+		&product.Name,
+		&product.Description,
+		&product.Price.Amount,
+		&product.Price.Currency,
+		&product.BillingInterval,
+		&product.BillingIntervalCount,
+		&product.TrialDays,
+		&product.DunningSchedule,
+		&product.TaxCategory,
+		&product.UsageType,
+		&product.AddOn,
+		&usageAggregation,
+		&product.PricingScheme,
+		&packageSize,
+		&product.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	product.UsageAggregation = usageAggregation.String
+	product.PackageSize = int(packageSize.Int64)
+
+	return &product, nil
+}
+
 type ProductRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewProductRepository(db *sql.DB) *ProductRepository {
+func NewProductRepository(db DBTX) *ProductRepository {
 	return &ProductRepository{DB: db}
 }
 
-func (r *ProductRepository) GetAll() ([]*models.Product, error) {
-	stmt, err := r.DB.Prepare(`
-		SELECT id, name, description, price, created_at
+func (r *ProductRepository) GetAll(ctx context.Context) ([]*models.Product, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+productColumns+`
 		FROM products
 	`)
 	if err != nil {
@@ -25,7 +65,7 @@ func (r *ProductRepository) GetAll() ([]*models.Product, error) {
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query()
+	rows, err := stmt.QueryContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -33,19 +73,29 @@ func (r *ProductRepository) GetAll() ([]*models.Product, error) {
 
 	products := make([]*models.Product, 0)
 	for rows.Next() {
-		var product models.Product
-		if err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CreatedAt); err != nil {
+		product, err := scanProduct(rows)
+		if err != nil {
 			return nil, err
 		}
-		products = append(products, &product)
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadPrices(ctx, products); err != nil {
+		return nil, err
+	}
+	if err := r.loadTiers(ctx, products); err != nil {
+		return nil, err
 	}
 
 	return products, nil
 }
 
-func (r *ProductRepository) GetByID(id int) (*models.Product, error) {
-	stmt, err := r.DB.Prepare(`
-		SELECT id, name, description, price, created_at
+func (r *ProductRepository) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+productColumns+`
 		FROM products
 		WHERE id = $1
 	`)
@@ -54,8 +104,7 @@ func (r *ProductRepository) GetByID(id int) (*models.Product, error) {
 	}
 	defer stmt.Close()
 
-	var product models.Product
-	err = stmt.QueryRow(id).Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CreatedAt)
+	product, err := scanProduct(stmt.QueryRowContext(ctx, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("product %d not found", id)
@@ -63,5 +112,107 @@ func (r *ProductRepository) GetByID(id int) (*models.Product, error) {
 		return nil, err
 	}
 
-	return &product, nil
+	if err := r.loadPrices(ctx, []*models.Product{product}); err != nil {
+		return nil, err
+	}
+	if err := r.loadTiers(ctx, []*models.Product{product}); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// loadPrices fills in the products' prices in every currency they are sold
+// in, starting with their default price.
+func (r *ProductRepository) loadPrices(ctx context.Context, products []*models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Product, len(products))
+	ids := make([]int64, 0, len(products))
+	for _, product := range products {
+		product.Prices = []models.Money{product.Price}
+		byID[product.ID] = product
+		ids = append(ids, int64(product.ID))
+	}
+
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT product_id, amount, currency
+		FROM product_prices
+		WHERE product_id = ANY($1)
+		ORDER BY product_id, currency
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var price models.Money
+		if err := rows.Scan(&productID, &price.Amount, &price.Currency); err != nil {
+			return err
+		}
+		if product := byID[productID]; product != nil && price.Currency != product.Price.Currency {
+			product.Prices = append(product.Prices, price)
+		}
+	}
+
+	return rows.Err()
+}
+
+// loadTiers fills in the products' price tiers, lowest first in each
+// currency.
+func (r *ProductRepository) loadTiers(ctx context.Context, products []*models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	byID := make(map[int]*models.Product, len(products))
+	ids := make([]int64, 0, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+		ids = append(ids, int64(product.ID))
+	}
+
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT product_id, up_to, unit_amount, currency
+		FROM product_price_tiers
+		WHERE product_id = ANY($1)
+		ORDER BY product_id, currency, up_to NULLS LAST
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var upTo sql.NullInt64
+		var tier models.PriceTier
+		if err := rows.Scan(&productID, &upTo, &tier.UnitAmount.Amount, &tier.UnitAmount.Currency); err != nil {
+			return err
+		}
+		if upTo.Valid {
+			tier.UpTo = &upTo.Int64
+		}
+		if product := byID[productID]; product != nil {
+			product.Tiers = append(product.Tiers, tier)
+		}
+	}
+
+	return rows.Err()
 }
@@ -1,25 +1,105 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/zaher1307/subscription-service/internal/models"
 )
 
+const subscriptionColumns = `
+	id, user_id, product_id, currency, pending_product_id, billing_anchor, start_date, next_billing_date, status,
+	trial_ends_at, cancel_at_period_end, cancelled_at, cancellation_reason, paused_at, resume_at,
+	auto_collect, coupon_id, coupon_cycles_left, quantity, created_at
+`
+
+// subscriptionsPerProductIndex keeps a user to one subscription per product
+// that has not been cancelled.
+const subscriptionsPerProductIndex = "subscriptions_one_per_product"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscription(row rowScanner) (*models.Subscription, error) {
+	var subscription models.Subscription
+	var cancellationReason sql.NullString
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.UserID,
+		&subscription.ProductID,
+		&subscription.Currency,
+		&subscription.PendingProductID,
+		&subscription.BillingAnchor,
+		&subscription.StartDate,
+		&subscription.NextBillingDate,
+		&subscription.Status,
+		&subscription.TrialEndsAt,
+		&subscription.CancelAtPeriodEnd,
+		&subscription.CancelledAt,
+		&cancellationReason,
+		&subscription.PausedAt,
+		&subscription.ResumeAt,
+		&subscription.AutoCollect,
+		&subscription.CouponID,
+		&subscription.CouponCyclesLeft,
+		&subscription.Quantity,
+		&subscription.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	subscription.CancellationReason = cancellationReason.String
+
+	return &subscription, nil
+}
+
 type SubscriptionRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewSubscriptionRepository(db *sql.DB) *SubscriptionRepository {
+func NewSubscriptionRepository(db DBTX) *SubscriptionRepository {
 	return &SubscriptionRepository{DB: db}
 }
 
-func (r *SubscriptionRepository) Create(subscription *models.Subscription) error {
-	stmt, err := r.DB.Prepare(`
-		INSERT INTO subscriptions (user_id, product_id, start_date, next_billing_date, status)
-		VALUES ($1, $2, $3, $4, $5)
+func (r *SubscriptionRepository) querySubscriptions(ctx context.Context, query string, args ...any) ([]*models.Subscription, error) {
+	stmt, err := r.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := make([]*models.Subscription, 0)
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (r *SubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO subscriptions (
+			user_id, product_id, currency, billing_anchor, start_date, next_billing_date, status, trial_ends_at,
+			auto_collect, coupon_id, coupon_cycles_left, quantity
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 		RETURNING id, created_at
 	`)
 	if err != nil {
@@ -27,18 +107,39 @@ func (r *SubscriptionRepository) Create(subscription *models.Subscription) error
 	}
 	defer stmt.Close()
 
-	return stmt.QueryRow(
+	err = stmt.QueryRowContext(
+		ctx,
 		subscription.UserID,
 		subscription.ProductID,
+		subscription.Currency,
+		subscription.BillingAnchor,
 		subscription.StartDate,
 		subscription.NextBillingDate,
 		subscription.Status,
+		subscription.TrialEndsAt,
+		subscription.AutoCollect,
+		subscription.CouponID,
+		subscription.CouponCyclesLeft,
+		subscription.Quantity,
 	).Scan(&subscription.ID, &subscription.CreatedAt)
+	return subscriptionExists(err)
 }
 
-func (r *SubscriptionRepository) GetByID(id int) (*models.Subscription, error) {
-	stmt, err := r.DB.Prepare(`
-		SELECT id, user_id, product_id, start_date, next_billing_date, status, created_at
+// subscriptionExists reports a write that would give a user a second
+// subscription to a product as models.ErrSubscriptionExists. Concurrent
+// requests can both pass the check made beforehand, so the index is what
+// finally stops the second one.
+func subscriptionExists(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Constraint == subscriptionsPerProductIndex {
+		return models.ErrSubscriptionExists
+	}
+	return err
+}
+
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id int) (*models.Subscription, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+subscriptionColumns+`
 		FROM subscriptions
 		WHERE id = $1
 	`)
@@ -47,16 +148,7 @@ func (r *SubscriptionRepository) GetByID(id int) (*models.Subscription, error) {
 	}
 	defer stmt.Close()
 
-	var subscription models.Subscription
-	err = stmt.QueryRow(id).Scan(
-		&subscription.ID,
-		&subscription.UserID,
-		&subscription.ProductID,
-		&subscription.StartDate,
-		&subscription.NextBillingDate,
-		&subscription.Status,
-		&subscription.CreatedAt,
-	)
+	subscription, err := scanSubscription(stmt.QueryRowContext(ctx, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("subscription %d not found", id)
@@ -64,48 +156,96 @@ func (r *SubscriptionRepository) GetByID(id int) (*models.Subscription, error) {
 		return nil, err
 	}
 
-	return &subscription, nil
+	return subscription, nil
 }
 
-func (r *SubscriptionRepository) GetDueForBilling(date time.Time) ([]*models.Subscription, error) {
-	stmt, err := r.DB.Prepare(`
-		SELECT id, user_id, product_id, start_date, next_billing_date, status, created_at
+// LockByID reads a subscription and locks it for the rest of the
+// transaction, so that billing and other changes to it wait their turn.
+func (r *SubscriptionRepository) LockByID(ctx context.Context, id int) (*models.Subscription, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+subscriptionColumns+`
 		FROM subscriptions
-		WHERE status = 'active' AND next_billing_date <= $1
+		WHERE id = $1
+		FOR UPDATE
 	`)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(date)
+	subscription, err := scanSubscription(stmt.QueryRowContext(ctx, id))
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("subscription %d not found", id)
+		}
 		return nil, err
 	}
-	defer rows.Close()
 
-	subscriptions := make([]*models.Subscription, 0)
-	for rows.Next() {
-		var subscription models.Subscription
-		if err := rows.Scan(
-			&subscription.ID,
-			&subscription.UserID,
-			&subscription.ProductID,
-			&subscription.StartDate,
-			&subscription.NextBillingDate,
-			&subscription.Status,
-			&subscription.CreatedAt,
-		); err != nil {
-			return nil, err
+	return subscription, nil
+}
+
+// ShareLockByID reads a subscription and keeps it from being changed, such
+// as by billing, for the rest of the transaction, while still letting other
+// transactions read it the same way.
+func (r *SubscriptionRepository) ShareLockByID(ctx context.Context, id int) (*models.Subscription, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE id = $1
+		FOR SHARE
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	subscription, err := scanSubscription(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("subscription %d not found", id)
 		}
-		subscriptions = append(subscriptions, &subscription)
+		return nil, err
 	}
 
-	return subscriptions, nil
+	return subscription, nil
 }
 
-func (r *SubscriptionRepository) UpdateStartDate(id int, nextDate time.Time) error {
-	stmt, err := r.DB.Prepare(`
+func (r *SubscriptionRepository) GetDueForBilling(ctx context.Context, date time.Time) ([]*models.Subscription, error) {
+	return r.querySubscriptions(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE status IN ('active', 'trialing') AND next_billing_date <= $1
+	`, date)
+}
+
+// LockDueForBilling re-reads a subscription and locks it for the rest of the
+// transaction, provided it is still due for billing by date. It returns nil
+// when the subscription has since been cancelled, paused, billed or moved on.
+func (r *SubscriptionRepository) LockDueForBilling(ctx context.Context, id int, date time.Time) (*models.Subscription, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE id = $1 AND status IN ('active', 'trialing') AND next_billing_date <= $2
+		FOR UPDATE
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	subscription, err := scanSubscription(stmt.QueryRowContext(ctx, id, date))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (r *SubscriptionRepository) UpdateStartDate(ctx context.Context, id int, nextDate time.Time) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
 		UPDATE subscriptions
 		SET start_date = $1
 		WHERE id = $2
@@ -115,12 +255,27 @@ func (r *SubscriptionRepository) UpdateStartDate(id int, nextDate time.Time) err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(nextDate, id)
+	_, err = stmt.ExecContext(ctx, nextDate, id)
+	return err
+}
+
+func (r *SubscriptionRepository) UpdateBillingAnchor(ctx context.Context, id int, anchor time.Time) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET billing_anchor = $1
+		WHERE id = $2
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, anchor, id)
 	return err
 }
 
-func (r *SubscriptionRepository) UpdateNextBillingDate(id int, nextDate time.Time) error {
-	stmt, err := r.DB.Prepare(`
+func (r *SubscriptionRepository) UpdateNextBillingDate(ctx context.Context, id int, nextDate time.Time) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
 		UPDATE subscriptions
 		SET next_billing_date = $1
 		WHERE id = $2
@@ -130,12 +285,12 @@ func (r *SubscriptionRepository) UpdateNextBillingDate(id int, nextDate time.Tim
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(nextDate, id)
+	_, err = stmt.ExecContext(ctx, nextDate, id)
 	return err
 }
 
-func (r *SubscriptionRepository) HoldSubscription(id int) error {
-	stmt, err := r.DB.Prepare(`
+func (r *SubscriptionRepository) HoldSubscription(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
 		UPDATE subscriptions
 		SET status = 'hold'
 		WHERE id = $1
@@ -145,12 +300,12 @@ func (r *SubscriptionRepository) HoldSubscription(id int) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id)
+	_, err = stmt.ExecContext(ctx, id)
 	return err
 }
 
-func (r *SubscriptionRepository) ActivateSubscription(id int) error {
-	stmt, err := r.DB.Prepare(`
+func (r *SubscriptionRepository) ActivateSubscription(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
 		UPDATE subscriptions
 		SET status = 'active'
 		WHERE id = $1
@@ -160,31 +315,186 @@ func (r *SubscriptionRepository) ActivateSubscription(id int) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id)
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
+
+func (r *SubscriptionRepository) MarkPastDue(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET status = 'past_due'
+		WHERE id = $1
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
+
+func (r *SubscriptionRepository) MarkUnpaid(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET status = 'unpaid'
+		WHERE id = $1
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
+
+func (r *SubscriptionRepository) ScheduleCancellation(ctx context.Context, id int, reason string) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET cancel_at_period_end = TRUE, cancellation_reason = $1
+		WHERE id = $2
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, reason, id)
+	return err
+}
+
+func (r *SubscriptionRepository) Cancel(ctx context.Context, id int, cancelledAt time.Time, reason string) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET status = 'cancelled', cancel_at_period_end = FALSE, cancelled_at = $1, cancellation_reason = $2
+		WHERE id = $3
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, cancelledAt, reason, id)
 	return err
 }
 
-func (r *SubscriptionRepository) GetActiveByUserAndProduct(userID, productID int) (*models.Subscription, error) {
-	stmt, err := r.DB.Prepare(`
-        SELECT id, user_id, product_id, start_date, next_billing_date, status, created_at
+func (r *SubscriptionRepository) GetDueForResume(ctx context.Context, date time.Time) ([]*models.Subscription, error) {
+	return r.querySubscriptions(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE status = 'paused' AND resume_at <= $1
+	`, date)
+}
+
+func (r *SubscriptionRepository) Pause(ctx context.Context, id int, pausedAt time.Time, resumeAt *time.Time) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET status = 'paused', paused_at = $1, resume_at = $2
+		WHERE id = $3
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, pausedAt, resumeAt, id)
+	return err
+}
+
+func (r *SubscriptionRepository) Resume(ctx context.Context, id int, billingAnchor, startDate, nextBillingDate time.Time) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET status = 'active', paused_at = NULL, resume_at = NULL,
+			billing_anchor = $1, start_date = $2, next_billing_date = $3
+		WHERE id = $4
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, billingAnchor, startDate, nextBillingDate, id)
+	return err
+}
+
+func (r *SubscriptionRepository) ChangeProduct(ctx context.Context, id, productID int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET product_id = $1, pending_product_id = NULL
+		WHERE id = $2
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, productID, id)
+	return subscriptionExists(err)
+}
+
+func (r *SubscriptionRepository) SchedulePlanChange(ctx context.Context, id int, productID *int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET pending_product_id = $1
+		WHERE id = $2
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, productID, id)
+	return err
+}
+
+// UseCouponCycle counts one discounted bill against the subscription's
+// coupon. Coupons that last forever have no cycles to count.
+func (r *SubscriptionRepository) UseCouponCycle(ctx context.Context, id int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET coupon_cycles_left = coupon_cycles_left - 1
+		WHERE id = $1 AND coupon_cycles_left > 0
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, id)
+	return err
+}
+
+func (r *SubscriptionRepository) UpdateQuantity(ctx context.Context, id, quantity int) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE subscriptions
+		SET quantity = $1
+		WHERE id = $2
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, quantity, id)
+	return err
+}
+
+// GetActiveByUserAndProduct returns the user's subscription to the product
+// that has not been cancelled, if any. Paused subscriptions and ones held
+// for an unpaid bill count too, since they can still become active again.
+func (r *SubscriptionRepository) GetActiveByUserAndProduct(ctx context.Context, userID, productID int) (*models.Subscription, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+        SELECT `+subscriptionColumns+`
         FROM subscriptions
-        WHERE user_id = $1 AND product_id = $2 AND status = 'active'
+        WHERE user_id = $1 AND product_id = $2 AND status <> 'cancelled'
     `)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	var subscription models.Subscription
-	err = stmt.QueryRow(userID, productID).Scan(
-		&subscription.ID,
-		&subscription.UserID,
-		&subscription.ProductID,
-		&subscription.StartDate,
-		&subscription.NextBillingDate,
-		&subscription.Status,
-		&subscription.CreatedAt,
-	)
+	subscription, err := scanSubscription(stmt.QueryRowContext(ctx, userID, productID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -192,5 +502,25 @@ func (r *SubscriptionRepository) GetActiveByUserAndProduct(userID, productID int
 		return nil, err
 	}
 
-	return &subscription, nil
+	return subscription, nil
+}
+
+// HasUsedTrial reports whether the user has ever started a trial of the
+// product, whatever became of that subscription since.
+func (r *SubscriptionRepository) HasUsedTrial(ctx context.Context, userID, productID int) (bool, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM subscriptions
+			WHERE user_id = $1 AND product_id = $2 AND trial_ends_at IS NOT NULL
+		)
+	`)
+	if err != nil {
+		return false, err
+	}
+	defer stmt.Close()
+
+	var used bool
+	err = stmt.QueryRowContext(ctx, userID, productID).Scan(&used)
+	return used, err
 }
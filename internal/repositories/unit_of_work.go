@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, which lets the same
+// repository run either on its own or inside a unit of work.
+type DBTX interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// Repositories groups the repositories that take part in a unit of work.
+type Repositories struct {
+	Subscriptions  ISubscriptionRepository
+	Products       IProductRepository
+	Bills          IBillRepository
+	Users          IUserRepository
+	Dunning        IDunningRepository
+	Payments       IPaymentAttemptRepository
+	PaymentMethods IPaymentMethodRepository
+	CreditNotes    ICreditNoteRepository
+	Balance        IBalanceRepository
+	Coupons        ICouponRepository
+	PendingItems   IPendingItemRepository
+	Usage          IUsageRepository
+	AddOns         IAddOnRepository
+	BillingRuns    IBillingRunRepository
+}
+
+func NewRepositories(db DBTX) *Repositories {
+	return &Repositories{
+		Subscriptions:  NewSubscriptionRepository(db),
+		Products:       NewProductRepository(db),
+		Bills:          NewBillRepository(db),
+		Users:          NewUserRepository(db),
+		Dunning:        NewDunningRepository(db),
+		Payments:       NewPaymentAttemptRepository(db),
+		PaymentMethods: NewPaymentMethodRepository(db),
+		CreditNotes:    NewCreditNoteRepository(db),
+		Balance:        NewBalanceRepository(db),
+		Coupons:        NewCouponRepository(db),
+		PendingItems:   NewPendingItemRepository(db),
+		Usage:          NewUsageRepository(db),
+		AddOns:         NewAddOnRepository(db),
+		BillingRuns:    NewBillingRunRepository(db),
+	}
+}
+
+type UnitOfWork struct {
+	DB *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+	return &UnitOfWork{DB: db}
+}
+
+// Do runs fn inside a single database transaction bound to ctx. The
+// transaction is committed when fn returns nil and rolled back when it
+// returns an error, panics or ctx is cancelled.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repos *Repositories) error) error {
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(NewRepositories(tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
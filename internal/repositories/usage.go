@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+const usageRecordColumns = `id, subscription_id, idempotency_key, quantity, timestamp, created_at`
+
+func scanUsageRecord(row rowScanner) (*models.UsageRecord, error) {
+	var record models.UsageRecord
+	err := row.Scan(
+		&record.ID,
+		&record.SubscriptionID,
+		&record.IdempotencyKey,
+		&record.Quantity,
+		&record.Timestamp,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+type UsageRepository struct {
+	DB DBTX
+}
+
+func NewUsageRepository(db DBTX) *UsageRepository {
+	return &UsageRepository{DB: db}
+}
+
+// Create saves a usage record unless the subscription already has one with
+// the same idempotency key, in which case that one is returned and created
+// is false.
+func (r *UsageRepository) Create(ctx context.Context, record *models.UsageRecord) (*models.UsageRecord, bool, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO usage_records (subscription_id, idempotency_key, quantity, timestamp)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (subscription_id, idempotency_key) DO NOTHING
+		RETURNING `+usageRecordColumns+`
+	`)
+	if err != nil {
+		return nil, false, err
+	}
+	defer stmt.Close()
+
+	created, err := scanUsageRecord(stmt.QueryRowContext(ctx, record.SubscriptionID, record.IdempotencyKey, record.Quantity, record.Timestamp))
+	if err == nil {
+		return created, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, err
+	}
+
+	existing, err := r.getByKey(ctx, record.SubscriptionID, record.IdempotencyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+func (r *UsageRepository) getByKey(ctx context.Context, subscriptionID int, key string) (*models.UsageRecord, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+usageRecordColumns+`
+		FROM usage_records
+		WHERE subscription_id = $1 AND idempotency_key = $2
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	record, err := scanUsageRecord(stmt.QueryRowContext(ctx, subscriptionID, key))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("usage record %q not found", key)
+		}
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// GetForPeriod returns the subscription's usage records timestamped within
+// [from, to), oldest first.
+func (r *UsageRepository) GetForPeriod(ctx context.Context, subscriptionID int, from, to time.Time) ([]*models.UsageRecord, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT `+usageRecordColumns+`
+		FROM usage_records
+		WHERE subscription_id = $1 AND timestamp >= $2 AND timestamp < $3
+		ORDER BY timestamp, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, subscriptionID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]*models.UsageRecord, 0)
+	for rows.Next() {
+		record, err := scanUsageRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// Aggregate combines the subscription's usage within [from, to) into a
+// single quantity, which is 0 when nothing was reported.
+func (r *UsageRepository) Aggregate(ctx context.Context, subscriptionID int, aggregation string, from, to time.Time) (int64, error) {
+	var query string
+	switch aggregation {
+	case models.UsageAggregationSum, "":
+		query = `
+			SELECT COALESCE(SUM(quantity), 0)
+			FROM usage_records
+			WHERE subscription_id = $1 AND timestamp >= $2 AND timestamp < $3
+		`
+	case models.UsageAggregationMax:
+		query = `
+			SELECT COALESCE(MAX(quantity), 0)
+			FROM usage_records
+			WHERE subscription_id = $1 AND timestamp >= $2 AND timestamp < $3
+		`
+	case models.UsageAggregationLast:
+		query = `
+			SELECT COALESCE((
+				SELECT quantity
+				FROM usage_records
+				WHERE subscription_id = $1 AND timestamp >= $2 AND timestamp < $3
+				ORDER BY timestamp DESC, id DESC
+				LIMIT 1
+			), 0)
+		`
+	default:
+		return 0, fmt.Errorf("unknown usage aggregation %q", aggregation)
+	}
+
+	stmt, err := r.DB.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var quantity int64
+	err = stmt.QueryRowContext(ctx, subscriptionID, from, to).Scan(&quantity)
+	return quantity, err
+}
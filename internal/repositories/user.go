@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -8,17 +9,20 @@ import (
 )
 
 type UserRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
+func NewUserRepository(db DBTX) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
-func (r *UserRepository) Create(user *models.User) error {
-	stmt, err := r.DB.Prepare(`
-		INSERT INTO users (name, email)
-		VALUES ($1, $2)
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		INSERT INTO users (
+			name, email, currency, billing_line1, billing_line2, billing_city, billing_region,
+			billing_postal_code, billing_country, tax_id
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at
 	`)
 	if err != nil {
@@ -26,14 +30,18 @@ func (r *UserRepository) Create(user *models.User) error {
 	}
 	defer stmt.Close()
 
-	return stmt.QueryRow(user.Name, user.Email).Scan(&user.ID, &user.CreatedAt)
+	args := append([]any{user.Name, user.Email, nullString(user.Currency)}, billingDetailsArgs(user)...)
+	return stmt.QueryRowContext(ctx, args...).Scan(&user.ID, &user.CreatedAt)
 }
 
-func (r *UserRepository) GetByID(id int) (*models.User, error) {
-	stmt, err := r.DB.Prepare(`
-		SELECT id, name, email, created_at
-		FROM users
-		WHERE id = $1
+func (r *UserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		SELECT
+			u.id, u.name, u.email, u.currency, pm.id, u.billing_line1, u.billing_line2, u.billing_city, u.billing_region,
+			u.billing_postal_code, u.billing_country, u.tax_id, u.created_at
+		FROM users u
+		LEFT JOIN payment_methods pm ON pm.user_id = u.id AND pm.is_default
+		WHERE u.id = $1
 	`)
 	if err != nil {
 		return nil, err
@@ -41,10 +49,20 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 	defer stmt.Close()
 
 	var user models.User
-	err = stmt.QueryRow(id).Scan(
+	var currency, line1, line2, city, region, postalCode, country, taxID sql.NullString
+	err = stmt.QueryRowContext(ctx, id).Scan(
 		&user.ID,
 		&user.Name,
 		&user.Email,
+		&currency,
+		&user.DefaultPaymentMethodID,
+		&line1,
+		&line2,
+		&city,
+		&region,
+		&postalCode,
+		&country,
+		&taxID,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -54,5 +72,70 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 		return nil, err
 	}
 
+	if country.Valid {
+		user.BillingAddress = &models.Address{
+			Line1:      line1.String,
+			Line2:      line2.String,
+			City:       city.String,
+			Region:     region.String,
+			PostalCode: postalCode.String,
+			Country:    country.String,
+		}
+	}
+	user.TaxID = taxID.String
+	user.Currency = currency.String
+
 	return &user, nil
 }
+
+// UpdateBillingDetails replaces the user's billing address and tax ID.
+func (r *UserRepository) UpdateBillingDetails(ctx context.Context, user *models.User) error {
+	stmt, err := r.DB.PrepareContext(ctx, `
+		UPDATE users
+		SET billing_line1 = $1, billing_line2 = $2, billing_city = $3, billing_region = $4,
+			billing_postal_code = $5, billing_country = $6, tax_id = $7
+		WHERE id = $8
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(ctx, append(billingDetailsArgs(user), user.ID)...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("user %d not found", user.ID)
+	}
+
+	return nil
+}
+
+// billingDetailsArgs returns the user's billing address columns followed by
+// their tax ID, with NULL for whatever is missing.
+func billingDetailsArgs(user *models.User) []any {
+	var address models.Address
+	if user.BillingAddress != nil {
+		address = *user.BillingAddress
+	}
+
+	return []any{
+		nullString(address.Line1),
+		nullString(address.Line2),
+		nullString(address.City),
+		nullString(address.Region),
+		nullString(address.PostalCode),
+		nullString(address.Country),
+		nullString(user.TaxID),
+	}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
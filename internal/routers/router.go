@@ -2,54 +2,94 @@ package router
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 
 	"github.com/zaher1307/subscription-service/internal/handlers"
+	"github.com/zaher1307/subscription-service/internal/middleware"
+	"github.com/zaher1307/subscription-service/internal/payments"
 	"github.com/zaher1307/subscription-service/internal/repositories"
 	"github.com/zaher1307/subscription-service/internal/services"
+	"github.com/zaher1307/subscription-service/internal/tax"
 )
 
-func SetupRouter(db *sql.DB, redis *redis.Client) *gin.Engine {
+func SetupRouter(db *sql.DB, redis *redis.Client, timeouts middleware.Timeouts, paymentProvider payments.PaymentProvider, taxes *tax.Table, billingService services.IBillingService, billingRunService services.IBillingRunService, billingRunTimeout time.Duration) *gin.Engine {
 	r := gin.Default()
 
 	userRepo := repositories.NewUserRepository(db)
 	productRepo := repositories.NewProductRepository(db)
 	subscriptionRepo := repositories.NewSubscriptionRepository(db)
 	billRepo := repositories.NewBillRepository(db)
+	uow := repositories.NewUnitOfWork(db)
 
-	subscriptionService := services.NewSubscriptionService(subscriptionRepo, productRepo, billRepo, userRepo)
-	billingService := services.NewBillingService(subscriptionRepo, productRepo, billRepo, userRepo)
+	subscriptionService := services.NewSubscriptionService(subscriptionRepo, productRepo, billRepo, userRepo, uow, taxes)
 	userService := services.NewUserService(userRepo)
 	productService := services.NewProductService(productRepo)
+	paymentMethodService := services.NewPaymentMethodService(uow, paymentProvider)
+	balanceService := services.NewBalanceService(uow)
+	couponService := services.NewCouponService(uow)
+	usageService := services.NewUsageService(uow)
+	addOnService := services.NewAddOnService(uow)
 
 	userHandler := handlers.NewUserHandler(userService)
 	productHandler := handlers.NewProductHandler(productService)
 	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
 	billHandler := handlers.NewBillHandler(billingService)
+	paymentMethodHandler := handlers.NewPaymentMethodHandler(paymentMethodService)
+	balanceHandler := handlers.NewBalanceHandler(balanceService)
+	couponHandler := handlers.NewCouponHandler(couponService)
+	usageHandler := handlers.NewUsageHandler(usageService)
+	addOnHandler := handlers.NewAddOnHandler(addOnService)
+	billingRunHandler := handlers.NewBillingRunHandler(billingRunService, billingRunTimeout)
 	healthHandler := handlers.NewHealthHandler(db, redis)
 
 	r.GET("/health", healthHandler.Check)
 
 	api := r.Group("/api")
+	api.Use(middleware.Timeout(timeouts))
 	{
 		users := api.Group("/users")
 		{
 			users.POST("", userHandler.Create)
 			users.GET("/:id", userHandler.GetByID)
+			users.PUT("/:id/billing-details", userHandler.UpdateBillingDetails)
+			users.POST("/:id/payment-methods", paymentMethodHandler.Add)
+			users.GET("/:id/payment-methods", paymentMethodHandler.List)
+			users.POST("/:id/payment-methods/:method_id/default", paymentMethodHandler.SetDefault)
+			users.DELETE("/:id/payment-methods/:method_id", paymentMethodHandler.Remove)
+			users.GET("/:id/balance", balanceHandler.Get)
+			users.POST("/:id/balance/credits", balanceHandler.AddCredit)
 		}
 
 		products := api.Group("/products")
 		{
 			products.GET("", productHandler.GetAll)
 			products.GET("/:id", productHandler.GetByID)
+			products.GET("/:id/price", productHandler.GetPrice)
+		}
+
+		coupons := api.Group("/coupons")
+		{
+			coupons.POST("", couponHandler.Create)
+			coupons.GET("/:code", couponHandler.GetByCode)
 		}
 
 		subscriptions := api.Group("/subscriptions")
 		{
 			subscriptions.POST("", subscriptionHandler.Create)
 			subscriptions.GET("/:id", subscriptionHandler.GetByID)
+			subscriptions.POST("/:id/cancel", subscriptionHandler.Cancel)
+			subscriptions.POST("/:id/pause", subscriptionHandler.Pause)
+			subscriptions.POST("/:id/resume", subscriptionHandler.Resume)
+			subscriptions.POST("/:id/change-plan", subscriptionHandler.ChangePlan)
+			subscriptions.PUT("/:id/quantity", subscriptionHandler.ChangeQuantity)
+			subscriptions.POST("/:id/usage", usageHandler.Record)
+			subscriptions.GET("/:id/usage", usageHandler.Get)
+			subscriptions.GET("/:id/add-ons", addOnHandler.List)
+			subscriptions.POST("/:id/add-ons", addOnHandler.Add)
+			subscriptions.DELETE("/:id/add-ons/:add_on_id", addOnHandler.Remove)
 		}
 
 		bills := api.Group("/bills")
@@ -57,6 +97,14 @@ func SetupRouter(db *sql.DB, redis *redis.Client) *gin.Engine {
 			bills.GET("/user/:user_id", billHandler.GetUserBills)
 			bills.GET("/:id", billHandler.GetBill)
 			bills.POST("/:id/pay", billHandler.PayBill)
+			bills.POST("/:id/refunds", billHandler.Refund)
+		}
+
+		admin := api.Group("/admin")
+		{
+			admin.GET("/billing-runs", billingRunHandler.List)
+			admin.POST("/billing-runs", billingRunHandler.Trigger)
+			admin.GET("/billing-runs/:id", billingRunHandler.GetByID)
 		}
 	}
 
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+type AddOnService struct {
+	uow repositories.IUnitOfWork
+}
+
+func NewAddOnService(uow repositories.IUnitOfWork) *AddOnService {
+	return &AddOnService{uow: uow}
+}
+
+// AddAddOn attaches quantity units of an add-on product to a subscription.
+// On an active subscription the prorated price for the rest of the current
+// period is returned as a pending item, charged on the next bill.
+func (s *AddOnService) AddAddOn(ctx context.Context, subscriptionID, productID, quantity int) (*models.SubscriptionAddOn, *models.PendingItem, error) {
+	if quantity < 1 {
+		return nil, nil, errors.New("quantity must be at least 1")
+	}
+
+	var addOn *models.SubscriptionAddOn
+	var charge *models.PendingItem
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		subscription, product, err := addOnSubscription(ctx, repos, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		addOnProduct, err := repos.Products.GetByID(ctx, productID)
+		if err != nil {
+			return err
+		}
+		if !addOnProduct.AddOn || addOnProduct.IsMetered() {
+			return fmt.Errorf("product %d is not an add-on", productID)
+		}
+		if addOnProduct.BillingInterval != product.BillingInterval || addOnProduct.BillingIntervalCount != product.BillingIntervalCount {
+			return fmt.Errorf("add-on %d is not billed on the subscription's cycle", productID)
+		}
+
+		existing, err := repos.AddOns.GetBySubscriptionID(ctx, subscription.ID)
+		if err != nil {
+			return err
+		}
+		for _, a := range existing {
+			if a.ProductID == productID {
+				return errors.New("subscription already has this add-on")
+			}
+		}
+
+		now := time.Now()
+		remaining, units, err := remainingPeriodPrice(subscription, addOnProduct, quantity, now)
+		if err != nil {
+			return err
+		}
+
+		addOn = &models.SubscriptionAddOn{
+			SubscriptionID: subscription.ID,
+			ProductID:      productID,
+			Quantity:       quantity,
+		}
+		if err := repos.AddOns.Create(ctx, addOn); err != nil {
+			return err
+		}
+
+		if subscription.Status == models.SubscriptionStatusActive && !remaining.IsZero() {
+			periodEnd := subscription.NextBillingDate
+			charge = &models.PendingItem{
+				SubscriptionID: subscription.ID,
+				Kind:           models.BillItemKindProration,
+				Description:    "Remaining time on " + addOnProduct.Name,
+				Quantity:       units,
+				UnitAmount:     remaining,
+				PeriodStart:    &now,
+				PeriodEnd:      &periodEnd,
+				ProductID:      &addOnProduct.ID,
+			}
+			if err := repos.PendingItems.Create(ctx, charge); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return addOn, charge, nil
+}
+
+// ListAddOns returns the add-ons attached to a subscription.
+func (s *AddOnService) ListAddOns(ctx context.Context, subscriptionID int) ([]*models.SubscriptionAddOn, error) {
+	var addOns []*models.SubscriptionAddOn
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if _, err := repos.Subscriptions.GetByID(ctx, subscriptionID); err != nil {
+			return err
+		}
+
+		var err error
+		addOns, err = repos.AddOns.GetBySubscriptionID(ctx, subscriptionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return addOns, nil
+}
+
+// RemoveAddOn detaches an add-on from a subscription. On an active
+// subscription the unused part of the current period is returned as a
+// pending item, credited on the next bill.
+func (s *AddOnService) RemoveAddOn(ctx context.Context, subscriptionID, addOnID int) (*models.PendingItem, error) {
+	var credit *models.PendingItem
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		subscription, _, err := addOnSubscription(ctx, repos, subscriptionID)
+		if err != nil {
+			return err
+		}
+
+		addOn, err := repos.AddOns.GetByID(ctx, addOnID)
+		if err != nil {
+			return err
+		}
+		if addOn.SubscriptionID != subscription.ID {
+			return fmt.Errorf("add-on %d not found", addOnID)
+		}
+
+		addOnProduct, err := repos.Products.GetByID(ctx, addOn.ProductID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		unused, units, err := remainingPeriodPrice(subscription, addOnProduct, addOn.Quantity, now)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.AddOns.Delete(ctx, addOn.ID); err != nil {
+			return err
+		}
+
+		if subscription.Status == models.SubscriptionStatusActive && !unused.IsZero() {
+			periodEnd := subscription.NextBillingDate
+			credit = &models.PendingItem{
+				SubscriptionID: subscription.ID,
+				Kind:           models.BillItemKindProration,
+				Description:    "Unused time on " + addOnProduct.Name,
+				Quantity:       units,
+				UnitAmount:     unused.Neg(),
+				PeriodStart:    &now,
+				PeriodEnd:      &periodEnd,
+				ProductID:      &addOnProduct.ID,
+			}
+			if err := repos.PendingItems.Create(ctx, credit); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return credit, nil
+}
+
+// addOnSubscription loads a subscription whose add-ons can be changed,
+// together with its product.
+func addOnSubscription(ctx context.Context, repos *repositories.Repositories, id int) (*models.Subscription, *models.Product, error) {
+	subscription, err := repos.Subscriptions.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subscription.Status != models.SubscriptionStatusActive && subscription.Status != models.SubscriptionStatusTrialing {
+		return nil, nil, fmt.Errorf("only active or trialing subscriptions can change add-ons, subscription is %s", subscription.Status)
+	}
+
+	product, err := repos.Products.GetByID(ctx, subscription.ProductID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if product.IsMetered() {
+		return nil, nil, errors.New("add-ons are not available for metered subscriptions")
+	}
+
+	return subscription, product, nil
+}
+
+// remainingPeriodPrice returns the share of quantity units of product's
+// price that covers the rest of the subscription's current period, as a
+// unit amount and a number of units.
+func remainingPeriodPrice(subscription *models.Subscription, product *models.Product, quantity int, now time.Time) (models.Money, int, error) {
+	price, units, err := periodPrice(product, subscription.Currency, quantity)
+	if err != nil {
+		return models.Money{}, 0, err
+	}
+	return prorate(price, subscription.StartDate, subscription.NextBillingDate, now), units, nil
+}
+
+// addOnItems prices the subscription's add-ons for the period [from, to),
+// each on bill lines of its own.
+func addOnItems(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, from, to time.Time) ([]*models.BillItem, error) {
+	addOns, err := repos.AddOns.GetBySubscriptionID(ctx, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*models.BillItem
+	for _, addOn := range addOns {
+		product, err := repos.Products.GetByID(ctx, addOn.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		lines, err := priceLines(product, product.Name, subscription.Currency, int64(addOn.Quantity))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, billItems(models.BillItemKindAddOn, product.ID, lines, from, to)...)
+	}
+
+	return items, nil
+}
+
+// addOnCredits credits the unused part of the current period of each of
+// the subscription's add-ons.
+func addOnCredits(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, now time.Time) ([]*models.BillItem, error) {
+	addOns, err := repos.AddOns.GetBySubscriptionID(ctx, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*models.BillItem
+	for _, addOn := range addOns {
+		product, err := repos.Products.GetByID(ctx, addOn.ProductID)
+		if err != nil {
+			return nil, err
+		}
+
+		unused, units, err := remainingPeriodPrice(subscription, product, addOn.Quantity, now)
+		if err != nil {
+			return nil, err
+		}
+		if unused.Amount > 0 {
+			items = append(items, prorationItem("Unused time on "+product.Name, product.ID, unused.Neg(), units, now, subscription.NextBillingDate))
+		}
+	}
+
+	return items, nil
+}
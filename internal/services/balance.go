@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+type BalanceService struct {
+	uow repositories.IUnitOfWork
+}
+
+func NewBalanceService(uow repositories.IUnitOfWork) *BalanceService {
+	return &BalanceService{uow: uow}
+}
+
+// GetBalance returns the user's balance per currency together with the
+// ledger entries that make it up.
+func (s *BalanceService) GetBalance(ctx context.Context, userID int) ([]models.Money, []*models.BalanceEntry, error) {
+	var balances []models.Money
+	var entries []*models.BalanceEntry
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if _, err := repos.Users.GetByID(ctx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		balances, err = repos.Balance.GetBalances(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		entries, err = repos.Balance.GetByUserID(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return balances, entries, nil
+}
+
+// AddCredit grants the user account credit, e.g. as a goodwill gesture. It
+// is used up by their next bills in the same currency.
+func (s *BalanceService) AddCredit(ctx context.Context, userID int, amount models.Money, reason string) (*models.BalanceEntry, error) {
+	if amount.Amount <= 0 {
+		return nil, errors.New("credit amount must be positive")
+	}
+	if amount.Currency == "" {
+		return nil, errors.New("credit currency is required")
+	}
+	if reason == "" {
+		return nil, errors.New("reason is required")
+	}
+
+	entry := &models.BalanceEntry{
+		UserID: userID,
+		Amount: models.NewMoney(amount.Amount, amount.Currency),
+		Reason: reason,
+	}
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if _, err := repos.Users.GetByID(ctx, userID); err != nil {
+			return err
+		}
+
+		return repos.Balance.Create(ctx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// creditBalance adds a credit bill to the user's balance so that it is
+// used up by their later bills.
+func creditBalance(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, credit *models.Bill) error {
+	return repos.Balance.Create(ctx, &models.BalanceEntry{
+		UserID:         subscription.UserID,
+		Amount:         credit.Amount.Neg(),
+		Reason:         "proration credit",
+		BillID:         &credit.ID,
+		SubscriptionID: &subscription.ID,
+	})
+}
+
+// createBillWithCredit creates the bill after settling as much of it as the
+// user's balance in the bill's currency allows. A bill that comes out
+// negative is created as a credit and added to the balance instead.
+func createBillWithCredit(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, bill *models.Bill) error {
+	if bill.Amount.IsNegative() {
+		bill.Status = models.BillStatusCredit
+		if err := repos.Bills.Create(ctx, bill); err != nil {
+			return err
+		}
+		return creditBalance(ctx, repos, subscription, bill)
+	}
+
+	available, err := repos.Balance.GetBalance(ctx, subscription.UserID, bill.Amount.Currency)
+	if err != nil {
+		return err
+	}
+
+	if available.Amount > 0 && bill.Amount.Amount > 0 {
+		bill.CreditApplied = models.NewMoney(min(available.Amount, bill.Amount.Amount), bill.Amount.Currency)
+	}
+
+	if err := repos.Bills.Create(ctx, bill); err != nil {
+		return err
+	}
+
+	if bill.CreditApplied.IsZero() {
+		return nil
+	}
+
+	return repos.Balance.Create(ctx, &models.BalanceEntry{
+		UserID:         subscription.UserID,
+		Amount:         bill.CreditApplied.Neg(),
+		Reason:         "applied to bill",
+		BillID:         &bill.ID,
+		SubscriptionID: &subscription.ID,
+	})
+}
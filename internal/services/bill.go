@@ -1,11 +1,16 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
 	"github.com/zaher1307/subscription-service/internal/repositories"
+	"github.com/zaher1307/subscription-service/internal/tax"
 )
 
 type BillingService struct {
@@ -13,6 +18,11 @@ type BillingService struct {
 	productRepo      repositories.IProductRepository
 	billRepo         repositories.IBillRepository
 	userRepo         repositories.IUserRepository
+	uow              repositories.IUnitOfWork
+	paymentProvider  payments.PaymentProvider
+	notifier         Notifier
+	dunningSchedule  models.DunningSchedule
+	taxes            *tax.Table
 }
 
 func NewBillingService(
@@ -20,92 +30,900 @@ func NewBillingService(
 	productRepo repositories.IProductRepository,
 	billRepo repositories.IBillRepository,
 	userRepo repositories.IUserRepository,
+	uow repositories.IUnitOfWork,
+	paymentProvider payments.PaymentProvider,
+	notifier Notifier,
+	dunningSchedule models.DunningSchedule,
+	taxes *tax.Table,
 ) *BillingService {
+	if len(dunningSchedule) == 0 {
+		dunningSchedule = models.DefaultDunningSchedule
+	}
+
 	return &BillingService{
 		subscriptionRepo: subscriptionRepo,
 		productRepo:      productRepo,
 		billRepo:         billRepo,
 		userRepo:         userRepo,
+		uow:              uow,
+		paymentProvider:  paymentProvider,
+		notifier:         notifier,
+		dunningSchedule:  dunningSchedule,
+		taxes:            taxes,
 	}
 }
 
-func (s *BillingService) GetBill(id int) (*models.Bill, error) {
-	return s.billRepo.GetByID(id)
+func (s *BillingService) GetBill(ctx context.Context, id int) (*models.Bill, error) {
+	var bill *models.Bill
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		bill, err = repos.Bills.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		bill.Items, err = repos.Bills.GetItems(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		bill.PaymentAttempts, err = repos.Payments.GetByBillID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		bill.DunningAttempts, err = repos.Dunning.GetByBillID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		bill.CreditNotes, err = repos.CreditNotes.GetByBillID(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bill, nil
 }
 
-func (s *BillingService) GetUserBills(userID int) ([]*models.Bill, error) {
-	user, err := s.userRepo.GetByID(userID)
+func (s *BillingService) GetUserBills(ctx context.Context, userID int) ([]*models.Bill, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.billRepo.GetByUserID(user.ID)
+	return s.billRepo.GetByUserID(ctx, user.ID)
 }
 
-func (s *BillingService) PayBill(id int) error {
-	bill, err := s.billRepo.GetByID(id)
+// PayBill charges the bill to one of the customer's saved payment methods,
+// their default one when paymentMethodID is 0, and marks it paid once the
+// provider confirms the charge. Every charge is recorded against the bill,
+// including failed ones. The final bill of a cancelled subscription can
+// still be paid.
+func (s *BillingService) PayBill(ctx context.Context, id, paymentMethodID int) error {
+	var bill *models.Bill
+	var charged *models.PaymentAttempt
+	var method *models.PaymentMethod
+	var declined int
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		bill, err = repos.Bills.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		subscription, err := repos.Subscriptions.GetByID(ctx, bill.SubscriptionID)
+		if err != nil {
+			return err
+		}
+		if err := checkPayable(bill, subscription); err != nil {
+			return err
+		}
+
+		attempts, err := repos.Payments.GetByBillID(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, attempt := range attempts {
+			if attempt.Status == models.PaymentAttemptStatusSucceeded {
+				charged = attempt
+			} else {
+				declined++
+			}
+		}
+		if charged != nil {
+			return nil
+		}
+
+		method, err = paymentMethodFor(ctx, repos, subscription.UserID, paymentMethodID)
+		return err
+	})
 	if err != nil {
 		return err
 	}
 
-	if bill.Status == "paid" {
+	// A bill whose charge went through but which could not be settled is
+	// settled now without charging the customer again.
+	if charged == nil {
+		attempt, chargeErr := s.chargeBill(ctx, bill, method.Token, declined+1)
+
+		// Money may already have moved, so the outcome is recorded even if
+		// the caller has given up waiting.
+		recordCtx := context.WithoutCancel(ctx)
+		err = s.uow.Do(recordCtx, func(repos *repositories.Repositories) error {
+			return repos.Payments.Create(recordCtx, attempt)
+		})
+		if err != nil {
+			return err
+		}
+		if chargeErr != nil {
+			return chargeErr
+		}
+		charged = attempt
+	}
+
+	// The bill and its subscription are checked again under lock, since
+	// either may have changed while the customer was being charged.
+	return s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		subscription, err := repos.Subscriptions.LockByID(ctx, bill.SubscriptionID)
+		if err != nil {
+			return err
+		}
+
+		bill, err = repos.Bills.LockByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if bill.Status != models.BillStatusPending {
+			return fmt.Errorf("%w: bill %d is %s", models.ErrBillNotPending, bill.ID, bill.Status)
+		}
+		if err := checkPayable(bill, subscription); err != nil {
+			return err
+		}
+
+		return settleBill(ctx, repos, bill, *charged.CompletedAt)
+	})
+}
+
+// checkPayable reports why a bill cannot be paid, if it cannot.
+func checkPayable(bill *models.Bill, subscription *models.Subscription) error {
+	if bill.IsPaid() {
 		return errors.New("bill is already paid")
 	}
 
-	err = s.billRepo.MarkAsPaid(id)
+	switch bill.Status {
+	case models.BillStatusCredit:
+		return errors.New("credit bills cannot be paid")
+	case models.BillStatusUncollectible:
+		return errors.New("bill has been written off as uncollectible")
+	}
+
+	// A cancelled subscription still owes its final adjustment bill, but
+	// not a period it will never get.
+	if subscription.Status == models.SubscriptionStatusCancelled && bill.Type != models.BillTypeAdjustment {
+		return errors.New("subscription is cancelled")
+	}
+
+	return nil
+}
+
+// RefundBill gives back part or all of a paid bill, the whole remaining
+// amount when amount is 0, and records it as a credit note. Bills that were
+// charged through the payment provider are refunded through it as well.
+//
+// The bill stays locked from the moment its refunds are counted until the
+// credit note is recorded, so concurrent refunds of the same bill take turns
+// instead of both refunding what only one of them may. A refund that went
+// through but could not be recorded is returned again by the provider when
+// retried, since the retry uses the same idempotency key.
+func (s *BillingService) RefundBill(ctx context.Context, id int, amount int64, reason string) (*models.CreditNote, error) {
+	var note *models.CreditNote
+
+	// Once the provider has given the money back the credit note must be
+	// recorded, even if the caller has given up waiting.
+	recordCtx := context.WithoutCancel(ctx)
+	err := s.uow.Do(recordCtx, func(repos *repositories.Repositories) error {
+		bill, err := repos.Bills.LockByID(recordCtx, id)
+		if err != nil {
+			return err
+		}
+		if !bill.IsPaid() {
+			return errors.New("only paid bills can be refunded")
+		}
+
+		// Only money actually paid can be refunded; credit applied from the
+		// account balance is not.
+		if bill.AmountDue().Amount <= 0 {
+			return errors.New("bill was settled from account credit and has nothing to refund")
+		}
+		remaining, err := bill.AmountDue().Sub(bill.AmountRefunded)
+		if err != nil {
+			return err
+		}
+		if remaining.Amount <= 0 {
+			return errors.New("bill is already fully refunded")
+		}
+		if amount == 0 {
+			amount = remaining.Amount
+		}
+		if amount < 0 || amount > remaining.Amount {
+			return fmt.Errorf("refund amount must be between 1 and %d", remaining.Amount)
+		}
+
+		attempts, err := repos.Payments.GetByBillID(recordCtx, id)
+		if err != nil {
+			return err
+		}
+		var chargeReference string
+		for _, attempt := range attempts {
+			if attempt.Status == models.PaymentAttemptStatusSucceeded {
+				chargeReference = attempt.ProviderReference
+			}
+		}
+
+		notes, err := repos.CreditNotes.GetByBillID(recordCtx, id)
+		if err != nil {
+			return err
+		}
+
+		note = &models.CreditNote{
+			BillID: bill.ID,
+			Amount: models.NewMoney(amount, bill.Amount.Currency),
+			Reason: reason,
+		}
+
+		if chargeReference != "" {
+			refund, err := s.paymentProvider.Refund(ctx, payments.RefundRequest{
+				ChargeReference: chargeReference,
+				Amount:          note.Amount,
+				IdempotencyKey:  fmt.Sprintf("bill-%d-refund-%d", bill.ID, len(notes)+1),
+			})
+			if err != nil {
+				return err
+			}
+			note.ProviderReference = refund.Reference
+		}
+
+		if err := repos.CreditNotes.Create(recordCtx, note); err != nil {
+			return err
+		}
+
+		refunded, err := bill.AmountRefunded.Add(note.Amount)
+		if err != nil {
+			return err
+		}
+
+		status := models.BillStatusPartiallyRefunded
+		if refunded.Amount >= bill.AmountDue().Amount {
+			status = models.BillStatusRefunded
+		}
+
+		return repos.Bills.UpdateRefunded(recordCtx, bill.ID, refunded, status)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+// paymentMethodFor returns the user's payment method with the given ID, or
+// their default one when id is 0.
+func paymentMethodFor(ctx context.Context, repos *repositories.Repositories, userID, id int) (*models.PaymentMethod, error) {
+	if id == 0 {
+		method, err := repos.PaymentMethods.GetDefaultByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if method == nil {
+			return nil, errors.New("no payment method given and the user has no default payment method")
+		}
+		return method, nil
+	}
+
+	return userPaymentMethod(ctx, repos, userID, id)
+}
+
+// chargeBill charges what is due on the bill through the payment provider
+// and returns the resulting attempt, ready to be stored, along with the
+// provider's error.
+//
+// The charge is keyed on the bill and the number of charges declined before
+// it, so concurrent attempts to pay the same bill share a key and the
+// provider charges the customer only once.
+func (s *BillingService) chargeBill(ctx context.Context, bill *models.Bill, paymentMethod string, attemptNumber int) (*models.PaymentAttempt, error) {
+	attempt := &models.PaymentAttempt{
+		BillID:    bill.ID,
+		Provider:  s.paymentProvider.Name(),
+		Amount:    bill.AmountDue(),
+		StartedAt: time.Now(),
+	}
+
+	charge, err := s.paymentProvider.Charge(ctx, payments.ChargeRequest{
+		Amount:         attempt.Amount,
+		PaymentMethod:  paymentMethod,
+		IdempotencyKey: fmt.Sprintf("bill-%d-attempt-%d", bill.ID, attemptNumber),
+	})
+
+	completedAt := time.Now()
+	attempt.CompletedAt = &completedAt
+	if err != nil {
+		attempt.Status = models.PaymentAttemptStatusFailed
+		attempt.FailureCode = payments.FailureCode(err)
+		return attempt, err
+	}
+
+	attempt.Status = models.PaymentAttemptStatusSucceeded
+	attempt.ProviderReference = charge.Reference
+	return attempt, nil
+}
+
+// settleBill marks a bill paid. Paying a period bill starts a fresh period
+// anchored at the time of payment, except for metered products, whose bills
+// cover a period already over and which carry on from its end; adjustment
+// bills leave the period alone.
+func settleBill(ctx context.Context, repos *repositories.Repositories, bill *models.Bill, paidAt time.Time) error {
+	err := repos.Bills.MarkAsPaid(ctx, bill.ID)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now()
-	err = s.subscriptionRepo.UpdateStartDate(bill.SubscriptionID, now)
+	if bill.Type == models.BillTypeAdjustment {
+		return nil
+	}
+
+	subscription, err := repos.Subscriptions.GetByID(ctx, bill.SubscriptionID)
 	if err != nil {
 		return err
 	}
 
-	nextMonth := now.AddDate(0, 1, 0)
-	err = s.subscriptionRepo.UpdateNextBillingDate(bill.SubscriptionID, nextMonth)
+	product, err := repos.Products.GetByID(ctx, subscription.ProductID)
 	if err != nil {
 		return err
 	}
+	if product.IsMetered() {
+		return startNextPeriod(ctx, repos, subscription, product)
+	}
 
-	err = s.subscriptionRepo.ActivateSubscription(bill.SubscriptionID)
+	err = repos.Subscriptions.UpdateBillingAnchor(ctx, bill.SubscriptionID, paidAt)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = repos.Subscriptions.UpdateStartDate(ctx, bill.SubscriptionID, paidAt)
+	if err != nil {
+		return err
+	}
+
+	err = repos.Subscriptions.UpdateNextBillingDate(ctx, bill.SubscriptionID, product.NextBillingDate(paidAt, paidAt))
+	if err != nil {
+		return err
+	}
+
+	return repos.Subscriptions.ActivateSubscription(ctx, bill.SubscriptionID)
 }
 
-func (s *BillingService) GenerateBills() error {
+// renewal is a period bill the billing job will try to collect right away.
+type renewal struct {
+	bill          *models.Bill
+	subscription  *models.Subscription
+	product       *models.Product
+	paymentMethod *models.PaymentMethod
+}
+
+// GenerateBills bills every subscription that is due, each in a
+// transaction of its own so that one failure does not hold back the rest.
+// A subscription that fails is left as it was for the next run to pick up
+// and is listed in the report with the reason. An error is returned only
+// when the run could not carry on at all.
+func (s *BillingService) GenerateBills(ctx context.Context) (*models.BillingRunReport, error) {
 	now := time.Now()
+	report := &models.BillingRunReport{Failures: []models.BillingRunFailure{}}
 
-	subscriptions, err := s.subscriptionRepo.GetDueForBilling(now)
+	paused, err := s.subscriptionRepo.GetDueForResume(ctx, now)
 	if err != nil {
-		return err
+		return report, err
+	}
+
+	for _, subscription := range paused {
+		err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+			return resumeSubscription(ctx, repos, subscription, *subscription.ResumeAt)
+		})
+		if err != nil {
+			report.AddFailure(subscription.ID, fmt.Errorf("resuming: %w", err))
+		}
+	}
+
+	// Renewals that an earlier run created but never got to charge are
+	// collected first. Their subscriptions are on hold, so they are not
+	// due for billing again.
+	uncollected, err := s.billRepo.GetUncollected(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, bill := range uncollected {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		if err := s.collectUncollected(ctx, bill); err != nil {
+			report.AddFailure(bill.SubscriptionID, fmt.Errorf("collecting bill %d: %w", bill.ID, err))
+		}
+	}
+
+	subscriptions, err := s.subscriptionRepo.GetDueForBilling(ctx, now)
+	if err != nil {
+		return report, err
 	}
 
 	for _, subscription := range subscriptions {
-		err := s.subscriptionRepo.HoldSubscription(subscription.ID)
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.SubscriptionsScanned++
+
+		var bill *models.Bill
+		var collect *renewal
+		err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+			// The list above may be stale by now, so the subscription is
+			// billed as it currently is. One that was cancelled, paused or
+			// moved on in the meantime is left alone.
+			current, err := repos.Subscriptions.LockDueForBilling(ctx, subscription.ID, now)
+			if err != nil || current == nil {
+				return err
+			}
+
+			bill, collect, err = s.billSubscription(ctx, repos, current)
+			return err
+		})
+		switch {
+		case errors.Is(err, models.ErrPeriodAlreadyBilled):
+			report.AlreadyBilled++
+			continue
+		case err != nil:
+			report.AddFailure(subscription.ID, err)
+			continue
+		}
+		if bill != nil {
+			report.BillsCreated++
+		}
+
+		// The charge is made once the bill is committed so that a slow
+		// payment provider does not hold the transaction open. A declined
+		// charge is left to dunning; one never made is made by the next run.
+		if collect != nil {
+			if err := s.collectRenewal(ctx, *collect); err != nil {
+				report.AddFailure(subscription.ID, fmt.Errorf("collecting bill %d: %w", collect.bill.ID, err))
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// errDryRun rolls back the transaction of a previewed bill.
+var errDryRun = errors.New("dry run")
+
+// PreviewBills works out the bills a billing run would create for the
+// subscriptions due by asOf, without keeping any of them. Each one is billed
+// as usual through repositories that write and lock nothing, so a preview
+// neither changes anything nor holds up a real run; its transaction is
+// rolled back all the same. Paused subscriptions are not resumed.
+func (s *BillingService) PreviewBills(ctx context.Context, asOf time.Time) (*models.BillingPreview, error) {
+	preview := &models.BillingPreview{
+		AsOf:             asOf,
+		BillingRunReport: models.BillingRunReport{Failures: []models.BillingRunFailure{}},
+		Bills:            []*models.Bill{},
+	}
+
+	subscriptions, err := s.subscriptionRepo.GetDueForBilling(ctx, asOf)
+	if err != nil {
+		return preview, err
+	}
+
+	for _, subscription := range subscriptions {
+		if err := ctx.Err(); err != nil {
+			return preview, err
+		}
+		preview.SubscriptionsScanned++
+
+		var bill *models.Bill
+		err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+			var err error
+			bill, _, err = s.billSubscription(ctx, dryRunRepositories(repos), subscription)
+			if err != nil {
+				return err
+			}
+			return errDryRun
+		})
+		if !errors.Is(err, errDryRun) {
+			preview.AddFailure(subscription.ID, err)
+			continue
+		}
+		if bill == nil {
+			continue
+		}
+
+		preview.BillsCreated++
+		preview.Bills = append(preview.Bills, bill)
+	}
+
+	return preview, nil
+}
+
+// billSubscription ends or renews a subscription that is due. It returns
+// the bill it created, if any, and the renewal to charge when the bill is
+// to be collected automatically.
+func (s *BillingService) billSubscription(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription) (*models.Bill, *renewal, error) {
+	if subscription.CancelAtPeriodEnd {
+		product, err := repos.Products.GetByID(ctx, subscription.ProductID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var usage []*models.BillItem
+		if product.IsMetered() {
+			usage, err = usageItems(ctx, repos, subscription, product, subscription.StartDate, subscription.NextBillingDate)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		final, err := createFinalBill(ctx, repos, subscription, usage...)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = repos.Subscriptions.Cancel(ctx, subscription.ID, subscription.NextBillingDate, subscription.CancellationReason)
+		if err != nil {
+			return nil, nil, err
+		}
+		return final, nil, nil
+	}
+
+	// Every renewal starts out on hold; auto-collected ones are
+	// reactivated once their charge succeeds.
+	err := repos.Subscriptions.HoldSubscription(ctx, subscription.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	productID := subscription.ProductID
+	if subscription.PendingProductID != nil {
+		productID = *subscription.PendingProductID
+		if err := repos.Subscriptions.ChangeProduct(ctx, subscription.ID, productID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	product, err := repos.Products.GetByID(ctx, productID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Licensed products are billed for the period ahead, metered ones for
+	// the usage of the period just ended.
+	bill := &models.Bill{
+		SubscriptionID: subscription.ID,
+		Status:         models.BillStatusPending,
+	}
+	var items []*models.BillItem
+	if product.IsMetered() {
+		periodStart := subscription.StartDate
+		bill.PeriodStart = &periodStart
+		items, err = usageItems(ctx, repos, subscription, product, periodStart, subscription.NextBillingDate)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		periodStart := subscription.NextBillingDate
+		periodEnd := product.NextBillingDate(subscription.BillingAnchor, periodStart)
+		bill.PeriodStart = &periodStart
+		items, err = subscriptionItems(subscription, product, periodStart, periodEnd)
+		if err != nil {
+			return nil, nil, err
+		}
+		addOns, err := addOnItems(ctx, repos, subscription, periodStart, periodEnd)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, addOns...)
+	}
+	for _, item := range items {
+		if err := bill.AddItem(item); err != nil {
+			return nil, nil, err
+		}
+	}
+	pendingIDs, err := addPendingItems(ctx, repos, subscription, bill)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A metered period without usage has nothing to bill.
+	if len(bill.Items) == 0 {
+		return nil, nil, startNextPeriod(ctx, repos, subscription, product)
+	}
+
+	if err := applyCoupon(ctx, repos, subscription, product, bill); err != nil {
+		return nil, nil, err
+	}
+
+	if s.taxes != nil {
+		user, err := repos.Users.GetByID(ctx, subscription.UserID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := applyTax(ctx, repos, s.taxes, user, product, bill); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := createBillWithCredit(ctx, repos, subscription, bill); err != nil {
+		return nil, nil, err
+	}
+	if err := repos.PendingItems.MarkBilled(ctx, pendingIDs, bill.ID); err != nil {
+		return nil, nil, err
+	}
+
+	// A renewal fully covered by account credit, or outweighed by prorated
+	// credits, needs no payment.
+	if bill.AmountDue().IsZero() || bill.Status == models.BillStatusCredit {
+		err := renewSubscription(ctx, repos, renewal{bill: bill, subscription: subscription, product: product})
+		return bill, nil, err
+	}
+
+	if !subscription.AutoCollect {
+		return bill, nil, nil
+	}
+
+	method, err := repos.PaymentMethods.GetDefaultByUserID(ctx, subscription.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if method == nil {
+		log.Printf("Subscription %d has no default payment method to collect bill %d", subscription.ID, bill.ID)
+		return bill, nil, nil
+	}
+
+	return bill, &renewal{
+		bill:          bill,
+		subscription:  subscription,
+		product:       product,
+		paymentMethod: method,
+	}, nil
+}
+
+// collectUncollected charges a renewal bill that was created but never
+// charged. The charge reuses the idempotency key of the first attempt, so a
+// charge that went through without being recorded is not made twice.
+func (s *BillingService) collectUncollected(ctx context.Context, bill *models.Bill) error {
+	var collect *renewal
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		// The bill was listed before the run got to it, so it may have been
+		// paid, charged or written off since.
+		subscription, err := repos.Subscriptions.LockByID(ctx, bill.SubscriptionID)
+		if err != nil {
+			return err
+		}
+		if subscription.Status != models.SubscriptionStatusHold || !subscription.AutoCollect {
+			return nil
+		}
+
+		bill, err = repos.Bills.LockByID(ctx, bill.ID)
+		if err != nil {
+			return err
+		}
+		if bill.Status != models.BillStatusPending {
+			return nil
+		}
+		attempts, err := repos.Payments.GetByBillID(ctx, bill.ID)
+		if err != nil {
+			return err
+		}
+		if len(attempts) > 0 {
+			return nil
+		}
+
+		product, err := repos.Products.GetByID(ctx, subscription.ProductID)
 		if err != nil {
 			return err
 		}
 
-		product, err := s.productRepo.GetByID(subscription.ProductID)
+		method, err := repos.PaymentMethods.GetDefaultByUserID(ctx, subscription.UserID)
 		if err != nil {
 			return err
 		}
+		if method == nil {
+			return errors.New("user has no default payment method")
+		}
 
-		bill := &models.Bill{
-			SubscriptionID: subscription.ID,
-			Amount:         product.Price,
-			Status:         "pending",
+		collect = &renewal{
+			bill:          bill,
+			subscription:  subscription,
+			product:       product,
+			paymentMethod: method,
 		}
+		return nil
+	})
+	if err != nil || collect == nil {
+		return err
+	}
+
+	return s.collectRenewal(ctx, *collect)
+}
+
+// collectRenewal charges a renewal bill to the default payment method. On
+// success the bill is paid and the subscription moves on to its next
+// period; on failure it stays on hold for a manual payment and dunning.
+func (s *BillingService) collectRenewal(ctx context.Context, r renewal) error {
+	attempt, chargeErr := s.chargeBill(ctx, r.bill, r.paymentMethod.Token, 1)
+
+	recordCtx := context.WithoutCancel(ctx)
+	err := s.uow.Do(recordCtx, func(repos *repositories.Repositories) error {
+		if err := repos.Payments.Create(recordCtx, attempt); err != nil {
+			return err
+		}
+		if chargeErr != nil {
+			return nil
+		}
+
+		return renewSubscription(recordCtx, repos, r)
+	})
+	if err != nil {
+		return err
+	}
+
+	if chargeErr != nil {
+		log.Printf("Automatic collection of bill %d failed: %v", r.bill.ID, chargeErr)
+	}
+
+	return nil
+}
+
+// subscriptionItems prices a period of product for the subscription's
+// quantity, at least one, as one bill line per rate charged.
+func subscriptionItems(subscription *models.Subscription, product *models.Product, periodStart, periodEnd time.Time) ([]*models.BillItem, error) {
+	quantity := max(subscription.Quantity, 1)
+	lines, err := priceLines(product, product.Name, subscription.Currency, int64(quantity))
+	if err != nil {
+		return nil, err
+	}
+	return billItems(models.BillItemKindSubscription, product.ID, lines, periodStart, periodEnd), nil
+}
 
-		if err := s.billRepo.Create(bill); err != nil {
+// renewSubscription marks an automatically collected bill paid and starts
+// the period it covers. Unlike a manual payment it keeps the billing anchor,
+// so renewals stay on schedule.
+func renewSubscription(ctx context.Context, repos *repositories.Repositories, r renewal) error {
+	if r.bill.Status != models.BillStatusCredit {
+		if err := repos.Bills.MarkAsPaid(ctx, r.bill.ID); err != nil {
 			return err
 		}
 	}
 
+	return startNextPeriod(ctx, repos, r.subscription, r.product)
+}
+
+// startNextPeriod moves a subscription on to the period starting at its
+// next billing date, keeping its billing anchor, and reactivates it.
+func startNextPeriod(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, product *models.Product) error {
+	periodStart := subscription.NextBillingDate
+	err := repos.Subscriptions.UpdateStartDate(ctx, subscription.ID, periodStart)
+	if err != nil {
+		return err
+	}
+
+	err = repos.Subscriptions.UpdateNextBillingDate(ctx, subscription.ID, product.NextBillingDate(subscription.BillingAnchor, periodStart))
+	if err != nil {
+		return err
+	}
+
+	return repos.Subscriptions.ActivateSubscription(ctx, subscription.ID)
+}
+
+// RunDunning takes the next due step of the dunning schedule for every
+// overdue bill. Each bill is handled in its own transaction so one failure
+// does not hold back the rest; at most one step is taken per bill and run.
+func (s *BillingService) RunDunning(ctx context.Context) error {
+	bills, err := s.billRepo.GetOverdue(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var errs []error
+	for _, bill := range bills {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		if err := s.dunBill(ctx, bill, now); err != nil {
+			errs = append(errs, fmt.Errorf("dunning bill %d: %w", bill.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *BillingService) dunBill(ctx context.Context, bill *models.Bill, now time.Time) error {
+	var reminder *models.User
+	var attempt *models.DunningAttempt
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		// The overdue bills were listed before any of them was dunned, so the
+		// bill may have been paid or the subscription cancelled since.
+		subscription, err := repos.Subscriptions.LockByID(ctx, bill.SubscriptionID)
+		if err != nil {
+			return err
+		}
+		if subscription.Status != models.SubscriptionStatusHold && subscription.Status != models.SubscriptionStatusPastDue {
+			return nil
+		}
+
+		bill, err = repos.Bills.LockByID(ctx, bill.ID)
+		if err != nil {
+			return err
+		}
+		if bill.Status != models.BillStatusPending {
+			return nil
+		}
+
+		attempts, err := repos.Dunning.GetByBillID(ctx, bill.ID)
+		if err != nil {
+			return err
+		}
+
+		product, err := repos.Products.GetByID(ctx, subscription.ProductID)
+		if err != nil {
+			return err
+		}
+
+		schedule := s.dunningSchedule
+		if product.DunningSchedule != nil {
+			schedule = product.DunningSchedule
+		}
+
+		next := len(attempts)
+		if next >= len(schedule) {
+			return nil
+		}
+		step := schedule[next]
+		if now.Before(bill.CreatedAt.AddDate(0, 0, step.AfterDays)) {
+			return nil
+		}
+
+		attempt = &models.DunningAttempt{BillID: bill.ID, Step: next + 1, Action: step.Action}
+		if err := repos.Dunning.Create(ctx, attempt); err != nil {
+			return err
+		}
+
+		switch step.Action {
+		case models.DunningActionRemind:
+			if err := repos.Subscriptions.MarkPastDue(ctx, subscription.ID); err != nil {
+				return err
+			}
+			reminder, err = repos.Users.GetByID(ctx, subscription.UserID)
+			return err
+		case models.DunningActionCancel:
+			if err := repos.Subscriptions.Cancel(ctx, subscription.ID, now, "unpaid bill"); err != nil {
+				return err
+			}
+			return repos.Bills.MarkUncollectible(ctx, bill.ID)
+		case models.DunningActionMarkUnpaid:
+			return repos.Subscriptions.MarkUnpaid(ctx, subscription.ID)
+		default:
+			return fmt.Errorf("unknown dunning action %q", step.Action)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Reminders go out only once the attempt is committed, so a rolled back
+	// step is never announced to the customer.
+	if reminder != nil {
+		if err := s.notifier.SendPaymentReminder(ctx, reminder, bill, attempt.Step); err != nil {
+			log.Printf("Failed to send payment reminder for bill %d: %v", bill.ID, err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+// maxBillingRuns caps how many runs ListRuns returns at once.
+const maxBillingRuns = 100
+
+// BillingLock keeps billing runs on different instances of the service
+// from overlapping.
+type BillingLock interface {
+	// Acquire takes the lock unless someone else holds it. The lock is kept
+	// until Release, however long that is; the returned context is derived
+	// from ctx and cancelled with models.ErrBillingLockLost if the lock is
+	// lost in the meantime.
+	Acquire(ctx context.Context) (context.Context, bool, error)
+	Release(ctx context.Context) error
+	// Holder names this instance as the holder of the lock.
+	Holder() string
+}
+
+type BillingRunService struct {
+	uow     repositories.IUnitOfWork
+	billing IBillingService
+	lock    BillingLock
+}
+
+func NewBillingRunService(uow repositories.IUnitOfWork, billing IBillingService, lock BillingLock) *BillingRunService {
+	return &BillingRunService{uow: uow, billing: billing, lock: lock}
+}
+
+// Run runs the billing job while holding the billing lock: it bills every
+// subscription that is due, records the run and then works through
+// dunning. It returns models.ErrBillingRunInProgress when another run holds
+// the lock. A run that stops early is returned as failed rather than as an
+// error.
+func (s *BillingRunService) Run(ctx context.Context) (*models.BillingRun, error) {
+	ctx, run, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release()
+
+	if err := s.complete(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Start starts a billing run like Run but returns as soon as it has been
+// recorded, leaving it to carry on in the background for up to timeout. It
+// is not cancelled along with ctx; its progress can be followed through
+// GetRun.
+func (s *BillingRunService) Start(ctx context.Context, timeout time.Duration) (*models.BillingRun, error) {
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	runCtx, run, err := s.begin(runCtx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The caller gets a copy, since the run is updated as it finishes.
+	started := *run
+	go func() {
+		defer cancel()
+		defer s.release()
+
+		if err := s.complete(runCtx, run); err != nil {
+			log.Printf("Failed to record billing run %d: %v", run.ID, err)
+		}
+	}()
+
+	return &started, nil
+}
+
+// begin takes the billing lock and records the start of a run. The
+// returned context is cancelled if the lock is lost; the lock is held until
+// release.
+func (s *BillingRunService) begin(ctx context.Context) (context.Context, *models.BillingRun, error) {
+	ctx, acquired, err := s.lock.Acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !acquired {
+		return nil, nil, models.ErrBillingRunInProgress
+	}
+
+	run, err := s.StartRun(ctx, s.lock.Holder())
+	if err != nil {
+		s.release()
+		return nil, nil, err
+	}
+
+	return ctx, run, nil
+}
+
+// complete bills what is due, records how the run went and runs dunning.
+func (s *BillingRunService) complete(ctx context.Context, run *models.BillingRun) error {
+	report, runErr := s.billing.GenerateBills(ctx)
+	if runErr != nil && context.Cause(ctx) != nil {
+		runErr = context.Cause(ctx)
+	}
+	if runErr != nil {
+		log.Printf("Billing run %d stopped early: %v", run.ID, runErr)
+	}
+	log.Printf("Billing run %d scanned %d subscriptions, created %d bills, skipped %d already billed, %d failed",
+		run.ID, report.SubscriptionsScanned, report.BillsCreated, report.AlreadyBilled, len(report.Failures))
+	for _, failure := range report.Failures {
+		log.Printf("Billing subscription %d failed: %s", failure.SubscriptionID, failure.Reason)
+	}
+
+	// The run's own context may have run out by now.
+	finishCtx, finishCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer finishCancel()
+	if err := s.FinishRun(finishCtx, run, report, runErr); err != nil {
+		return err
+	}
+
+	if err := s.billing.RunDunning(ctx); err != nil {
+		log.Printf("Error running dunning: %v", err)
+	}
+
+	return nil
+}
+
+func (s *BillingRunService) release() {
+	releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer releaseCancel()
+	if err := s.lock.Release(releaseCtx); err != nil {
+		log.Printf("Failed to release billing lock: %v", err)
+	}
+}
+
+// DryRun reports what a billing run would bill as of asOf, without
+// charging or writing anything. It does not need the billing lock.
+func (s *BillingRunService) DryRun(ctx context.Context, asOf time.Time) (*models.BillingPreview, error) {
+	return s.billing.PreviewBills(ctx, asOf)
+}
+
+// StartRun records that lockHolder has started a billing run.
+func (s *BillingRunService) StartRun(ctx context.Context, lockHolder string) (*models.BillingRun, error) {
+	run := &models.BillingRun{
+		Status:     models.BillingRunStatusRunning,
+		LockHolder: lockHolder,
+		StartedAt:  time.Now(),
+	}
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		return repos.BillingRuns.Create(ctx, run)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// FinishRun records the report of a run. runErr is the error the run
+// stopped with, if any, which marks the run as failed.
+func (s *BillingRunService) FinishRun(ctx context.Context, run *models.BillingRun, report *models.BillingRunReport, runErr error) error {
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = models.BillingRunStatusCompleted
+	if runErr != nil {
+		run.Status = models.BillingRunStatusFailed
+		run.Error = runErr.Error()
+	}
+	if report != nil {
+		run.BillingRunReport = *report
+	}
+
+	return s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		return repos.BillingRuns.Finish(ctx, run)
+	})
+}
+
+// ListRuns returns the latest limit billing runs, newest first, with their
+// failures.
+func (s *BillingRunService) ListRuns(ctx context.Context, limit int) ([]*models.BillingRun, error) {
+	if limit < 1 || limit > maxBillingRuns {
+		limit = maxBillingRuns
+	}
+
+	var runs []*models.BillingRun
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		runs, err = repos.BillingRuns.GetRecent(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, run := range runs {
+			run.Failures, err = repos.BillingRuns.GetFailures(ctx, run.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+func (s *BillingRunService) GetRun(ctx context.Context, id int) (*models.BillingRun, error) {
+	var run *models.BillingRun
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		run, err = repos.BillingRuns.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		run.Failures, err = repos.BillingRuns.GetFailures(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
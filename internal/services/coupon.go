@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+type CouponService struct {
+	uow repositories.IUnitOfWork
+}
+
+func NewCouponService(uow repositories.IUnitOfWork) *CouponService {
+	return &CouponService{uow: uow}
+}
+
+// CreateCoupon saves a new coupon. Codes are case-insensitive and stored in
+// upper case.
+func (s *CouponService) CreateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	if coupon.AmountOff != nil {
+		amountOff := models.NewMoney(coupon.AmountOff.Amount, coupon.AmountOff.Currency)
+		coupon.AmountOff = &amountOff
+	}
+	if err := coupon.Validate(); err != nil {
+		return err
+	}
+
+	return s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		for _, productID := range coupon.ProductIDs {
+			if _, err := repos.Products.GetByID(ctx, productID); err != nil {
+				return err
+			}
+		}
+
+		return repos.Coupons.Create(ctx, coupon)
+	})
+}
+
+func (s *CouponService) GetCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	var coupon *models.Coupon
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		coupon, err = repos.Coupons.GetByCode(ctx, strings.ToUpper(code))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return coupon, nil
+}
+
+// redeemCoupon attaches the coupon with the given code to a subscription
+// that is about to be created for product.
+func redeemCoupon(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, product *models.Product, code string, now time.Time) error {
+	coupon, err := repos.Coupons.GetByCode(ctx, strings.ToUpper(code))
+	if err != nil {
+		return err
+	}
+
+	price, err := product.PriceIn(subscription.Currency)
+	if err != nil {
+		return err
+	}
+	if err := coupon.CheckRedeemable(product.ID, price, now); err != nil {
+		return err
+	}
+
+	if err := repos.Coupons.Redeem(ctx, coupon.ID); err != nil {
+		return err
+	}
+
+	subscription.CouponID = &coupon.ID
+	subscription.CouponCyclesLeft = coupon.Cycles()
+	return nil
+}
+
+// applyCoupon takes the subscription's coupon discount, if it has one left,
+// off a bill for product that is about to be created.
+func applyCoupon(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, product *models.Product, bill *models.Bill) error {
+	if subscription.CouponID == nil {
+		return nil
+	}
+	if subscription.CouponCyclesLeft != nil && *subscription.CouponCyclesLeft <= 0 {
+		return nil
+	}
+	if bill.Amount.Amount <= 0 {
+		return nil
+	}
+
+	coupon, err := repos.Coupons.GetByID(ctx, *subscription.CouponID)
+	if err != nil {
+		return err
+	}
+
+	// A plan change can move the subscription onto a product, or a
+	// currency, the coupon was not meant for.
+	if !coupon.AppliesTo(product.ID) {
+		return nil
+	}
+	discount, err := coupon.Discount(bill.Amount)
+	if err != nil {
+		log.Printf("Coupon %s not applied to subscription %d: %v", coupon.Code, subscription.ID, err)
+		return nil
+	}
+
+	if discount.IsZero() {
+		return nil
+	}
+
+	err = bill.AddItem(&models.BillItem{
+		Kind:        models.BillItemKindDiscount,
+		Description: "Coupon " + coupon.Code,
+		Quantity:    1,
+		UnitAmount:  discount.Neg(),
+	})
+	if err != nil {
+		return err
+	}
+	bill.CouponID = &coupon.ID
+
+	if subscription.CouponCyclesLeft == nil {
+		return nil
+	}
+	if err := repos.Subscriptions.UseCouponCycle(ctx, subscription.ID); err != nil {
+		return err
+	}
+	*subscription.CouponCyclesLeft--
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+// dryRunRepositories wraps repos so that billing a subscription through
+// them reads as usual but writes and locks nothing. Bills "created" through
+// them keep an ID of 0.
+func dryRunRepositories(repos *repositories.Repositories) *repositories.Repositories {
+	dryRun := *repos
+	dryRun.Subscriptions = dryRunSubscriptions{repos.Subscriptions}
+	dryRun.Bills = dryRunBills{repos.Bills}
+	dryRun.PendingItems = dryRunPendingItems{repos.PendingItems}
+	dryRun.Balance = dryRunBalance{repos.Balance}
+	return &dryRun
+}
+
+// dryRunSubscriptions leaves out the changes billing makes to a
+// subscription.
+type dryRunSubscriptions struct {
+	repositories.ISubscriptionRepository
+}
+
+func (dryRunSubscriptions) HoldSubscription(ctx context.Context, id int) error { return nil }
+
+func (dryRunSubscriptions) ActivateSubscription(ctx context.Context, id int) error { return nil }
+
+func (dryRunSubscriptions) ChangeProduct(ctx context.Context, id, productID int) error { return nil }
+
+func (dryRunSubscriptions) Cancel(ctx context.Context, id int, cancelledAt time.Time, reason string) error {
+	return nil
+}
+
+func (dryRunSubscriptions) UpdateStartDate(ctx context.Context, id int, nextDate time.Time) error {
+	return nil
+}
+
+func (dryRunSubscriptions) UpdateNextBillingDate(ctx context.Context, id int, nextDate time.Time) error {
+	return nil
+}
+
+func (dryRunSubscriptions) UseCouponCycle(ctx context.Context, id int) error { return nil }
+
+type dryRunBills struct {
+	repositories.IBillRepository
+}
+
+func (dryRunBills) Create(ctx context.Context, bill *models.Bill) error { return nil }
+
+func (dryRunBills) MarkAsPaid(ctx context.Context, id int) error { return nil }
+
+type dryRunPendingItems struct {
+	repositories.IPendingItemRepository
+}
+
+func (dryRunPendingItems) MarkBilled(ctx context.Context, ids []int, billID int) error { return nil }
+
+// dryRunBalance reads balances without locking the user, which only
+// matters when the credit is actually spent.
+type dryRunBalance struct {
+	repositories.IBalanceRepository
+}
+
+func (dryRunBalance) Create(ctx context.Context, entry *models.BalanceEntry) error { return nil }
+
+func (b dryRunBalance) GetBalance(ctx context.Context, userID int, currency string) (models.Money, error) {
+	balances, err := b.GetBalances(ctx, userID)
+	if err != nil {
+		return models.Money{}, err
+	}
+
+	for _, balance := range balances {
+		if balance.Currency == currency {
+			return balance, nil
+		}
+	}
+	return models.NewMoney(0, currency), nil
+}
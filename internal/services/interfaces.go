@@ -1,33 +1,99 @@
 package services
 
-import "github.com/zaher1307/subscription-service/internal/models"
+import (
+	"context"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+)
 
 type ISubscriptionService interface {
-	CreateSubscription(userID, productID int) (*models.Subscription, *models.Bill, error)
-	GetSubscription(id int) (*models.Subscription, error)
+	CreateSubscription(ctx context.Context, params CreateSubscriptionParams) (*models.Subscription, *models.Bill, error)
+	GetSubscription(ctx context.Context, id int) (*models.Subscription, error)
+	CancelSubscription(ctx context.Context, id int, mode CancellationMode, reason string, prorateCredit bool) (*models.Subscription, *models.Bill, error)
+	PauseSubscription(ctx context.Context, id int, resumeAt *time.Time) (*models.Subscription, error)
+	ResumeSubscription(ctx context.Context, id int) (*models.Subscription, error)
+	ChangePlan(ctx context.Context, id, productID int, mode PlanChangeMode) (*models.Subscription, *models.Bill, error)
+	ChangeQuantity(ctx context.Context, id, quantity int) (*models.Subscription, *models.PendingItem, error)
 }
 
 var _ ISubscriptionService = (*SubscriptionService)(nil)
 
 type IBillingService interface {
-	GetBill(id int) (*models.Bill, error)
-	GetUserBills(userID int) ([]*models.Bill, error)
-	PayBill(id int) error
-	GenerateBills() error
+	GetBill(ctx context.Context, id int) (*models.Bill, error)
+	GetUserBills(ctx context.Context, userID int) ([]*models.Bill, error)
+	PayBill(ctx context.Context, id, paymentMethodID int) error
+	RefundBill(ctx context.Context, id int, amount int64, reason string) (*models.CreditNote, error)
+	GenerateBills(ctx context.Context) (*models.BillingRunReport, error)
+	PreviewBills(ctx context.Context, asOf time.Time) (*models.BillingPreview, error)
+	RunDunning(ctx context.Context) error
 }
 
 var _ IBillingService = (*BillingService)(nil)
 
+type IPaymentMethodService interface {
+	AddPaymentMethod(ctx context.Context, userID int, details payments.PaymentMethodDetails, makeDefault bool) (*models.PaymentMethod, error)
+	ListPaymentMethods(ctx context.Context, userID int) ([]*models.PaymentMethod, error)
+	SetDefaultPaymentMethod(ctx context.Context, userID, id int) (*models.PaymentMethod, error)
+	RemovePaymentMethod(ctx context.Context, userID, id int) error
+}
+
+var _ IPaymentMethodService = (*PaymentMethodService)(nil)
+
+type IBalanceService interface {
+	GetBalance(ctx context.Context, userID int) ([]models.Money, []*models.BalanceEntry, error)
+	AddCredit(ctx context.Context, userID int, amount models.Money, reason string) (*models.BalanceEntry, error)
+}
+
+var _ IBalanceService = (*BalanceService)(nil)
+
+type ICouponService interface {
+	CreateCoupon(ctx context.Context, coupon *models.Coupon) error
+	GetCoupon(ctx context.Context, code string) (*models.Coupon, error)
+}
+
+var _ ICouponService = (*CouponService)(nil)
+
+type IAddOnService interface {
+	AddAddOn(ctx context.Context, subscriptionID, productID, quantity int) (*models.SubscriptionAddOn, *models.PendingItem, error)
+	ListAddOns(ctx context.Context, subscriptionID int) ([]*models.SubscriptionAddOn, error)
+	RemoveAddOn(ctx context.Context, subscriptionID, addOnID int) (*models.PendingItem, error)
+}
+
+var _ IAddOnService = (*AddOnService)(nil)
+
+type IUsageService interface {
+	RecordUsage(ctx context.Context, record *models.UsageRecord) (*models.UsageRecord, bool, error)
+	GetUsage(ctx context.Context, subscriptionID int) (*models.UsageSummary, error)
+}
+
+var _ IUsageService = (*UsageService)(nil)
+
+type IBillingRunService interface {
+	Run(ctx context.Context) (*models.BillingRun, error)
+	Start(ctx context.Context, timeout time.Duration) (*models.BillingRun, error)
+	DryRun(ctx context.Context, asOf time.Time) (*models.BillingPreview, error)
+	StartRun(ctx context.Context, lockHolder string) (*models.BillingRun, error)
+	FinishRun(ctx context.Context, run *models.BillingRun, report *models.BillingRunReport, runErr error) error
+	ListRuns(ctx context.Context, limit int) ([]*models.BillingRun, error)
+	GetRun(ctx context.Context, id int) (*models.BillingRun, error)
+}
+
+var _ IBillingRunService = (*BillingRunService)(nil)
+
 type IProductService interface {
-	GetAllProducts() ([]*models.Product, error)
-	GetProductByID(id int) (*models.Product, error)
+	GetAllProducts(ctx context.Context, currency string) ([]*models.Product, error)
+	GetProductByID(ctx context.Context, id int) (*models.Product, error)
+	QuotePrice(ctx context.Context, id int, currency string, quantity int64) (*models.PriceQuote, error)
 }
 
 var _ IProductService = (*ProductService)(nil)
 
 type IUserService interface {
-	CreateUser(user *models.User) error
-	GetUserByID(id int) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	UpdateBillingDetails(ctx context.Context, id int, address *models.Address, taxID string) (*models.User, error)
 }
 
 var _ IUserService = (*UserService)(nil)
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+// Notifier delivers customer-facing messages about their bills.
+type Notifier interface {
+	SendPaymentReminder(ctx context.Context, user *models.User, bill *models.Bill, attempt int) error
+}
+
+// LogNotifier writes notifications to the application log. It stands in
+// until a real delivery channel is configured.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) SendPaymentReminder(ctx context.Context, user *models.User, bill *models.Bill, attempt int) error {
+	log.Printf("Payment reminder %d for bill %d (%s) sent to %s", attempt, bill.ID, bill.Amount, user.Email)
+	return nil
+}
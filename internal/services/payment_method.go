@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+type PaymentMethodService struct {
+	uow             repositories.IUnitOfWork
+	paymentProvider payments.PaymentProvider
+}
+
+func NewPaymentMethodService(uow repositories.IUnitOfWork, paymentProvider payments.PaymentProvider) *PaymentMethodService {
+	return &PaymentMethodService{
+		uow:             uow,
+		paymentProvider: paymentProvider,
+	}
+}
+
+// AddPaymentMethod tokenises the details with the payment provider and
+// saves the result for the user. A user's first payment method becomes
+// their default.
+func (s *PaymentMethodService) AddPaymentMethod(ctx context.Context, userID int, details payments.PaymentMethodDetails, makeDefault bool) (*models.PaymentMethod, error) {
+	var method *models.PaymentMethod
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if _, err := repos.Users.GetByID(ctx, userID); err != nil {
+			return err
+		}
+
+		token, err := s.paymentProvider.Tokenize(ctx, details)
+		if err != nil {
+			return err
+		}
+
+		method = &models.PaymentMethod{
+			UserID: userID,
+			Type:   token.Type,
+			Token:  token.Token,
+			Last4:  token.Last4,
+		}
+		if details.ExpMonth != 0 {
+			method.ExpMonth = &details.ExpMonth
+			method.ExpYear = &details.ExpYear
+		}
+		if err := repos.PaymentMethods.Create(ctx, method); err != nil {
+			return err
+		}
+
+		current, err := repos.PaymentMethods.GetDefaultByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if current != nil && !makeDefault {
+			return nil
+		}
+
+		method.IsDefault = true
+		return repos.PaymentMethods.SetDefault(ctx, userID, method.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return method, nil
+}
+
+func (s *PaymentMethodService) ListPaymentMethods(ctx context.Context, userID int) ([]*models.PaymentMethod, error) {
+	var methods []*models.PaymentMethod
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if _, err := repos.Users.GetByID(ctx, userID); err != nil {
+			return err
+		}
+
+		var err error
+		methods, err = repos.PaymentMethods.GetByUserID(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return methods, nil
+}
+
+func (s *PaymentMethodService) SetDefaultPaymentMethod(ctx context.Context, userID, id int) (*models.PaymentMethod, error) {
+	var method *models.PaymentMethod
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		method, err = userPaymentMethod(ctx, repos, userID, id)
+		if err != nil {
+			return err
+		}
+
+		method.IsDefault = true
+		return repos.PaymentMethods.SetDefault(ctx, userID, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return method, nil
+}
+
+// RemovePaymentMethod deletes a saved payment method. Removing the default
+// leaves the user without one until another is set.
+func (s *PaymentMethodService) RemovePaymentMethod(ctx context.Context, userID, id int) error {
+	return s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if _, err := userPaymentMethod(ctx, repos, userID, id); err != nil {
+			return err
+		}
+
+		return repos.PaymentMethods.Delete(ctx, id)
+	})
+}
+
+func userPaymentMethod(ctx context.Context, repos *repositories.Repositories, userID, id int) (*models.PaymentMethod, error) {
+	method, err := repos.PaymentMethods.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if method.UserID != userID {
+		return nil, fmt.Errorf("payment method %d not found", id)
+	}
+
+	return method, nil
+}
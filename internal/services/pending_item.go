@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+// addPendingItems moves the subscription's unbilled items onto a bill that
+// is about to be created and returns their IDs, which are marked billed
+// once the bill exists.
+func addPendingItems(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, bill *models.Bill) ([]int, error) {
+	pending, err := repos.PendingItems.GetUnbilled(ctx, subscription.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(pending))
+	for _, item := range pending {
+		if err := bill.AddItem(item.BillItem()); err != nil {
+			return nil, err
+		}
+		ids = append(ids, item.ID)
+	}
+
+	return ids, nil
+}
+
+// createFinalBill settles a subscription that is ending: its unbilled items
+// and any extra ones go on an adjustment bill, which is a credit added to
+// the user's balance when it comes out negative. It returns nil when there
+// is nothing to bill.
+func createFinalBill(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, extra ...*models.BillItem) (*models.Bill, error) {
+	bill := &models.Bill{
+		SubscriptionID: subscription.ID,
+		Type:           models.BillTypeAdjustment,
+		Status:         models.BillStatusPending,
+	}
+
+	ids, err := addPendingItems(ctx, repos, subscription, bill)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range extra {
+		if err := bill.AddItem(item); err != nil {
+			return nil, err
+		}
+	}
+	if len(bill.Items) == 0 {
+		return nil, nil
+	}
+
+	switch {
+	case bill.Amount.IsNegative():
+		bill.Status = models.BillStatusCredit
+	case bill.Amount.IsZero():
+		now := time.Now()
+		bill.Status = models.BillStatusPaid
+		bill.PaidAt = &now
+	}
+
+	if err := repos.Bills.Create(ctx, bill); err != nil {
+		return nil, err
+	}
+	if err := repos.PendingItems.MarkBilled(ctx, ids, bill.ID); err != nil {
+		return nil, err
+	}
+	if bill.Status == models.BillStatusCredit {
+		if err := creditBalance(ctx, repos, subscription, bill); err != nil {
+			return nil, err
+		}
+	}
+
+	return bill, nil
+}
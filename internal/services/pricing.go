@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+// quotePrice prices quantity units of product in currency for one billing
+// period under the product's pricing scheme.
+func quotePrice(product *models.Product, currency string, quantity int64) (*models.PriceQuote, error) {
+	lines, err := priceLines(product, product.Name, currency, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	price, err := product.PriceIn(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &models.PriceQuote{
+		ProductID:     product.ID,
+		PricingScheme: product.Scheme(),
+		Quantity:      quantity,
+		Lines:         lines,
+		Amount:        models.NewMoney(0, price.Currency),
+	}
+	for _, line := range lines {
+		quote.Amount, err = quote.Amount.Add(line.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return quote, nil
+}
+
+// priceLines prices quantity units of product in currency, with one line
+// per rate charged, each described as name plus the units it covers.
+// Quantities that cost nothing have no lines.
+func priceLines(product *models.Product, name, currency string, quantity int64) ([]models.PriceLine, error) {
+	if quantity < 0 {
+		return nil, fmt.Errorf("quantity must not be negative")
+	}
+
+	switch product.Scheme() {
+	case models.PricingSchemeFlat:
+		price, err := product.PriceIn(currency)
+		if err != nil {
+			return nil, err
+		}
+		return []models.PriceLine{priceLine(name, 1, price)}, nil
+
+	case models.PricingSchemePerUnit:
+		price, err := product.PriceIn(currency)
+		if err != nil || quantity == 0 {
+			return nil, err
+		}
+		return []models.PriceLine{priceLine(name, quantity, price)}, nil
+
+	case models.PricingSchemePackage:
+		if product.PackageSize < 1 {
+			return nil, fmt.Errorf("product %d has no package size", product.ID)
+		}
+		price, err := product.PriceIn(currency)
+		if err != nil || quantity == 0 {
+			return nil, err
+		}
+		size := int64(product.PackageSize)
+		packages := (quantity + size - 1) / size
+		return []models.PriceLine{priceLine(fmt.Sprintf("%s (packages of %d)", name, size), packages, price)}, nil
+
+	case models.PricingSchemeGraduated:
+		tiers, err := tiersIn(product, currency)
+		if err != nil || quantity == 0 {
+			return nil, err
+		}
+		return graduatedLines(tiers, name, quantity), nil
+
+	case models.PricingSchemeVolume:
+		tiers, err := tiersIn(product, currency)
+		if err != nil || quantity == 0 {
+			return nil, err
+		}
+		var previous int64
+		for i, tier := range tiers {
+			if tier.UpTo == nil || quantity <= *tier.UpTo || i == len(tiers)-1 {
+				return []models.PriceLine{priceLine(tierDescription(name, previous, tier.UpTo), quantity, tier.UnitAmount)}, nil
+			}
+			previous = *tier.UpTo
+		}
+		return nil, nil
+
+	default:
+		return nil, fmt.Errorf("unknown pricing scheme %q", product.PricingScheme)
+	}
+}
+
+func tiersIn(product *models.Product, currency string) ([]models.PriceTier, error) {
+	tiers := product.TiersIn(currency)
+	if len(tiers) == 0 {
+		if currency == "" {
+			currency = product.Price.Currency
+		}
+		return nil, fmt.Errorf("%w: product %d has no price tiers in %s", models.ErrPriceUnavailable, product.ID, currency)
+	}
+	return tiers, nil
+}
+
+// graduatedLines charges each tier's units at its own rate, with one line
+// per tier used.
+func graduatedLines(tiers []models.PriceTier, name string, quantity int64) []models.PriceLine {
+	var lines []models.PriceLine
+	var previous int64
+	remaining := quantity
+	for i, tier := range tiers {
+		if remaining == 0 {
+			break
+		}
+
+		last := tier.UpTo == nil || i == len(tiers)-1
+		units := remaining
+		upTo := tier.UpTo
+		if last {
+			upTo = nil
+		} else {
+			units = min(remaining, *tier.UpTo-previous)
+		}
+		if units > 0 {
+			lines = append(lines, priceLine(tierDescription(name, previous, upTo), units, tier.UnitAmount))
+			remaining -= units
+		}
+		if tier.UpTo != nil {
+			previous = *tier.UpTo
+		}
+	}
+
+	return lines
+}
+
+// tierDescription names the units of a tier starting after previous.
+func tierDescription(name string, previous int64, upTo *int64) string {
+	if upTo == nil {
+		return fmt.Sprintf("%s (%d and above)", name, previous+1)
+	}
+	return fmt.Sprintf("%s (%d to %d)", name, previous+1, *upTo)
+}
+
+func priceLine(description string, quantity int64, unitAmount models.Money) models.PriceLine {
+	return models.PriceLine{
+		Description: description,
+		Quantity:    quantity,
+		UnitAmount:  unitAmount,
+		Amount:      unitAmount.MulInt(quantity),
+	}
+}
+
+// periodPrice returns what quantity units, at least one, of product cost a
+// period as a unit amount and a number of units. Per-unit prices keep their
+// units so that prorations show the price of each; other schemes are priced
+// as a whole.
+func periodPrice(product *models.Product, currency string, quantity int) (models.Money, int, error) {
+	quantity = max(quantity, 1)
+	if product.Scheme() == models.PricingSchemePerUnit {
+		price, err := product.PriceIn(currency)
+		return price, quantity, err
+	}
+
+	quote, err := quotePrice(product, currency, int64(quantity))
+	if err != nil {
+		return models.Money{}, 0, err
+	}
+	return quote.Amount, 1, nil
+}
+
+// quantityChange returns what changing the quantity of product from one
+// number of units to another adds to the price of a period, as a unit
+// amount and a number of units. The amount is negative when the price
+// falls.
+func quantityChange(product *models.Product, currency string, from, to int) (models.Money, int, error) {
+	if product.Scheme() == models.PricingSchemePerUnit {
+		price, err := product.PriceIn(currency)
+		if to < from {
+			return price.Neg(), from - to, err
+		}
+		return price, to - from, err
+	}
+
+	oldPrice, _, err := periodPrice(product, currency, from)
+	if err != nil {
+		return models.Money{}, 0, err
+	}
+	newPrice, _, err := periodPrice(product, currency, to)
+	if err != nil {
+		return models.Money{}, 0, err
+	}
+	difference, err := newPrice.Sub(oldPrice)
+	return difference, 1, err
+}
+
+// billItems turns price lines for the product into bill lines of kind for
+// the period [from, to).
+func billItems(kind string, productID int, lines []models.PriceLine, from, to time.Time) []*models.BillItem {
+	items := make([]*models.BillItem, 0, len(lines))
+	for _, line := range lines {
+		items = append(items, &models.BillItem{
+			Kind:        kind,
+			Description: line.Description,
+			Quantity:    int(line.Quantity),
+			UnitAmount:  line.UnitAmount,
+			PeriodStart: &from,
+			PeriodEnd:   &to,
+			ProductID:   &productID,
+		})
+	}
+	return items
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+
 	"github.com/zaher1307/subscription-service/internal/models"
 	"github.com/zaher1307/subscription-service/internal/repositories"
 )
@@ -13,10 +15,38 @@ func NewProductService(productRepo repositories.IProductRepository) *ProductServ
 	return &ProductService{productRepo: productRepo}
 }
 
-func (s *ProductService) GetAllProducts() ([]*models.Product, error) {
-	return s.productRepo.GetAll()
+// GetAllProducts lists the products. Given a currency, it lists only the
+// products sold in it, with their price shown in that currency.
+func (s *ProductService) GetAllProducts(ctx context.Context, currency string) ([]*models.Product, error) {
+	products, err := s.productRepo.GetAll(ctx)
+	if err != nil || currency == "" {
+		return products, err
+	}
+
+	priced := make([]*models.Product, 0, len(products))
+	for _, product := range products {
+		price, err := product.PriceIn(currency)
+		if err != nil {
+			continue
+		}
+		product.Price = price
+		priced = append(priced, product)
+	}
+
+	return priced, nil
+}
+
+func (s *ProductService) GetProductByID(ctx context.Context, id int) (*models.Product, error) {
+	return s.productRepo.GetByID(ctx, id)
 }
 
-func (s *ProductService) GetProductByID(id int) (*models.Product, error) {
-	return s.productRepo.GetByID(id)
+// QuotePrice prices quantity units of a product for one billing period, in
+// currency or else in the product's default currency.
+func (s *ProductService) QuotePrice(ctx context.Context, id int, currency string, quantity int64) (*models.PriceQuote, error) {
+	product, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return quotePrice(product, currency, quantity)
 }
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+// prorate returns the share of amount that covers [from, periodEnd) out of
+// the full [periodStart, periodEnd) billing period, rounded to the nearest
+// minor unit.
+func prorate(amount models.Money, periodStart, periodEnd, from time.Time) models.Money {
+	total := periodEnd.Sub(periodStart)
+	if total < time.Second || !from.Before(periodEnd) {
+		return models.NewMoney(0, amount.Currency)
+	}
+	if from.Before(periodStart) {
+		from = periodStart
+	}
+
+	remaining := periodEnd.Sub(from)
+	return amount.MulRat(int64(remaining/time.Second), int64(total/time.Second))
+}
+
+// prorationItem is a bill line charging, or crediting when amount is
+// negative, part of a billing period of the product for quantity units.
+func prorationItem(description string, productID int, amount models.Money, quantity int, from, to time.Time) *models.BillItem {
+	return &models.BillItem{
+		Kind:        models.BillItemKindProration,
+		Description: description,
+		Quantity:    quantity,
+		UnitAmount:  amount,
+		PeriodStart: &from,
+		PeriodEnd:   &to,
+		ProductID:   &productID,
+	}
+}
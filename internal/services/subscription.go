@@ -1,19 +1,62 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/zaher1307/subscription-service/internal/models"
 	"github.com/zaher1307/subscription-service/internal/repositories"
+	"github.com/zaher1307/subscription-service/internal/tax"
 )
 
+type CancellationMode string
+
+const (
+	// CancelAtPeriodEnd keeps the subscription active until its next
+	// billing date, at which point the billing job ends it.
+	CancelAtPeriodEnd CancellationMode = "at_period_end"
+	// CancelImmediately ends the subscription right away.
+	CancelImmediately CancellationMode = "immediately"
+)
+
+type PlanChangeMode string
+
+const (
+	// PlanChangeImmediately swaps the product now and bills or credits the
+	// prorated price difference for the rest of the current period.
+	PlanChangeImmediately PlanChangeMode = "immediately"
+	// PlanChangeAtRenewal swaps the product when the subscription is next
+	// billed.
+	PlanChangeAtRenewal PlanChangeMode = "at_renewal"
+)
+
+// CreateSubscriptionParams describes a new subscription.
+type CreateSubscriptionParams struct {
+	UserID    int
+	ProductID int
+	// AutoCollect has renewal bills charged to the user's default payment
+	// method by the billing job instead of waiting for a manual payment.
+	AutoCollect bool
+	// CouponCode redeems a coupon whose discount is taken off the initial
+	// bill and the renewal bills it covers.
+	CouponCode string
+	// Currency is the currency the subscription is billed in. It defaults
+	// to the user's preferred currency, then to the product's default one.
+	Currency string
+	// Quantity is the number of units, such as seats, to subscribe to. It
+	// defaults to 1.
+	Quantity int
+}
+
 type SubscriptionService struct {
 	subscriptionRepo repositories.ISubscriptionRepository
 	productRepo      repositories.IProductRepository
 	billRepo         repositories.IBillRepository
 	userRepo         repositories.IUserRepository
+	uow              repositories.IUnitOfWork
+	taxes            *tax.Table
 }
 
 func NewSubscriptionService(
@@ -21,65 +64,551 @@ func NewSubscriptionService(
 	productRepo repositories.IProductRepository,
 	billRepo repositories.IBillRepository,
 	userRepo repositories.IUserRepository,
+	uow repositories.IUnitOfWork,
+	taxes *tax.Table,
 ) *SubscriptionService {
 	return &SubscriptionService{
 		subscriptionRepo: subscriptionRepo,
 		productRepo:      productRepo,
 		billRepo:         billRepo,
 		userRepo:         userRepo,
+		uow:              uow,
+		taxes:            taxes,
 	}
 }
 
-func (s *SubscriptionService) CreateSubscription(userID, productID int) (*models.Subscription, *models.Bill, error) {
-	existingSub, err := s.subscriptionRepo.GetActiveByUserAndProduct(userID, productID)
-	if err != nil {
-		return nil, nil, err
+func (s *SubscriptionService) CreateSubscription(ctx context.Context, params CreateSubscriptionParams) (*models.Subscription, *models.Bill, error) {
+	var subscription *models.Subscription
+	var bill *models.Bill
+
+	if params.Quantity == 0 {
+		params.Quantity = 1
 	}
-	if existingSub != nil {
-		return nil, nil, errors.New("user already has an active subscription for this product")
+	if params.Quantity < 0 {
+		return nil, nil, errors.New("quantity must be at least 1")
 	}
 
-	user, err := s.userRepo.GetByID(userID)
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		existingSub, err := repos.Subscriptions.GetActiveByUserAndProduct(ctx, params.UserID, params.ProductID)
+		if err != nil {
+			return err
+		}
+		if existingSub != nil {
+			return models.ErrSubscriptionExists
+		}
+
+		user, err := repos.Users.GetByID(ctx, params.UserID)
+		if err != nil {
+			return err
+		}
+
+		product, err := repos.Products.GetByID(ctx, params.ProductID)
+		if err != nil {
+			return err
+		}
+		if product.AddOn {
+			return fmt.Errorf("product %d is an add-on and cannot be subscribed to on its own", product.ID)
+		}
+		if product.IsMetered() && params.Quantity != 1 {
+			return errors.New("metered products are billed by usage, not quantity")
+		}
+
+		currency := params.Currency
+		if currency == "" {
+			currency = user.Currency
+		}
+		price, err := product.PriceIn(currency)
+		if err != nil {
+			return err
+		}
+		if _, err := quotePrice(product, price.Currency, int64(params.Quantity)); err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		subscription = &models.Subscription{
+			UserID:          user.ID,
+			ProductID:       product.ID,
+			Currency:        price.Currency,
+			Quantity:        params.Quantity,
+			BillingAnchor:   now,
+			StartDate:       now,
+			NextBillingDate: product.NextBillingDate(now, now),
+			Status:          models.SubscriptionStatusActive,
+			AutoCollect:     params.AutoCollect,
+		}
+
+		if product.TrialDays > 0 {
+			usedTrial, err := repos.Subscriptions.HasUsedTrial(ctx, user.ID, product.ID)
+			if err != nil {
+				return err
+			}
+
+			if !usedTrial {
+				trialEnd := now.AddDate(0, 0, product.TrialDays)
+				subscription.Status = models.SubscriptionStatusTrialing
+				subscription.BillingAnchor = trialEnd
+				subscription.NextBillingDate = trialEnd
+				subscription.TrialEndsAt = &trialEnd
+			}
+		}
+
+		if params.CouponCode != "" {
+			if err := redeemCoupon(ctx, repos, subscription, product, params.CouponCode, now); err != nil {
+				return err
+			}
+		}
+
+		if err := repos.Subscriptions.Create(ctx, subscription); err != nil {
+			return err
+		}
+
+		// A trial is billed by the billing job once it ends, and metered
+		// usage at the end of each period.
+		if subscription.Status == models.SubscriptionStatusTrialing || product.IsMetered() {
+			return nil
+		}
+
+		bill = &models.Bill{
+			SubscriptionID: subscription.ID,
+			Status:         models.BillStatusPaid,
+			PeriodStart:    &now,
+			PaidAt:         &now,
+		}
+		items, err := subscriptionItems(subscription, product, now, subscription.NextBillingDate)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := bill.AddItem(item); err != nil {
+				return err
+			}
+		}
+
+		if err := applyCoupon(ctx, repos, subscription, product, bill); err != nil {
+			return err
+		}
+
+		if err := applyTax(ctx, repos, s.taxes, user, product, bill); err != nil {
+			return err
+		}
+
+		return repos.Bills.Create(ctx, bill)
+	})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	product, err := s.productRepo.GetByID(productID)
+	return subscription, bill, nil
+}
+
+func (s *SubscriptionService) GetSubscription(ctx context.Context, id int) (*models.Subscription, error) {
+	return s.subscriptionRepo.GetByID(ctx, id)
+}
+
+// CancelSubscription ends a subscription either now or at the end of the
+// current period. When cancelling immediately, any pending items are settled
+// on a final adjustment bill and, with prorateCredit set, the unused part of
+// the current paid period is credited on it too.
+func (s *SubscriptionService) CancelSubscription(ctx context.Context, id int, mode CancellationMode, reason string, prorateCredit bool) (*models.Subscription, *models.Bill, error) {
+	var subscription *models.Subscription
+	var final *models.Bill
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		subscription, err = repos.Subscriptions.LockByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if subscription.Status == models.SubscriptionStatusCancelled {
+			return errors.New("subscription is already cancelled")
+		}
+
+		now := time.Now()
+
+		switch mode {
+		case CancelAtPeriodEnd:
+			if prorateCredit {
+				return errors.New("a prorated credit is only available when cancelling immediately")
+			}
+
+			if err := repos.Subscriptions.ScheduleCancellation(ctx, id, reason); err != nil {
+				return err
+			}
+			subscription.CancelAtPeriodEnd = true
+			subscription.CancellationReason = reason
+
+		case CancelImmediately:
+			product, err := repos.Products.GetByID(ctx, subscription.ProductID)
+			if err != nil {
+				return err
+			}
+
+			// Metered usage is billed up to now; a licensed period paid in
+			// advance, add-ons included, can be credited for the time left.
+			var items []*models.BillItem
+			if product.IsMetered() {
+				from, _ := usagePeriod(subscription, product)
+				items, err = usageItems(ctx, repos, subscription, product, from, now)
+				if err != nil {
+					return err
+				}
+			} else if prorateCredit && subscription.Status == models.SubscriptionStatusActive {
+				price, units, err := periodPrice(product, subscription.Currency, subscription.Quantity)
+				if err != nil {
+					return err
+				}
+
+				unused := prorate(price, subscription.StartDate, subscription.NextBillingDate, now)
+				if unused.Amount > 0 {
+					items = append(items, prorationItem("Unused time on "+product.Name, product.ID, unused.Neg(), units, now, subscription.NextBillingDate))
+				}
+
+				credits, err := addOnCredits(ctx, repos, subscription, now)
+				if err != nil {
+					return err
+				}
+				items = append(items, credits...)
+			}
+
+			final, err = createFinalBill(ctx, repos, subscription, items...)
+			if err != nil {
+				return err
+			}
+
+			// A renewal still waiting for payment can no longer be paid
+			// once the subscription is cancelled.
+			if err := repos.Bills.MarkOpenUncollectible(ctx, id); err != nil {
+				return err
+			}
+
+			if err := repos.Subscriptions.Cancel(ctx, id, now, reason); err != nil {
+				return err
+			}
+			subscription.Status = models.SubscriptionStatusCancelled
+			subscription.CancelAtPeriodEnd = false
+			subscription.CancelledAt = &now
+			subscription.CancellationReason = reason
+
+		default:
+			return fmt.Errorf("unknown cancellation mode %q", mode)
+		}
+
+		return nil
+	})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	now := time.Now()
-	nextMonth := now.AddDate(0, 1, 0)
+	return subscription, final, nil
+}
+
+// PauseSubscription stops billing for an active subscription. If resumeAt
+// is set the billing job resumes it automatically at that time.
+func (s *SubscriptionService) PauseSubscription(ctx context.Context, id int, resumeAt *time.Time) (*models.Subscription, error) {
+	var subscription *models.Subscription
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		subscription, err = repos.Subscriptions.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if subscription.Status != models.SubscriptionStatusActive {
+			return fmt.Errorf("only active subscriptions can be paused, subscription is %s", subscription.Status)
+		}
+
+		now := time.Now()
+		if resumeAt != nil && !resumeAt.After(now) {
+			return errors.New("resume date must be in the future")
+		}
+
+		if err := repos.Subscriptions.Pause(ctx, id, now, resumeAt); err != nil {
+			return err
+		}
+		subscription.Status = models.SubscriptionStatusPaused
+		subscription.PausedAt = &now
+		subscription.ResumeAt = resumeAt
 
-	subscription := &models.Subscription{
-		UserID:          user.ID,
-		ProductID:       product.ID,
-		StartDate:       now,
-		NextBillingDate: nextMonth,
-		Status:          "active",
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.subscriptionRepo.Create(subscription); err != nil {
-		return nil, nil, err
+	return subscription, nil
+}
+
+func (s *SubscriptionService) ResumeSubscription(ctx context.Context, id int) (*models.Subscription, error) {
+	var subscription *models.Subscription
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		subscription, err = repos.Subscriptions.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if subscription.Status != models.SubscriptionStatusPaused {
+			return errors.New("subscription is not paused")
+		}
+
+		return resumeSubscription(ctx, repos, subscription, time.Now())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// resumeSubscription reactivates a paused subscription at the given time,
+// shifting the current period by however long it was paused so the
+// customer is not billed for the paused days. A metered period keeps its
+// start, so usage reported before the pause is still billed with it.
+func resumeSubscription(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, at time.Time) error {
+	var paused time.Duration
+	if subscription.PausedAt != nil && at.After(*subscription.PausedAt) {
+		paused = at.Sub(*subscription.PausedAt)
 	}
 
-	bill := &models.Bill{
-		SubscriptionID: subscription.ID,
-		Amount:         product.Price,
-		Status:         "paid",
-		PaidAt:         &now,
+	product, err := repos.Products.GetByID(ctx, subscription.ProductID)
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("bill: %#v\n", bill)
+	billingAnchor := subscription.BillingAnchor.Add(paused)
+	startDate := subscription.StartDate
+	if !product.IsMetered() {
+		startDate = startDate.Add(paused)
+	}
+	nextBillingDate := subscription.NextBillingDate.Add(paused)
+	if err := repos.Subscriptions.Resume(ctx, subscription.ID, billingAnchor, startDate, nextBillingDate); err != nil {
+		return err
+	}
+
+	subscription.Status = models.SubscriptionStatusActive
+	subscription.BillingAnchor = billingAnchor
+	subscription.StartDate = startDate
+	subscription.NextBillingDate = nextBillingDate
+	subscription.PausedAt = nil
+	subscription.ResumeAt = nil
+
+	return nil
+}
+
+// ChangePlan moves a subscription to another product, either immediately
+// or at its next renewal. An immediate change returns the adjustment bill
+// for the prorated difference, which is a credit when downgrading.
+func (s *SubscriptionService) ChangePlan(ctx context.Context, id, productID int, mode PlanChangeMode) (*models.Subscription, *models.Bill, error) {
+	var subscription *models.Subscription
+	var adjustment *models.Bill
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		subscription, err = repos.Subscriptions.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if subscription.Status == models.SubscriptionStatusCancelled {
+			return errors.New("subscription is cancelled")
+		}
+		if subscription.ProductID == productID {
+			return errors.New("subscription is already on this product")
+		}
+
+		existingSub, err := repos.Subscriptions.GetActiveByUserAndProduct(ctx, subscription.UserID, productID)
+		if err != nil {
+			return err
+		}
+		if existingSub != nil {
+			return models.ErrSubscriptionExists
+		}
+
+		newProduct, err := repos.Products.GetByID(ctx, productID)
+		if err != nil {
+			return err
+		}
+		newPrice, newUnits, err := periodPrice(newProduct, subscription.Currency, subscription.Quantity)
+		if err != nil {
+			return err
+		}
+
+		oldProduct, err := repos.Products.GetByID(ctx, subscription.ProductID)
+		if err != nil {
+			return err
+		}
+		if oldProduct.IsMetered() || newProduct.IsMetered() {
+			return errors.New("plan changes are not available for metered products")
+		}
+		if newProduct.AddOn {
+			return fmt.Errorf("product %d is an add-on and cannot be subscribed to on its own", newProduct.ID)
+		}
+		if newProduct.BillingInterval != oldProduct.BillingInterval || newProduct.BillingIntervalCount != oldProduct.BillingIntervalCount {
+			addOns, err := repos.AddOns.GetBySubscriptionID(ctx, subscription.ID)
+			if err != nil {
+				return err
+			}
+			if len(addOns) > 0 {
+				return errors.New("add-ons must be removed before changing to a plan billed on a different cycle")
+			}
+		}
+
+		switch mode {
+		case PlanChangeAtRenewal:
+			if err := repos.Subscriptions.SchedulePlanChange(ctx, id, &newProduct.ID); err != nil {
+				return err
+			}
+			subscription.PendingProductID = &newProduct.ID
 
-	if err := s.billRepo.Create(bill); err != nil {
+		case PlanChangeImmediately:
+			if subscription.Status != models.SubscriptionStatusActive {
+				return fmt.Errorf("only active subscriptions can change plan immediately, subscription is %s", subscription.Status)
+			}
+
+			oldPrice, oldUnits, err := periodPrice(oldProduct, subscription.Currency, subscription.Quantity)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			unused := prorate(oldPrice, subscription.StartDate, subscription.NextBillingDate, now)
+			remaining := prorate(newPrice, subscription.StartDate, subscription.NextBillingDate, now)
+			difference, err := remaining.MulInt(int64(newUnits)).Sub(unused.MulInt(int64(oldUnits)))
+			if err != nil {
+				return err
+			}
+
+			if !difference.IsZero() {
+				adjustment = &models.Bill{
+					SubscriptionID: subscription.ID,
+					Type:           models.BillTypeAdjustment,
+					Status:         models.BillStatusPending,
+				}
+				if difference.IsNegative() {
+					adjustment.Status = models.BillStatusCredit
+				}
+
+				items := []*models.BillItem{
+					prorationItem("Unused time on "+oldProduct.Name, oldProduct.ID, unused.Neg(), oldUnits, now, subscription.NextBillingDate),
+					prorationItem("Remaining time on "+newProduct.Name, newProduct.ID, remaining, newUnits, now, subscription.NextBillingDate),
+				}
+				for _, item := range items {
+					if item.UnitAmount.IsZero() {
+						continue
+					}
+					if err := adjustment.AddItem(item); err != nil {
+						return err
+					}
+				}
+
+				if err := repos.Bills.Create(ctx, adjustment); err != nil {
+					return err
+				}
+				if adjustment.Status == models.BillStatusCredit {
+					if err := creditBalance(ctx, repos, subscription, adjustment); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := repos.Subscriptions.ChangeProduct(ctx, id, newProduct.ID); err != nil {
+				return err
+			}
+			subscription.ProductID = newProduct.ID
+			subscription.PendingProductID = nil
+
+		default:
+			return fmt.Errorf("unknown plan change mode %q", mode)
+		}
+
+		return nil
+	})
+	if err != nil {
 		return nil, nil, err
 	}
 
-	return subscription, bill, nil
+	return subscription, adjustment, nil
 }
 
-func (s *SubscriptionService) GetSubscription(id int) (*models.Subscription, error) {
-	return s.subscriptionRepo.GetByID(id)
+// ChangeQuantity sets the number of units the subscription pays for. On an
+// active subscription the prorated difference for the rest of the current
+// period is returned as a pending item, charged or credited on the next
+// bill; a trialing subscription has nothing to prorate.
+func (s *SubscriptionService) ChangeQuantity(ctx context.Context, id, quantity int) (*models.Subscription, *models.PendingItem, error) {
+	if quantity < 1 {
+		return nil, nil, errors.New("quantity must be at least 1")
+	}
+
+	var subscription *models.Subscription
+	var adjustment *models.PendingItem
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		subscription, err = repos.Subscriptions.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if subscription.Status != models.SubscriptionStatusActive && subscription.Status != models.SubscriptionStatusTrialing {
+			return fmt.Errorf("only active or trialing subscriptions can change quantity, subscription is %s", subscription.Status)
+		}
+		if subscription.Quantity == quantity {
+			return errors.New("subscription already has this quantity")
+		}
+
+		product, err := repos.Products.GetByID(ctx, subscription.ProductID)
+		if err != nil {
+			return err
+		}
+		if product.IsMetered() {
+			return errors.New("metered subscriptions are billed by usage and have no quantity")
+		}
+
+		if subscription.Status == models.SubscriptionStatusActive {
+			change, units, err := quantityChange(product, subscription.Currency, subscription.Quantity, quantity)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			remaining := prorate(change, subscription.StartDate, subscription.NextBillingDate, now)
+			if !remaining.IsZero() {
+				periodEnd := subscription.NextBillingDate
+				adjustment = &models.PendingItem{
+					SubscriptionID: subscription.ID,
+					Kind:           models.BillItemKindProration,
+					Description:    "Remaining time on " + product.Name,
+					Quantity:       units,
+					UnitAmount:     remaining,
+					PeriodStart:    &now,
+					PeriodEnd:      &periodEnd,
+					ProductID:      &product.ID,
+				}
+				if remaining.IsNegative() {
+					adjustment.Description = "Unused time on " + product.Name
+				}
+
+				if err := repos.PendingItems.Create(ctx, adjustment); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := repos.Subscriptions.UpdateQuantity(ctx, id, quantity); err != nil {
+			return err
+		}
+		subscription.Quantity = quantity
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return subscription, adjustment, nil
 }
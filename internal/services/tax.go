@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+	"github.com/zaher1307/subscription-service/internal/tax"
+)
+
+// applyTax adds the tax due on a bill for product to it, worked out from the
+// user's billing address and tax ID. Each line is taxed at the rate for the
+// tax category of the product it is for, such as an add-on; lines for no
+// product in particular, such as discounts, are taxed as product. It does
+// nothing without a tax table.
+func applyTax(ctx context.Context, repos *repositories.Repositories, taxes *tax.Table, user *models.User, product *models.Product, bill *models.Bill) error {
+	if taxes == nil {
+		return nil
+	}
+
+	// Lines are totalled per category, in the order the categories first
+	// appear on the bill.
+	categories := map[int]string{product.ID: product.TaxCategory}
+	var order []string
+	totals := make(map[string]models.Money)
+	for _, item := range bill.Items {
+		productID := product.ID
+		if item.ProductID != nil {
+			productID = *item.ProductID
+		}
+		category, ok := categories[productID]
+		if !ok {
+			itemProduct, err := repos.Products.GetByID(ctx, productID)
+			if err != nil {
+				return err
+			}
+			category = itemProduct.TaxCategory
+			categories[productID] = category
+		}
+		if category == "" {
+			category = models.TaxCategoryStandard
+		}
+
+		total, ok := totals[category]
+		if !ok {
+			order = append(order, category)
+			total = models.NewMoney(0, item.Amount.Currency)
+		}
+		total, err := total.Add(item.Amount)
+		if err != nil {
+			return err
+		}
+		totals[category] = total
+	}
+
+	// Categories taxed at the same rate share a line.
+	var items []*models.BillItem
+	for _, category := range order {
+		line := taxes.Calculate(tax.Request{
+			Address:  user.BillingAddress,
+			TaxID:    user.TaxID,
+			Category: category,
+			Amount:   totals[category],
+		})
+		if line == nil || (line.Amount.IsZero() && !line.ReverseCharge) {
+			continue
+		}
+
+		item := &models.BillItem{
+			Kind:        models.BillItemKindTax,
+			Description: line.Description(),
+			Quantity:    1,
+			UnitAmount:  line.Amount,
+			Inclusive:   line.Inclusive,
+		}
+		merged := false
+		for _, existing := range items {
+			if existing.Description == item.Description && existing.Inclusive == item.Inclusive {
+				amount, err := existing.UnitAmount.Add(item.UnitAmount)
+				if err != nil {
+					return err
+				}
+				existing.UnitAmount = amount
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			items = append(items, item)
+		}
+	}
+
+	for _, item := range items {
+		if err := bill.AddItem(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
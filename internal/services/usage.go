@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/repositories"
+)
+
+// usageClockSkew is how far in the future a usage timestamp may be, to
+// allow for clients whose clocks run slightly ahead.
+const usageClockSkew = 5 * time.Minute
+
+type UsageService struct {
+	uow repositories.IUnitOfWork
+}
+
+func NewUsageService(uow repositories.IUnitOfWork) *UsageService {
+	return &UsageService{uow: uow}
+}
+
+// RecordUsage saves a usage record for a subscription to a metered product,
+// timestamped now unless the record has a timestamp. Reporting a record
+// again with the same idempotency key returns the saved one with created
+// false instead of counting it twice.
+func (s *UsageService) RecordUsage(ctx context.Context, record *models.UsageRecord) (*models.UsageRecord, bool, error) {
+	record.IdempotencyKey = strings.TrimSpace(record.IdempotencyKey)
+	if record.IdempotencyKey == "" {
+		return nil, false, errors.New("idempotency key is required")
+	}
+	if record.Quantity < 0 {
+		return nil, false, errors.New("quantity must not be negative")
+	}
+
+	now := time.Now()
+	timestamped := !record.Timestamp.IsZero()
+	if !timestamped {
+		record.Timestamp = now
+	}
+	record.Timestamp = record.Timestamp.UTC().Truncate(time.Microsecond)
+
+	var saved *models.UsageRecord
+	var created bool
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		// The subscription stays as read until the record is saved, so
+		// billing cannot close the period in between and miss the record.
+		subscription, err := repos.Subscriptions.ShareLockByID(ctx, record.SubscriptionID)
+		if err != nil {
+			return err
+		}
+		product, err := meteredProduct(ctx, repos, subscription)
+		if err != nil {
+			return err
+		}
+
+		switch subscription.Status {
+		case models.SubscriptionStatusActive, models.SubscriptionStatusTrialing,
+			models.SubscriptionStatusHold, models.SubscriptionStatusPastDue:
+		default:
+			return fmt.Errorf("usage cannot be reported for a %s subscription", subscription.Status)
+		}
+
+		periodStart, _ := usagePeriod(subscription, product)
+		if record.Timestamp.Before(periodStart) {
+			return errors.New("usage timestamp is in a period that has already been billed")
+		}
+		if record.Timestamp.After(now.Add(usageClockSkew)) {
+			return errors.New("usage timestamp is in the future")
+		}
+
+		saved, created, err = repos.Usage.Create(ctx, record)
+		if err != nil {
+			return err
+		}
+		if !created && (saved.Quantity != record.Quantity || (timestamped && !saved.Timestamp.Equal(record.Timestamp))) {
+			return models.ErrUsageKeyReused
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return saved, created, nil
+}
+
+// GetUsage returns a subscription's usage over the period that will be
+// billed next.
+func (s *UsageService) GetUsage(ctx context.Context, subscriptionID int) (*models.UsageSummary, error) {
+	var summary *models.UsageSummary
+
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		subscription, err := repos.Subscriptions.GetByID(ctx, subscriptionID)
+		if err != nil {
+			return err
+		}
+		product, err := meteredProduct(ctx, repos, subscription)
+		if err != nil {
+			return err
+		}
+
+		summary = &models.UsageSummary{Aggregation: product.UsageAggregation}
+		if summary.Aggregation == "" {
+			summary.Aggregation = models.UsageAggregationSum
+		}
+		summary.PeriodStart, summary.PeriodEnd = usagePeriod(subscription, product)
+
+		summary.Records, err = repos.Usage.GetForPeriod(ctx, subscriptionID, summary.PeriodStart, summary.PeriodEnd)
+		if err != nil {
+			return err
+		}
+		summary.Quantity, err = repos.Usage.Aggregate(ctx, subscriptionID, summary.Aggregation, summary.PeriodStart, summary.PeriodEnd)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// meteredProduct returns the subscription's product, provided it is
+// metered.
+func meteredProduct(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription) (*models.Product, error) {
+	product, err := repos.Products.GetByID(ctx, subscription.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if !product.IsMetered() {
+		return nil, fmt.Errorf("subscription %d is not for a metered product", subscription.ID)
+	}
+
+	return product, nil
+}
+
+// usagePeriod returns the period whose usage is billed next. Once a
+// subscription has been billed for its current period and is waiting for
+// payment, that is the period after it.
+func usagePeriod(subscription *models.Subscription, product *models.Product) (time.Time, time.Time) {
+	switch subscription.Status {
+	case models.SubscriptionStatusHold, models.SubscriptionStatusPastDue, models.SubscriptionStatusUnpaid:
+		start := subscription.NextBillingDate
+		return start, product.NextBillingDate(subscription.BillingAnchor, start)
+	default:
+		return subscription.StartDate, subscription.NextBillingDate
+	}
+}
+
+// usageItems returns the bill lines for the subscription's usage of a
+// metered product between from and to. Usage during a trial is free.
+func usageItems(ctx context.Context, repos *repositories.Repositories, subscription *models.Subscription, product *models.Product, from, to time.Time) ([]*models.BillItem, error) {
+	if subscription.Status == models.SubscriptionStatusTrialing || !from.Before(to) {
+		return nil, nil
+	}
+
+	quantity, err := repos.Usage.Aggregate(ctx, subscription.ID, product.UsageAggregation, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return priceUsage(product, subscription.Currency, quantity, from, to)
+}
+
+// priceUsage prices quantity units of a metered product's usage under its
+// pricing scheme. A period without usage costs nothing.
+func priceUsage(product *models.Product, currency string, quantity int64, from, to time.Time) ([]*models.BillItem, error) {
+	if quantity == 0 {
+		return nil, nil
+	}
+
+	lines, err := priceLines(product, product.Name+" usage", currency, quantity)
+	if err != nil {
+		return nil, err
+	}
+	return billItems(models.BillItemKindUsage, product.ID, lines, from, to), nil
+}
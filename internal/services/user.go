@@ -1,6 +1,9 @@
 package services
 
 import (
+	"context"
+	"strings"
+
 	"github.com/zaher1307/subscription-service/internal/models"
 	"github.com/zaher1307/subscription-service/internal/repositories"
 )
@@ -13,10 +16,39 @@ func NewUserService(userRepo repositories.IUserRepository) *UserService {
 	return &UserService{userRepo: userRepo}
 }
 
-func (s *UserService) CreateUser(user *models.User) error {
-	return s.userRepo.Create(user)
+func (s *UserService) CreateUser(ctx context.Context, user *models.User) error {
+	user.Currency = strings.ToUpper(user.Currency)
+	normalizeBillingDetails(user)
+	return s.userRepo.Create(ctx, user)
+}
+
+func (s *UserService) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	return s.userRepo.GetByID(ctx, id)
+}
+
+// UpdateBillingDetails sets the billing address and tax ID that taxes on the
+// user's bills are worked out from. A nil address removes it.
+func (s *UserService) UpdateBillingDetails(ctx context.Context, id int, address *models.Address, taxID string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.BillingAddress = address
+	user.TaxID = taxID
+	normalizeBillingDetails(user)
+
+	if err := s.userRepo.UpdateBillingDetails(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
 
-func (s *UserService) GetUserByID(id int) (*models.User, error) {
-	return s.userRepo.GetByID(id)
+func normalizeBillingDetails(user *models.User) {
+	user.TaxID = strings.ToUpper(strings.ReplaceAll(user.TaxID, " ", ""))
+	if user.BillingAddress != nil {
+		user.BillingAddress.Country = strings.ToUpper(user.BillingAddress.Country)
+		user.BillingAddress.Region = strings.ToUpper(user.BillingAddress.Region)
+	}
 }
@@ -0,0 +1,220 @@
+// Package tax works out the VAT or sales tax due on a bill from a locally
+// configured table of rates.
+package tax
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+// Percent is a tax rate with up to three decimals, kept in thousandths of a
+// percent so that 8.875% is 8875. In JSON it is written as a number or a
+// string, e.g. 19 or "8.875".
+type Percent int64
+
+const percentScale = 1000
+
+func ParsePercent(value string) (Percent, error) {
+	value = strings.TrimSpace(value)
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || len(fraction) > 3 || strings.HasPrefix(whole, "-") {
+		return 0, fmt.Errorf("invalid tax rate %q", value)
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tax rate %q", value)
+	}
+
+	var thousandths int64
+	if fraction != "" {
+		thousandths, err = strconv.ParseInt(fraction+strings.Repeat("0", 3-len(fraction)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid tax rate %q", value)
+		}
+	}
+
+	p := Percent(units*percentScale + thousandths)
+	if p > 100*percentScale {
+		return 0, fmt.Errorf("invalid tax rate %q: more than 100%%", value)
+	}
+	return p, nil
+}
+
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	parsed, err := ParsePercent(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(p.String())), nil
+}
+
+// String formats p without trailing zeros, e.g. "19" or "8.875".
+func (p Percent) String() string {
+	s := fmt.Sprintf("%d.%03d", p/percentScale, p%percentScale)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// Rate is the tax charged in a country, or one of its regions, on products
+// of a category. Empty Region and Category fields match any region and any
+// category.
+type Rate struct {
+	Country  string  `json:"country"`
+	Region   string  `json:"region,omitempty"`
+	Category string  `json:"category,omitempty"`
+	Name     string  `json:"name"`
+	Rate     Percent `json:"rate"`
+	// Inclusive rates are already contained in the product's price;
+	// exclusive ones are added on top of it.
+	Inclusive bool `json:"inclusive"`
+	// ReverseCharge lets business customers with a tax ID outside the
+	// seller's country account for the tax themselves.
+	ReverseCharge bool `json:"reverse_charge"`
+}
+
+// Table is the locally configured set of tax rates.
+type Table struct {
+	SellerCountry string `json:"seller_country"`
+	Rates         []Rate `json:"rates"`
+}
+
+// Load reads a Table from a JSON file.
+func Load(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Table, error) {
+	var table Table
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("invalid tax table: %w", err)
+	}
+
+	table.SellerCountry = strings.ToUpper(table.SellerCountry)
+	if len(table.SellerCountry) != 2 {
+		return nil, errors.New("invalid tax table: seller_country must be a two-letter country code")
+	}
+
+	for i := range table.Rates {
+		rate := &table.Rates[i]
+		rate.Country = strings.ToUpper(rate.Country)
+		rate.Region = strings.ToUpper(rate.Region)
+		if len(rate.Country) != 2 {
+			return nil, fmt.Errorf("invalid tax table: rate %d has no two-letter country code", i+1)
+		}
+		if rate.Name == "" {
+			return nil, fmt.Errorf("invalid tax table: rate %d has no name", i+1)
+		}
+	}
+
+	return &table, nil
+}
+
+// Lookup returns the most specific rate for the address and tax category.
+// A rate for the region beats one for the whole country, and a rate for the
+// category beats one for any category.
+func (t *Table) Lookup(address models.Address, category string) (Rate, bool) {
+	var best Rate
+	bestScore := -1
+	for _, rate := range t.Rates {
+		if rate.Country != strings.ToUpper(address.Country) {
+			continue
+		}
+		if rate.Region != "" && rate.Region != strings.ToUpper(address.Region) {
+			continue
+		}
+		if rate.Category != "" && rate.Category != category {
+			continue
+		}
+
+		score := 0
+		if rate.Region != "" {
+			score += 2
+		}
+		if rate.Category != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rate, score
+		}
+	}
+
+	return best, bestScore >= 0
+}
+
+// Request describes an amount to be taxed.
+type Request struct {
+	Address  *models.Address
+	TaxID    string
+	Category string
+	Amount   models.Money
+}
+
+// Line is the tax due on a Request.
+type Line struct {
+	Name          string
+	Rate          Percent
+	Amount        models.Money
+	Inclusive     bool
+	ReverseCharge bool
+}
+
+// Description is how the line reads on a bill, e.g. "VAT 19%" or
+// "VAT reverse charge".
+func (l *Line) Description() string {
+	if l.ReverseCharge {
+		return l.Name + " reverse charge"
+	}
+	return fmt.Sprintf("%s %s%%", l.Name, l.Rate)
+}
+
+// Calculate returns the tax due on req, or nil when none is: the table is
+// nil, the customer has no billing address or no rate covers it.
+func (t *Table) Calculate(req Request) *Line {
+	if t == nil || req.Address == nil {
+		return nil
+	}
+
+	category := req.Category
+	if category == "" {
+		category = models.TaxCategoryStandard
+	}
+
+	rate, ok := t.Lookup(*req.Address, category)
+	if !ok {
+		return nil
+	}
+
+	line := &Line{
+		Name:      rate.Name,
+		Rate:      rate.Rate,
+		Inclusive: rate.Inclusive,
+	}
+
+	if rate.ReverseCharge && req.TaxID != "" && rate.Country != t.SellerCountry {
+		line.ReverseCharge = true
+		line.Amount = models.NewMoney(0, req.Amount.Currency)
+		return line
+	}
+
+	if rate.Inclusive {
+		line.Amount = req.Amount.MulRat(int64(rate.Rate), 100*percentScale+int64(rate.Rate))
+	} else {
+		line.Amount = req.Amount.MulRat(int64(rate.Rate), 100*percentScale)
+	}
+	return line
+}
@@ -3,6 +3,14 @@ CREATE TABLE
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     email VARCHAR(100) UNIQUE NOT NULL,
+    currency CHAR(3),
+    billing_line1 VARCHAR(255),
+    billing_line2 VARCHAR(255),
+    billing_city VARCHAR(100),
+    billing_region VARCHAR(100),
+    billing_postal_code VARCHAR(20),
+    billing_country CHAR(2),
+    tax_id VARCHAR(50),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
   );
 
@@ -11,27 +19,264 @@ CREATE TABLE
     id SERIAL PRIMARY KEY,
     name VARCHAR(100) NOT NULL,
     description TEXT,
-    price DECIMAL(10, 2) NOT NULL,
+    price BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    billing_interval VARCHAR(10) NOT NULL DEFAULT 'month' CHECK (billing_interval IN ('week', 'month', 'year')),
+    billing_interval_count INTEGER NOT NULL DEFAULT 1 CHECK (billing_interval_count > 0),
+    trial_days INTEGER NOT NULL DEFAULT 0,
+    dunning_schedule TEXT,
+    tax_category VARCHAR(50) NOT NULL DEFAULT 'standard',
+    usage_type VARCHAR(10) NOT NULL DEFAULT 'licensed' CHECK (usage_type IN ('licensed', 'metered')),
+    add_on BOOLEAN NOT NULL DEFAULT FALSE,
+    usage_aggregation VARCHAR(10) CHECK (usage_aggregation IN ('sum', 'max', 'last')),
+    pricing_scheme VARCHAR(20) NOT NULL DEFAULT 'per_unit' CHECK (pricing_scheme IN ('flat', 'per_unit', 'graduated', 'volume', 'package')),
+    package_size INTEGER CHECK (package_size > 0),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
   );
 
+CREATE TABLE
+  IF NOT EXISTS product_prices (
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    currency CHAR(3) NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (product_id, currency)
+  );
+
+CREATE TABLE
+  IF NOT EXISTS product_price_tiers (
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    currency CHAR(3) NOT NULL,
+    up_to BIGINT CHECK (up_to > 0),
+    unit_amount BIGINT NOT NULL CHECK (unit_amount >= 0),
+    UNIQUE (product_id, currency, up_to)
+  );
+
+CREATE TABLE
+  IF NOT EXISTS coupons (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    discount_type VARCHAR(10) NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    percent_off INTEGER CHECK (percent_off BETWEEN 1 AND 100),
+    amount_off BIGINT CHECK (amount_off > 0),
+    currency CHAR(3),
+    duration VARCHAR(10) NOT NULL CHECK (duration IN ('once', 'repeating', 'forever')),
+    duration_cycles INTEGER CHECK (duration_cycles > 0),
+    max_redemptions INTEGER CHECK (max_redemptions > 0),
+    times_redeemed INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE TABLE
+  IF NOT EXISTS coupon_products (
+    coupon_id INTEGER NOT NULL REFERENCES coupons (id),
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    PRIMARY KEY (coupon_id, product_id)
+  );
+
 CREATE TABLE
   IF NOT EXISTS subscriptions (
     id SERIAL PRIMARY KEY,
     user_id INTEGER REFERENCES users (id),
     product_id INTEGER REFERENCES products (id),
+    currency CHAR(3) NOT NULL,
+    pending_product_id INTEGER REFERENCES products (id),
+    billing_anchor TIMESTAMP NOT NULL,
     start_date TIMESTAMP NOT NULL,
     next_billing_date TIMESTAMP NOT NULL,
     status VARCHAR(20) DEFAULT 'active',
+    trial_ends_at TIMESTAMP,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    cancelled_at TIMESTAMP,
+    cancellation_reason TEXT,
+    paused_at TIMESTAMP,
+    resume_at TIMESTAMP,
+    auto_collect BOOLEAN NOT NULL DEFAULT FALSE,
+    coupon_id INTEGER REFERENCES coupons (id),
+    coupon_cycles_left INTEGER,
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
   );
 
+CREATE TABLE
+  IF NOT EXISTS subscription_add_ons (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (subscription_id, product_id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_one_trial_per_product ON subscriptions (user_id, product_id)
+WHERE
+  trial_ends_at IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_one_per_product ON subscriptions (user_id, product_id)
+WHERE
+  status <> 'cancelled';
+
 CREATE TABLE
   IF NOT EXISTS bills (
     id SERIAL PRIMARY KEY,
     subscription_id INTEGER REFERENCES subscriptions (id),
-    amount DECIMAL(10, 2) NOT NULL,
+    type VARCHAR(20) NOT NULL DEFAULT 'subscription',
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'USD',
+    discount BIGINT NOT NULL DEFAULT 0,
+    coupon_id INTEGER REFERENCES coupons (id),
+    tax BIGINT NOT NULL DEFAULT 0,
+    credit_applied BIGINT NOT NULL DEFAULT 0,
+    amount_refunded BIGINT NOT NULL DEFAULT 0,
     status VARCHAR(20) DEFAULT 'pending',
+    period_start TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    paid_at TIMESTAMP,
+    UNIQUE (subscription_id, period_start)
+  );
+
+CREATE TABLE
+  IF NOT EXISTS bill_items (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('subscription', 'add_on', 'proration', 'discount', 'tax', 'usage')),
+    description TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1,
+    unit_amount BIGINT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    period_start TIMESTAMP,
+    period_end TIMESTAMP,
+    inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+    product_id INTEGER REFERENCES products (id)
+  );
+
+CREATE INDEX IF NOT EXISTS bill_items_bill_id ON bill_items (bill_id);
+
+CREATE TABLE
+  IF NOT EXISTS pending_items (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('subscription', 'add_on', 'proration', 'discount', 'tax', 'usage')),
+    description TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1,
+    unit_amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    period_start TIMESTAMP,
+    period_end TIMESTAMP,
+    bill_id INTEGER REFERENCES bills (id),
+    product_id INTEGER REFERENCES products (id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS pending_items_unbilled ON pending_items (subscription_id)
+WHERE
+  bill_id IS NULL;
+
+CREATE TABLE
+  IF NOT EXISTS dunning_attempts (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    step INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (bill_id, step)
+  );
+
+CREATE TABLE
+  IF NOT EXISTS payment_attempts (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    provider VARCHAR(50) NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    provider_reference VARCHAR(255),
+    failure_code VARCHAR(50),
+    started_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS payment_attempts_bill_id ON payment_attempts (bill_id);
+
+CREATE TABLE
+  IF NOT EXISTS payment_methods (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    type VARCHAR(20) NOT NULL CHECK (type IN ('card', 'bank_account')),
+    token VARCHAR(255) NOT NULL,
+    last4 CHAR(4) NOT NULL,
+    exp_month INTEGER,
+    exp_year INTEGER,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS payment_methods_one_default_per_user ON payment_methods (user_id)
+WHERE
+  is_default;
+
+CREATE TABLE
+  IF NOT EXISTS credit_notes (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    currency CHAR(3) NOT NULL,
+    reason TEXT,
+    provider_reference VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS credit_notes_bill_id ON credit_notes (bill_id);
+
+CREATE TABLE
+  IF NOT EXISTS balance_entries (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    reason TEXT NOT NULL,
+    bill_id INTEGER REFERENCES bills (id),
+    subscription_id INTEGER REFERENCES subscriptions (id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS balance_entries_user_id ON balance_entries (user_id);
+
+CREATE TABLE
+  IF NOT EXISTS usage_records (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    idempotency_key VARCHAR(255) NOT NULL,
+    quantity BIGINT NOT NULL CHECK (quantity >= 0),
+    timestamp TIMESTAMP NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    paid_at TIMESTAMP
+    UNIQUE (subscription_id, idempotency_key)
   );
+
+CREATE INDEX IF NOT EXISTS usage_records_subscription_timestamp ON usage_records (subscription_id, timestamp);
+
+CREATE TABLE
+  IF NOT EXISTS billing_runs (
+    id SERIAL PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'completed', 'failed')),
+    lock_holder VARCHAR(255) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    error TEXT,
+    subscriptions_scanned INTEGER NOT NULL DEFAULT 0,
+    bills_created INTEGER NOT NULL DEFAULT 0,
+    already_billed INTEGER NOT NULL DEFAULT 0
+  );
+
+CREATE INDEX IF NOT EXISTS billing_runs_started_at ON billing_runs (started_at);
+
+CREATE TABLE
+  IF NOT EXISTS billing_run_failures (
+    id SERIAL PRIMARY KEY,
+    billing_run_id INTEGER NOT NULL REFERENCES billing_runs (id),
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    reason TEXT NOT NULL
+  );
+
+CREATE INDEX IF NOT EXISTS billing_run_failures_billing_run_id ON billing_run_failures (billing_run_id);
@@ -0,0 +1,33 @@
+-- Converts product prices and bill amounts from DECIMAL(10, 2) major units
+-- to BIGINT minor units with an explicit ISO 4217 currency. Existing rows
+-- are assumed to be in USD. Safe to run more than once.
+BEGIN;
+
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE bills
+ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+DO $$
+BEGIN
+  IF (
+    SELECT data_type
+    FROM information_schema.columns
+    WHERE table_name = 'products' AND column_name = 'price'
+  ) = 'numeric' THEN
+    ALTER TABLE products
+    ALTER COLUMN price TYPE BIGINT USING ROUND(price * 100);
+  END IF;
+
+  IF (
+    SELECT data_type
+    FROM information_schema.columns
+    WHERE table_name = 'bills' AND column_name = 'amount'
+  ) = 'numeric' THEN
+    ALTER TABLE bills
+    ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100);
+  END IF;
+END $$;
+
+COMMIT;
@@ -0,0 +1,4 @@
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS cancellation_reason TEXT;
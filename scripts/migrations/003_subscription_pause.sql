@@ -0,0 +1,3 @@
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS paused_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS resume_at TIMESTAMP;
@@ -0,0 +1,9 @@
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS pending_product_id INTEGER REFERENCES products (id);
+
+ALTER TABLE bills
+ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'subscription';
+
+UPDATE bills
+SET type = 'adjustment'
+WHERE status = 'credit';
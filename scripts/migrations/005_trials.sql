@@ -0,0 +1,9 @@
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS trial_days INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS trial_ends_at TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_one_trial_per_product ON subscriptions (user_id, product_id)
+WHERE
+  trial_ends_at IS NOT NULL;
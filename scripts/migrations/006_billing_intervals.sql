@@ -0,0 +1,17 @@
+BEGIN;
+
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS billing_interval VARCHAR(10) NOT NULL DEFAULT 'month' CHECK (billing_interval IN ('week', 'month', 'year')),
+ADD COLUMN IF NOT EXISTS billing_interval_count INTEGER NOT NULL DEFAULT 1 CHECK (billing_interval_count > 0);
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS billing_anchor TIMESTAMP;
+
+UPDATE subscriptions
+SET billing_anchor = start_date
+WHERE billing_anchor IS NULL;
+
+ALTER TABLE subscriptions
+ALTER COLUMN billing_anchor SET NOT NULL;
+
+COMMIT;
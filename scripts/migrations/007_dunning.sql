@@ -0,0 +1,12 @@
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS dunning_schedule TEXT;
+
+CREATE TABLE
+  IF NOT EXISTS dunning_attempts (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    step INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (bill_id, step)
+  );
@@ -0,0 +1,15 @@
+CREATE TABLE
+  IF NOT EXISTS payment_attempts (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    provider VARCHAR(50) NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    provider_reference VARCHAR(255),
+    failure_code VARCHAR(50),
+    started_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS payment_attempts_bill_id ON payment_attempts (bill_id);
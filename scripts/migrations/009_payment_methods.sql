@@ -0,0 +1,16 @@
+CREATE TABLE
+  IF NOT EXISTS payment_methods (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    type VARCHAR(20) NOT NULL CHECK (type IN ('card', 'bank_account')),
+    token VARCHAR(255) NOT NULL,
+    last4 CHAR(4) NOT NULL,
+    exp_month INTEGER,
+    exp_year INTEGER,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS payment_methods_one_default_per_user ON payment_methods (user_id)
+WHERE
+  is_default;
@@ -0,0 +1,15 @@
+ALTER TABLE bills
+ADD COLUMN IF NOT EXISTS amount_refunded BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE
+  IF NOT EXISTS credit_notes (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    currency CHAR(3) NOT NULL,
+    reason TEXT,
+    provider_reference VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS credit_notes_bill_id ON credit_notes (bill_id);
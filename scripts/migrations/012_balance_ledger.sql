@@ -0,0 +1,16 @@
+ALTER TABLE bills
+ADD COLUMN IF NOT EXISTS credit_applied BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE
+  IF NOT EXISTS balance_entries (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    reason TEXT NOT NULL,
+    bill_id INTEGER REFERENCES bills (id),
+    subscription_id INTEGER REFERENCES subscriptions (id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS balance_entries_user_id ON balance_entries (user_id);
@@ -0,0 +1,30 @@
+CREATE TABLE
+  IF NOT EXISTS coupons (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    discount_type VARCHAR(10) NOT NULL CHECK (discount_type IN ('percent', 'fixed')),
+    percent_off INTEGER CHECK (percent_off BETWEEN 1 AND 100),
+    amount_off BIGINT CHECK (amount_off > 0),
+    currency CHAR(3),
+    duration VARCHAR(10) NOT NULL CHECK (duration IN ('once', 'repeating', 'forever')),
+    duration_cycles INTEGER CHECK (duration_cycles > 0),
+    max_redemptions INTEGER CHECK (max_redemptions > 0),
+    times_redeemed INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE TABLE
+  IF NOT EXISTS coupon_products (
+    coupon_id INTEGER NOT NULL REFERENCES coupons (id),
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    PRIMARY KEY (coupon_id, product_id)
+  );
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS coupon_id INTEGER REFERENCES coupons (id),
+ADD COLUMN IF NOT EXISTS coupon_cycles_left INTEGER;
+
+ALTER TABLE bills
+ADD COLUMN IF NOT EXISTS discount BIGINT NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS coupon_id INTEGER REFERENCES coupons (id);
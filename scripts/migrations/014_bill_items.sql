@@ -0,0 +1,62 @@
+CREATE TABLE
+  IF NOT EXISTS bill_items (
+    id SERIAL PRIMARY KEY,
+    bill_id INTEGER NOT NULL REFERENCES bills (id),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('subscription', 'proration', 'discount')),
+    description TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1,
+    unit_amount BIGINT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    period_start TIMESTAMP,
+    period_end TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS bill_items_bill_id ON bill_items (bill_id);
+
+-- Existing bills get one item for their undiscounted amount and one for
+-- their discount, so that their items add up to their amount.
+INSERT INTO
+  bill_items (bill_id, kind, description, quantity, unit_amount, amount, currency)
+SELECT
+  b.id,
+  CASE b.type
+    WHEN 'adjustment' THEN 'proration'
+    ELSE 'subscription'
+  END,
+  COALESCE(p.name, 'Subscription'),
+  1,
+  b.amount + b.discount,
+  b.amount + b.discount,
+  b.currency
+FROM
+  bills b
+  LEFT JOIN subscriptions s ON s.id = b.subscription_id
+  LEFT JOIN products p ON p.id = s.product_id
+WHERE
+  NOT EXISTS (
+    SELECT 1
+    FROM bill_items i
+    WHERE i.bill_id = b.id
+  );
+
+INSERT INTO
+  bill_items (bill_id, kind, description, quantity, unit_amount, amount, currency)
+SELECT
+  b.id,
+  'discount',
+  'Coupon ' || c.code,
+  1,
+  -b.discount,
+  -b.discount,
+  b.currency
+FROM
+  bills b
+  JOIN coupons c ON c.id = b.coupon_id
+WHERE
+  b.discount > 0
+  AND NOT EXISTS (
+    SELECT 1
+    FROM bill_items i
+    WHERE i.bill_id = b.id AND i.kind = 'discount'
+  );
@@ -0,0 +1,19 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS billing_line1 VARCHAR(255),
+ADD COLUMN IF NOT EXISTS billing_line2 VARCHAR(255),
+ADD COLUMN IF NOT EXISTS billing_city VARCHAR(100),
+ADD COLUMN IF NOT EXISTS billing_region VARCHAR(100),
+ADD COLUMN IF NOT EXISTS billing_postal_code VARCHAR(20),
+ADD COLUMN IF NOT EXISTS billing_country CHAR(2),
+ADD COLUMN IF NOT EXISTS tax_id VARCHAR(50);
+
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS tax_category VARCHAR(50) NOT NULL DEFAULT 'standard';
+
+ALTER TABLE bills
+ADD COLUMN IF NOT EXISTS tax BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE bill_items
+ADD COLUMN IF NOT EXISTS inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+DROP CONSTRAINT IF EXISTS bill_items_kind_check,
+ADD CONSTRAINT bill_items_kind_check CHECK (kind IN ('subscription', 'proration', 'discount', 'tax'));
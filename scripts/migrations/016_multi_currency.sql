@@ -0,0 +1,25 @@
+CREATE TABLE
+  IF NOT EXISTS product_prices (
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    currency CHAR(3) NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (product_id, currency)
+  );
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS currency CHAR(3);
+
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS currency CHAR(3);
+
+UPDATE subscriptions s
+SET
+  currency = p.currency
+FROM
+  products p
+WHERE
+  p.id = s.product_id
+  AND s.currency IS NULL;
+
+ALTER TABLE subscriptions
+ALTER COLUMN currency SET NOT NULL;
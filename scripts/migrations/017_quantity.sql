@@ -0,0 +1,21 @@
+ALTER TABLE subscriptions
+ADD COLUMN IF NOT EXISTS quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0);
+
+CREATE TABLE
+  IF NOT EXISTS pending_items (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('subscription', 'proration', 'discount', 'tax')),
+    description TEXT NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 1,
+    unit_amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    period_start TIMESTAMP,
+    period_end TIMESTAMP,
+    bill_id INTEGER REFERENCES bills (id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+  );
+
+CREATE INDEX IF NOT EXISTS pending_items_unbilled ON pending_items (subscription_id)
+WHERE
+  bill_id IS NULL;
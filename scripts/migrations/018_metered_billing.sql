@@ -0,0 +1,39 @@
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS usage_type VARCHAR(10) NOT NULL DEFAULT 'licensed' CHECK (usage_type IN ('licensed', 'metered'));
+
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS usage_aggregation VARCHAR(10) CHECK (usage_aggregation IN ('sum', 'max', 'last'));
+
+CREATE TABLE
+  IF NOT EXISTS product_price_tiers (
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    currency CHAR(3) NOT NULL,
+    up_to BIGINT CHECK (up_to > 0),
+    unit_amount BIGINT NOT NULL CHECK (unit_amount >= 0),
+    UNIQUE (product_id, currency, up_to)
+  );
+
+CREATE TABLE
+  IF NOT EXISTS usage_records (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    idempotency_key VARCHAR(255) NOT NULL,
+    quantity BIGINT NOT NULL CHECK (quantity >= 0),
+    timestamp TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (subscription_id, idempotency_key)
+  );
+
+CREATE INDEX IF NOT EXISTS usage_records_subscription_timestamp ON usage_records (subscription_id, timestamp);
+
+ALTER TABLE bill_items
+DROP CONSTRAINT IF EXISTS bill_items_kind_check;
+
+ALTER TABLE bill_items
+ADD CONSTRAINT bill_items_kind_check CHECK (kind IN ('subscription', 'proration', 'discount', 'tax', 'usage'));
+
+ALTER TABLE pending_items
+DROP CONSTRAINT IF EXISTS pending_items_kind_check;
+
+ALTER TABLE pending_items
+ADD CONSTRAINT pending_items_kind_check CHECK (kind IN ('subscription', 'proration', 'discount', 'tax', 'usage'));
@@ -0,0 +1,17 @@
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS pricing_scheme VARCHAR(20) NOT NULL DEFAULT 'per_unit' CHECK (pricing_scheme IN ('flat', 'per_unit', 'graduated', 'volume', 'package'));
+
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS package_size INTEGER CHECK (package_size > 0);
+
+-- Tiers used to price metered usage on a graduated basis.
+UPDATE products
+SET
+  pricing_scheme = 'graduated'
+WHERE
+  id IN (
+    SELECT
+      product_id
+    FROM
+      product_price_tiers
+  );
@@ -0,0 +1,24 @@
+ALTER TABLE products
+ADD COLUMN IF NOT EXISTS add_on BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE
+  IF NOT EXISTS subscription_add_ons (
+    id SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    product_id INTEGER NOT NULL REFERENCES products (id),
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (subscription_id, product_id)
+  );
+
+ALTER TABLE bill_items
+DROP CONSTRAINT IF EXISTS bill_items_kind_check;
+
+ALTER TABLE bill_items
+ADD CONSTRAINT bill_items_kind_check CHECK (kind IN ('subscription', 'add_on', 'proration', 'discount', 'tax', 'usage'));
+
+ALTER TABLE pending_items
+DROP CONSTRAINT IF EXISTS pending_items_kind_check;
+
+ALTER TABLE pending_items
+ADD CONSTRAINT pending_items_kind_check CHECK (kind IN ('subscription', 'add_on', 'proration', 'discount', 'tax', 'usage'));
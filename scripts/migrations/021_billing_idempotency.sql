@@ -0,0 +1,8 @@
+ALTER TABLE bills
+ADD COLUMN IF NOT EXISTS period_start TIMESTAMP;
+
+ALTER TABLE bills
+DROP CONSTRAINT IF EXISTS bills_subscription_id_period_start_key;
+
+ALTER TABLE bills
+ADD CONSTRAINT bills_subscription_id_period_start_key UNIQUE (subscription_id, period_start);
@@ -0,0 +1,24 @@
+CREATE TABLE
+  IF NOT EXISTS billing_runs (
+    id SERIAL PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'completed', 'failed')),
+    lock_holder VARCHAR(255) NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP,
+    error TEXT,
+    subscriptions_scanned INTEGER NOT NULL DEFAULT 0,
+    bills_created INTEGER NOT NULL DEFAULT 0,
+    already_billed INTEGER NOT NULL DEFAULT 0
+  );
+
+CREATE INDEX IF NOT EXISTS billing_runs_started_at ON billing_runs (started_at);
+
+CREATE TABLE
+  IF NOT EXISTS billing_run_failures (
+    id SERIAL PRIMARY KEY,
+    billing_run_id INTEGER NOT NULL REFERENCES billing_runs (id),
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id),
+    reason TEXT NOT NULL
+  );
+
+CREATE INDEX IF NOT EXISTS billing_run_failures_billing_run_id ON billing_run_failures (billing_run_id);
@@ -0,0 +1,24 @@
+-- Duplicates left by concurrent subscribes are cancelled, keeping each
+-- user's newest subscription to a product.
+UPDATE subscriptions
+SET
+  status = 'cancelled',
+  cancelled_at = NOW(),
+  cancellation_reason = 'duplicate subscription'
+WHERE
+  status <> 'cancelled'
+  AND id NOT IN (
+    SELECT
+      MAX(id)
+    FROM
+      subscriptions
+    WHERE
+      status <> 'cancelled'
+    GROUP BY
+      user_id,
+      product_id
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_one_per_product ON subscriptions (user_id, product_id)
+WHERE
+  status <> 'cancelled';
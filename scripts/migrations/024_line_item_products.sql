@@ -0,0 +1,7 @@
+-- The product a line is for decides its tax rate. Lines stored before this
+-- migration are taxed as the subscription's own product.
+ALTER TABLE bill_items
+ADD COLUMN IF NOT EXISTS product_id INTEGER REFERENCES products (id);
+
+ALTER TABLE pending_items
+ADD COLUMN IF NOT EXISTS product_id INTEGER REFERENCES products (id);
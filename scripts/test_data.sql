@@ -6,33 +6,38 @@ VALUES
   ('Carol Wilson', 'carol@example.com');
 
 INSERT INTO
-  products (name, description, price)
+  products (name, description, price, trial_days)
 VALUES
   (
     'Premium Coffee Subscription',
     'Artisanal coffee delivered monthly',
-    19.99
+    1999,
+    0
   ),
   (
     'Standard Coffee Subscription',
     'Great quality coffee delivered monthly',
-    14.99
+    1499,
+    0
   ),
   (
     'Premium Tea Subscription',
     'Exotic tea selection delivered monthly',
-    16.99
+    1699,
+    0
   ),
   (
     'Tea Sampler Subscription',
     'Try different teas each month',
-    12.99
+    1299,
+    14
   );
 
 INSERT INTO
   subscriptions (
     user_id,
     product_id,
+    billing_anchor,
     start_date,
     next_billing_date,
     status
@@ -42,6 +47,7 @@ VALUES
     1,
     1,
     CURRENT_DATE - INTERVAL '15 days',
+    CURRENT_DATE - INTERVAL '15 days',
     CURRENT_DATE + INTERVAL '15 days',
     'active'
   ),
@@ -49,6 +55,7 @@ VALUES
     2,
     2,
     CURRENT_DATE - INTERVAL '40 days',
+    CURRENT_DATE - INTERVAL '40 days',
     CURRENT_DATE - INTERVAL '10 days',
     'hold'
   ),
@@ -56,6 +63,7 @@ VALUES
     3,
     3,
     CURRENT_DATE - INTERVAL '31 days',
+    CURRENT_DATE - INTERVAL '31 days',
     CURRENT_DATE - INTERVAL '1 days',
     'active'
   );
@@ -71,7 +79,7 @@ INSERT INTO
 VALUES
   (
     1,
-    14.99,
+    1499,
     'paid',
     CURRENT_DATE - INTERVAL '15 days',
     CURRENT_DATE - INTERVAL '15 days'
@@ -82,7 +90,7 @@ INSERT INTO
 VALUES
   (
     2,
-    19.99,
+    1999,
     'pending',
     CURRENT_DATE - INTERVAL '10 day'
   );
@@ -0,0 +1,235 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func coffeePlan() *models.Product {
+	return &models.Product{ID: 4, Name: "Coffee Plan", Price: models.NewMoney(2000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}
+}
+
+func extraBeans() *models.Product {
+	return &models.Product{ID: 8, Name: "Extra Bag of Beans", Price: models.NewMoney(600, "USD"), BillingInterval: "month", BillingIntervalCount: 1, AddOn: true}
+}
+
+func TestAddOnService_AddAddOn(t *testing.T) {
+	start := time.Now().AddDate(0, 0, -15)
+	next := time.Now().AddDate(0, 0, 15)
+
+	yearly := extraBeans()
+	yearly.BillingInterval = "year"
+
+	tests := []struct {
+		name                string
+		status              string
+		baseProduct         *models.Product
+		addOnProduct        *models.Product
+		existing            []*models.SubscriptionAddOn
+		expectedErrContains string
+		expectCharge        bool
+	}{
+		{
+			name:         "active subscription is charged for the rest of the period",
+			status:       models.SubscriptionStatusActive,
+			baseProduct:  coffeePlan(),
+			addOnProduct: extraBeans(),
+			expectCharge: true,
+		},
+		{
+			name:         "trialing subscription has nothing to prorate",
+			status:       models.SubscriptionStatusTrialing,
+			baseProduct:  coffeePlan(),
+			addOnProduct: extraBeans(),
+		},
+		{
+			name:                "product that is not an add-on",
+			status:              models.SubscriptionStatusActive,
+			baseProduct:         coffeePlan(),
+			addOnProduct:        &models.Product{ID: 8, Name: "Tea Plan", Price: models.NewMoney(900, "USD"), BillingInterval: "month", BillingIntervalCount: 1},
+			expectedErrContains: "not an add-on",
+		},
+		{
+			name:                "add-on on another cycle",
+			status:              models.SubscriptionStatusActive,
+			baseProduct:         coffeePlan(),
+			addOnProduct:        yearly,
+			expectedErrContains: "subscription's cycle",
+		},
+		{
+			name:                "add-on already attached",
+			status:              models.SubscriptionStatusActive,
+			baseProduct:         coffeePlan(),
+			addOnProduct:        extraBeans(),
+			existing:            []*models.SubscriptionAddOn{{ID: 2, SubscriptionID: 1, ProductID: 8, Quantity: 1}},
+			expectedErrContains: "already has this add-on",
+		},
+		{
+			name:                "metered subscription",
+			status:              models.SubscriptionStatusActive,
+			baseProduct:         meteredProduct(),
+			addOnProduct:        extraBeans(),
+			expectedErrContains: "not available for metered subscriptions",
+		},
+		{
+			name:                "paused subscription",
+			status:              models.SubscriptionStatusPaused,
+			baseProduct:         coffeePlan(),
+			addOnProduct:        extraBeans(),
+			expectedErrContains: "only active or trialing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+
+			mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{
+				ID: 1, UserID: 1, ProductID: tt.baseProduct.ID, Currency: "USD", Quantity: 1, Status: tt.status, StartDate: start, NextBillingDate: next,
+			}, nil)
+			mockProductRepo.On("GetByID", tt.baseProduct.ID).Return(tt.baseProduct, nil)
+			mockProductRepo.On("GetByID", 8).Return(tt.addOnProduct, nil)
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository))
+			mockAddOnRepo := uow.Repos.AddOns.(*MockAddOnRepository)
+			mockAddOnRepo.On("GetBySubscriptionID", 1).Return(append([]*models.SubscriptionAddOn{}, tt.existing...), nil)
+			mockAddOnRepo.On("Create", mock.AnythingOfType("*models.SubscriptionAddOn")).Return(nil).Maybe()
+			mockPendingItemRepo := uow.Repos.PendingItems.(*MockPendingItemRepository)
+			mockPendingItemRepo.On("Create", mock.AnythingOfType("*models.PendingItem")).Return(nil).Maybe()
+
+			service := services.NewAddOnService(uow)
+
+			addOn, charge, err := service.AddAddOn(context.Background(), 1, 8, 2)
+
+			if tt.expectedErrContains != "" {
+				assert.ErrorContains(t, err, tt.expectedErrContains)
+				mockAddOnRepo.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, 8, addOn.ProductID)
+			assert.Equal(t, 2, addOn.Quantity)
+			mockAddOnRepo.AssertCalled(t, "Create", mock.AnythingOfType("*models.SubscriptionAddOn"))
+
+			if !tt.expectCharge {
+				assert.Nil(t, charge)
+				mockPendingItemRepo.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+
+			if assert.NotNil(t, charge) {
+				assert.Equal(t, "Remaining time on Extra Bag of Beans", charge.Description)
+				assert.Equal(t, 2, charge.Quantity)
+				assert.InDelta(t, 300, charge.UnitAmount.Amount, 2)
+			}
+		})
+	}
+}
+
+func TestAddOnService_RemoveAddOn(t *testing.T) {
+	start := time.Now().AddDate(0, 0, -15)
+	next := time.Now().AddDate(0, 0, 15)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+
+	mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{
+		ID: 1, UserID: 1, ProductID: 4, Currency: "USD", Quantity: 1, Status: "active", StartDate: start, NextBillingDate: next,
+	}, nil)
+	mockProductRepo.On("GetByID", 4).Return(coffeePlan(), nil)
+	mockProductRepo.On("GetByID", 8).Return(extraBeans(), nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository))
+	mockAddOnRepo := uow.Repos.AddOns.(*MockAddOnRepository)
+	mockAddOnRepo.On("GetByID", 2).Return(&models.SubscriptionAddOn{ID: 2, SubscriptionID: 1, ProductID: 8, Quantity: 3}, nil)
+	mockAddOnRepo.On("GetByID", 5).Return(&models.SubscriptionAddOn{ID: 5, SubscriptionID: 9, ProductID: 8, Quantity: 1}, nil)
+	mockAddOnRepo.On("Delete", 2).Return(nil)
+	uow.Repos.PendingItems.(*MockPendingItemRepository).On("Create", mock.AnythingOfType("*models.PendingItem")).Return(nil)
+
+	service := services.NewAddOnService(uow)
+
+	_, err := service.RemoveAddOn(context.Background(), 1, 5)
+	assert.ErrorContains(t, err, "add-on 5 not found")
+
+	credit, err := service.RemoveAddOn(context.Background(), 1, 2)
+
+	assert.NoError(t, err)
+	mockAddOnRepo.AssertCalled(t, "Delete", 2)
+	mockAddOnRepo.AssertNotCalled(t, "Delete", 5)
+	if assert.NotNil(t, credit) {
+		assert.Equal(t, "Unused time on Extra Bag of Beans", credit.Description)
+		assert.Equal(t, 3, credit.Quantity)
+		assert.InDelta(t, -300, credit.UnitAmount.Amount, 2)
+	}
+}
+
+func TestBillingService_GenerateBillsWithAddOns(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+	uow.Repos.AddOns.(*MockAddOnRepository).On("GetBySubscriptionID", 1).Return([]*models.SubscriptionAddOn{
+		{ID: 2, SubscriptionID: 1, ProductID: 8, Quantity: 2},
+	}, nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 4, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockProductRepo.On("GetByID", 4).Return(coffeePlan(), nil)
+	mockProductRepo.On("GetByID", 8).Return(extraBeans(), nil)
+
+	var created *models.Bill
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*models.Bill)
+	})
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, created) && assert.Len(t, created.Items, 2) {
+		assert.Equal(t, models.BillItemKindSubscription, created.Items[0].Kind)
+		assert.Equal(t, models.NewMoney(2000, "USD"), created.Items[0].Amount)
+		assert.Equal(t, models.BillItemKindAddOn, created.Items[1].Kind)
+		assert.Equal(t, "Extra Bag of Beans", created.Items[1].Description)
+		assert.Equal(t, 2, created.Items[1].Quantity)
+		assert.Equal(t, models.NewMoney(1200, "USD"), created.Items[1].Amount)
+		assert.Equal(t, due, *created.Items[1].PeriodStart)
+	}
+	assert.Equal(t, models.NewMoney(3200, "USD"), created.Amount)
+}
+
+func TestSubscriptionService_CreateSubscriptionRejectsAddOn(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 8).Return(nil, nil)
+	mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1}, nil)
+	mockProductRepo.On("GetByID", 8).Return(extraBeans(), nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), mockUserRepo)
+	service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), mockUserRepo, uow, nil)
+
+	_, _, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{UserID: 1, ProductID: 8})
+
+	assert.ErrorContains(t, err, "is an add-on")
+	mockSubscriptionRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func TestBill_AddItem(t *testing.T) {
+	bill := &models.Bill{}
+
+	assert.NoError(t, bill.AddItem(&models.BillItem{Kind: models.BillItemKindSubscription, Quantity: 3, UnitAmount: models.NewMoney(1000, "usd")}))
+	assert.NoError(t, bill.AddItem(&models.BillItem{Kind: models.BillItemKindProration, UnitAmount: models.NewMoney(-250, "USD")}))
+	assert.NoError(t, bill.AddItem(&models.BillItem{Kind: models.BillItemKindDiscount, UnitAmount: models.NewMoney(-500, "USD")}))
+
+	assert.Equal(t, models.NewMoney(3000, "USD"), bill.Items[0].Amount)
+	assert.Equal(t, 1, bill.Items[1].Quantity)
+	assert.Equal(t, models.NewMoney(2250, "USD"), bill.Amount)
+	assert.Equal(t, models.NewMoney(500, "USD"), bill.Discount)
+
+	err := bill.AddItem(&models.BillItem{Kind: models.BillItemKindSubscription, UnitAmount: models.NewMoney(1000, "EUR")})
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+	assert.Len(t, bill.Items, 3)
+	assert.Equal(t, models.NewMoney(2250, "USD"), bill.Amount)
+}
+
+func TestBillingService_GenerateBillsItemizesRenewal(t *testing.T) {
+	anchor := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2025, time.February, 28, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 2, Status: "active", BillingAnchor: anchor, NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Coffee Plan", Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+	var created *models.Bill
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*models.Bill)
+	})
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	if assert.Len(t, created.Items, 1) {
+		item := created.Items[0]
+		assert.Equal(t, models.BillItemKindSubscription, item.Kind)
+		assert.Equal(t, "Coffee Plan", item.Description)
+		assert.Equal(t, models.NewMoney(1999, "USD"), item.Amount)
+		assert.Equal(t, due, *item.PeriodStart)
+		assert.Equal(t, time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC), *item.PeriodEnd)
+	}
+	assert.Equal(t, models.NewMoney(1999, "USD"), created.Amount)
+}
+
+func TestBillingService_GetBillIncludesItems(t *testing.T) {
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(new(MockSubscriptionRepository), new(MockProductRepository), mockBillRepo, new(MockUserRepository))
+
+	items := []*models.BillItem{
+		{ID: 1, BillID: 3, Kind: models.BillItemKindSubscription, Description: "Coffee Plan", Quantity: 1, UnitAmount: models.NewMoney(1999, "USD"), Amount: models.NewMoney(1999, "USD")},
+		{ID: 2, BillID: 3, Kind: models.BillItemKindDiscount, Description: "Coupon SPRING", Quantity: 1, UnitAmount: models.NewMoney(-500, "USD"), Amount: models.NewMoney(-500, "USD")},
+	}
+	mockBillRepo.On("GetByID", 3).Return(&models.Bill{ID: 3, Amount: models.NewMoney(1499, "USD")}, nil)
+	mockBillRepo.On("GetItems", 3).Return(items, nil)
+	uow.Repos.Payments.(*MockPaymentAttemptRepository).On("GetByBillID", 3).Return([]*models.PaymentAttempt{}, nil)
+	uow.Repos.Dunning.(*MockDunningRepository).On("GetByBillID", 3).Return([]*models.DunningAttempt{}, nil)
+	uow.Repos.CreditNotes.(*MockCreditNoteRepository).On("GetByBillID", 3).Return([]*models.CreditNote{}, nil)
+
+	service := services.NewBillingService(new(MockSubscriptionRepository), new(MockProductRepository), mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	bill, err := service.GetBill(context.Background(), 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, items, bill.Items)
+	mockBillRepo.AssertExpectations(t)
+}
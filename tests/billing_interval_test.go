@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+func TestProduct_NextBillingDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		count    int
+		anchor   time.Time
+		after    time.Time
+		expected time.Time
+	}{
+		{name: "weekly", interval: "week", count: 1, anchor: date(2024, 1, 1), after: date(2024, 1, 1), expected: date(2024, 1, 8)},
+		{name: "every two weeks", interval: "week", count: 2, anchor: date(2024, 1, 1), after: date(2024, 1, 20), expected: date(2024, 1, 29)},
+		{name: "monthly", interval: "month", count: 1, anchor: date(2024, 3, 10), after: date(2024, 3, 10), expected: date(2024, 4, 10)},
+		{name: "month end clamps in leap february", interval: "month", count: 1, anchor: date(2024, 1, 31), after: date(2024, 1, 31), expected: date(2024, 2, 29)},
+		{name: "month end clamps in february", interval: "month", count: 1, anchor: date(2023, 1, 31), after: date(2023, 1, 31), expected: date(2023, 2, 28)},
+		{name: "month end returns to anchor day", interval: "month", count: 1, anchor: date(2024, 1, 31), after: date(2024, 2, 29), expected: date(2024, 3, 31)},
+		{name: "month end clamps in thirty day month", interval: "month", count: 1, anchor: date(2024, 1, 31), after: date(2024, 3, 31), expected: date(2024, 4, 30)},
+		{name: "quarterly", interval: "month", count: 3, anchor: date(2024, 11, 30), after: date(2024, 11, 30), expected: date(2025, 2, 28)},
+		{name: "annual from leap day", interval: "year", count: 1, anchor: date(2024, 2, 29), after: date(2024, 2, 29), expected: date(2025, 2, 28)},
+		{name: "annual back on leap day", interval: "year", count: 1, anchor: date(2024, 2, 29), after: date(2027, 2, 28), expected: date(2028, 2, 29)},
+		{name: "missing interval defaults to monthly", interval: "", count: 0, anchor: date(2024, 5, 15), after: date(2024, 5, 15), expected: date(2024, 6, 15)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := &models.Product{BillingInterval: tt.interval, BillingIntervalCount: tt.count}
+			assert.Equal(t, tt.expected, product.NextBillingDate(tt.anchor, tt.after))
+		})
+	}
+}
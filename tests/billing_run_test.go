@@ -0,0 +1,375 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/handlers"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+type fakeBillingLock struct {
+	heldElsewhere bool
+	acquired      bool
+	released      bool
+	// done, if set, is closed once the lock is released.
+	done chan struct{}
+}
+
+var _ services.BillingLock = (*fakeBillingLock)(nil)
+
+func (l *fakeBillingLock) Acquire(ctx context.Context) (context.Context, bool, error) {
+	l.acquired = !l.heldElsewhere
+	return ctx, l.acquired, nil
+}
+
+func (l *fakeBillingLock) Release(ctx context.Context) error {
+	l.released = true
+	if l.done != nil {
+		close(l.done)
+	}
+	return nil
+}
+
+func (l *fakeBillingLock) Holder() string {
+	return "billing-1:42"
+}
+
+type MockBillingRunService struct {
+	mock.Mock
+}
+
+var _ services.IBillingRunService = (*MockBillingRunService)(nil)
+
+func (m *MockBillingRunService) Run(ctx context.Context) (*models.BillingRun, error) {
+	args := m.Called()
+	run, _ := args.Get(0).(*models.BillingRun)
+	return run, args.Error(1)
+}
+
+func (m *MockBillingRunService) Start(ctx context.Context, timeout time.Duration) (*models.BillingRun, error) {
+	args := m.Called(timeout)
+	run, _ := args.Get(0).(*models.BillingRun)
+	return run, args.Error(1)
+}
+
+func (m *MockBillingRunService) DryRun(ctx context.Context, asOf time.Time) (*models.BillingPreview, error) {
+	args := m.Called(asOf)
+	preview, _ := args.Get(0).(*models.BillingPreview)
+	return preview, args.Error(1)
+}
+
+func (m *MockBillingRunService) StartRun(ctx context.Context, lockHolder string) (*models.BillingRun, error) {
+	args := m.Called(lockHolder)
+	run, _ := args.Get(0).(*models.BillingRun)
+	return run, args.Error(1)
+}
+
+func (m *MockBillingRunService) FinishRun(ctx context.Context, run *models.BillingRun, report *models.BillingRunReport, runErr error) error {
+	args := m.Called(run, report, runErr)
+	return args.Error(0)
+}
+
+func (m *MockBillingRunService) ListRuns(ctx context.Context, limit int) ([]*models.BillingRun, error) {
+	args := m.Called(limit)
+	runs, _ := args.Get(0).([]*models.BillingRun)
+	return runs, args.Error(1)
+}
+
+func (m *MockBillingRunService) GetRun(ctx context.Context, id int) (*models.BillingRun, error) {
+	args := m.Called(id)
+	run, _ := args.Get(0).(*models.BillingRun)
+	return run, args.Error(1)
+}
+
+func TestBillingRunService_FinishRun(t *testing.T) {
+	report := &models.BillingRunReport{
+		SubscriptionsScanned: 3,
+		BillsCreated:         2,
+		Failures:             []models.BillingRunFailure{{SubscriptionID: 7, Reason: "product 9 not found"}},
+	}
+
+	tests := []struct {
+		name           string
+		runErr         error
+		expectedStatus string
+		expectedError  string
+	}{
+		{
+			name:           "run reached every subscription",
+			expectedStatus: models.BillingRunStatusCompleted,
+		},
+		{
+			name:           "run stopped early",
+			runErr:         context.DeadlineExceeded,
+			expectedStatus: models.BillingRunStatusFailed,
+			expectedError:  "context deadline exceeded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uow := newMockUnitOfWork(new(MockSubscriptionRepository), new(MockProductRepository), new(MockBillRepository), new(MockUserRepository))
+			mockRunRepo := uow.Repos.BillingRuns.(*MockBillingRunRepository)
+			mockRunRepo.On("Create", mock.MatchedBy(func(run *models.BillingRun) bool {
+				return run.Status == models.BillingRunStatusRunning && run.LockHolder == "billing-1:42"
+			})).Return(nil)
+			mockRunRepo.On("Finish", mock.AnythingOfType("*models.BillingRun")).Return(nil)
+
+			service := services.NewBillingRunService(uow, nil, nil)
+
+			run, err := service.StartRun(context.Background(), "billing-1:42")
+			assert.NoError(t, err)
+			assert.Equal(t, 1, run.ID)
+			assert.Nil(t, run.FinishedAt)
+
+			err = service.FinishRun(context.Background(), run, report, tt.runErr)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, run.Status)
+			assert.Equal(t, tt.expectedError, run.Error)
+			assert.NotNil(t, run.FinishedAt)
+			assert.Equal(t, 2, run.BillsCreated)
+			assert.Equal(t, report.Failures, run.Failures)
+			mockRunRepo.AssertCalled(t, "Finish", run)
+		})
+	}
+}
+
+func TestBillingRunService_ListRuns(t *testing.T) {
+	started := time.Date(2025, time.March, 12, 0, 0, 0, 0, time.UTC)
+
+	uow := newMockUnitOfWork(new(MockSubscriptionRepository), new(MockProductRepository), new(MockBillRepository), new(MockUserRepository))
+	mockRunRepo := uow.Repos.BillingRuns.(*MockBillingRunRepository)
+	mockRunRepo.On("GetRecent", 100).Return([]*models.BillingRun{
+		{ID: 2, Status: models.BillingRunStatusCompleted, StartedAt: started},
+		{ID: 1, Status: models.BillingRunStatusRunning, StartedAt: started.AddDate(0, 0, -1)},
+	}, nil)
+	mockRunRepo.On("GetFailures", 2).Return([]models.BillingRunFailure{{SubscriptionID: 7, Reason: "product 9 not found"}}, nil)
+	mockRunRepo.On("GetFailures", 1).Return([]models.BillingRunFailure{}, nil)
+	mockRunRepo.On("GetByID", 3).Return(nil, errors.New("billing run 3 not found"))
+
+	service := services.NewBillingRunService(uow, nil, nil)
+
+	// Out of range limits fall back to the most that can be listed.
+	runs, err := service.ListRuns(context.Background(), 500)
+
+	assert.NoError(t, err)
+	if assert.Len(t, runs, 2) {
+		assert.Len(t, runs[0].Failures, 1)
+		assert.Empty(t, runs[1].Failures)
+	}
+
+	_, err = service.GetRun(context.Background(), 3)
+	assert.ErrorContains(t, err, "billing run 3 not found")
+}
+
+func TestBillingRunService_Run(t *testing.T) {
+	tests := []struct {
+		name          string
+		heldElsewhere bool
+		expectedErr   error
+	}{
+		{
+			name: "run is billed and recorded",
+		},
+		{
+			name:          "another run holds the lock",
+			heldElsewhere: true,
+			expectedErr:   models.ErrBillingRunInProgress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+			mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+			expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{})
+			mockBillRepo.On("GetOverdue").Return([]*models.Bill{}, nil)
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, new(MockProductRepository), mockBillRepo, new(MockUserRepository))
+			mockRunRepo := uow.Repos.BillingRuns.(*MockBillingRunRepository)
+			mockRunRepo.On("Create", mock.AnythingOfType("*models.BillingRun")).Return(nil)
+			mockRunRepo.On("Finish", mock.AnythingOfType("*models.BillingRun")).Return(nil)
+
+			billingService := services.NewBillingService(mockSubscriptionRepo, new(MockProductRepository), mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+			lock := &fakeBillingLock{heldElsewhere: tt.heldElsewhere}
+			service := services.NewBillingRunService(uow, billingService, lock)
+
+			run, err := service.Run(context.Background())
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.False(t, lock.released)
+				mockRunRepo.AssertNotCalled(t, "Create", mock.Anything)
+				mockSubscriptionRepo.AssertNotCalled(t, "GetDueForBilling", mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, models.BillingRunStatusCompleted, run.Status)
+			assert.Equal(t, "billing-1:42", run.LockHolder)
+			assert.NotNil(t, run.FinishedAt)
+			assert.True(t, lock.released)
+			mockRunRepo.AssertCalled(t, "Finish", run)
+			mockBillRepo.AssertCalled(t, "GetOverdue")
+		})
+	}
+}
+
+func TestBillingRunHandler_Trigger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	asOf := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name               string
+		requestBody        map[string]interface{}
+		mockSetup          func(mock *MockBillingRunService)
+		expectedStatusCode int
+		expectedResponse   map[string]interface{}
+	}{
+		{
+			name: "run",
+			mockSetup: func(mockService *MockBillingRunService) {
+				mockService.On("Start", time.Minute).Return(&models.BillingRun{ID: 3, Status: models.BillingRunStatusRunning}, nil)
+			},
+			expectedStatusCode: http.StatusAccepted,
+			expectedResponse: map[string]interface{}{
+				"id":     float64(3),
+				"status": "running",
+			},
+		},
+		{
+			name: "run already in progress",
+			mockSetup: func(mockService *MockBillingRunService) {
+				mockService.On("Start", time.Minute).Return(nil, models.ErrBillingRunInProgress)
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedResponse: map[string]interface{}{
+				"error": "a billing run is already in progress",
+			},
+		},
+		{
+			name: "dry run as of a date",
+			requestBody: map[string]interface{}{
+				"dry_run": true,
+				"as_of":   "2025-04-01T00:00:00Z",
+			},
+			mockSetup: func(mockService *MockBillingRunService) {
+				mockService.On("DryRun", asOf).Return(&models.BillingPreview{
+					AsOf:             asOf,
+					BillingRunReport: models.BillingRunReport{SubscriptionsScanned: 1, BillsCreated: 1},
+					Bills:            []*models.Bill{{SubscriptionID: 1, Amount: models.NewMoney(1999, "USD")}},
+				}, nil)
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedResponse: map[string]interface{}{
+				"as_of":         "2025-04-01T00:00:00Z",
+				"bills_created": float64(1),
+				"bills":         mock.Anything,
+			},
+		},
+		{
+			name: "as of without a dry run",
+			requestBody: map[string]interface{}{
+				"as_of": "2025-04-01T00:00:00Z",
+			},
+			mockSetup:          func(mockService *MockBillingRunService) {},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedResponse: map[string]interface{}{
+				"error": "as_of is only supported for dry runs",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockBillingRunService)
+			tt.mockSetup(mockService)
+
+			handler := handlers.NewBillingRunHandler(mockService, time.Minute)
+
+			router := gin.New()
+			router.POST("/admin/billing-runs", handler.Trigger)
+
+			var body bytes.Buffer
+			if tt.requestBody != nil {
+				requestJSON, _ := json.Marshal(tt.requestBody)
+				body.Write(requestJSON)
+			}
+			req, _ := http.NewRequest(http.MethodPost, "/admin/billing-runs", &body)
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatusCode, rr.Code)
+
+			var response map[string]interface{}
+			err := json.Unmarshal(rr.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			for key, expectedValue := range tt.expectedResponse {
+				assert.Contains(t, response, key)
+				if expectedValue != mock.Anything {
+					assert.Equal(t, expectedValue, response[key])
+				}
+			}
+
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBillingRunService_StartOutlivesTheRequest(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{})
+	mockBillRepo.On("GetOverdue").Return([]*models.Bill{}, nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, new(MockProductRepository), mockBillRepo, new(MockUserRepository))
+	mockRunRepo := uow.Repos.BillingRuns.(*MockBillingRunRepository)
+	mockRunRepo.On("Create", mock.AnythingOfType("*models.BillingRun")).Return(nil)
+	mockRunRepo.On("Finish", mock.MatchedBy(func(run *models.BillingRun) bool {
+		return run.Status == models.BillingRunStatusCompleted
+	})).Return(nil)
+
+	billingService := services.NewBillingService(mockSubscriptionRepo, new(MockProductRepository), mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+	lock := &fakeBillingLock{done: make(chan struct{})}
+	service := services.NewBillingRunService(uow, billingService, lock)
+
+	// The client has already gone away and the request timed out.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	cancel()
+
+	run, err := service.Start(ctx, time.Minute)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.BillingRunStatusRunning, run.Status)
+	assert.Nil(t, run.FinishedAt)
+
+	select {
+	case <-lock.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("billing run did not finish")
+	}
+	mockRunRepo.AssertExpectations(t)
+	mockBillRepo.AssertCalled(t, "GetOverdue")
+}
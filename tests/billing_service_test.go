@@ -0,0 +1,944 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func TestBillingService_PayBill(t *testing.T) {
+	tests := []struct {
+		name                  string
+		billID                int
+		paymentMethodID       int
+		outcome               payments.Outcome
+		mockSetup             func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository)
+		expectedError         bool
+		expectedErrorContains string
+		expectCommitted       bool
+		expectRolledBack      bool
+	}{
+		{
+			name:   "successful payment",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", Amount: models.NewMoney(1999, "USD")}, nil)
+				mockBillRepo.On("LockByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", Amount: models.NewMoney(1999, "USD")}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "hold"}, nil)
+				mockSubRepo.On("LockByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "hold"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{}, nil)
+				mockPaymentRepo.On("Create", mock.MatchedBy(func(attempt *models.PaymentAttempt) bool {
+					return attempt.BillID == 1 && attempt.Status == "succeeded" && attempt.Provider == "fake" &&
+						attempt.ProviderReference != "" && attempt.Amount == models.NewMoney(1999, "USD") && attempt.CompletedAt != nil
+				})).Return(nil)
+				mockBillRepo.On("MarkAsPaid", 1).Return(nil)
+				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, BillingInterval: "month", BillingIntervalCount: 1}, nil)
+				mockSubRepo.On("UpdateBillingAnchor", 3, mock.AnythingOfType("time.Time")).Return(nil)
+				mockSubRepo.On("UpdateStartDate", 3, mock.AnythingOfType("time.Time")).Return(nil)
+				mockSubRepo.On("UpdateNextBillingDate", 3, mock.AnythingOfType("time.Time")).Return(nil)
+				mockSubRepo.On("ActivateSubscription", 3).Return(nil)
+			},
+			expectedError:   false,
+			expectCommitted: true,
+		},
+		{
+			name:   "adjustment bill leaves the billing period untouched",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Type: "adjustment", Status: "pending"}, nil)
+				mockBillRepo.On("LockByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Type: "adjustment", Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, Status: "active"}, nil)
+				mockSubRepo.On("LockByID", 3).Return(&models.Subscription{ID: 3, Status: "active"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{}, nil)
+				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.PaymentAttempt")).Return(nil)
+				mockBillRepo.On("MarkAsPaid", 1).Return(nil)
+			},
+			expectedError:   false,
+			expectCommitted: true,
+		},
+		{
+			name:    "declined charge is recorded and the bill stays pending",
+			billID:  1,
+			outcome: payments.OutcomeDecline,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "hold"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{{Status: "failed"}}, nil)
+				mockPaymentRepo.On("Create", mock.MatchedBy(func(attempt *models.PaymentAttempt) bool {
+					return attempt.Status == "failed" && attempt.FailureCode == payments.FailureCodeDeclined && attempt.ProviderReference == ""
+				})).Return(nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "declined",
+			expectCommitted:       true,
+		},
+		{
+			name:            "payment method of another user",
+			billID:          1,
+			paymentMethodID: 8,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, UserID: 5, Status: "hold"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{}, nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "payment method 8 not found",
+			expectRolledBack:      true,
+		},
+		{
+			name:   "user without a default payment method",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, UserID: 6, Status: "hold"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{}, nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "no default payment method",
+			expectRolledBack:      true,
+		},
+		{
+			name:   "bill already paid",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "paid"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, Status: "active"}, nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "already paid",
+			expectRolledBack:      true,
+		},
+		{
+			name:   "subscription cancelled while bill was pending",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, Status: "cancelled"}, nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "subscription is cancelled",
+			expectRolledBack:      true,
+		},
+		{
+			name:   "reactivation fails after bill is marked paid",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockBillRepo.On("LockByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "hold"}, nil)
+				mockSubRepo.On("LockByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "hold"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{}, nil)
+				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.PaymentAttempt")).Return(nil)
+				mockBillRepo.On("MarkAsPaid", 1).Return(nil)
+				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, BillingInterval: "month", BillingIntervalCount: 1}, nil)
+				mockSubRepo.On("UpdateBillingAnchor", 3, mock.AnythingOfType("time.Time")).Return(nil)
+				mockSubRepo.On("UpdateStartDate", 3, mock.AnythingOfType("time.Time")).Return(nil)
+				mockSubRepo.On("UpdateNextBillingDate", 3, mock.AnythingOfType("time.Time")).Return(nil)
+				mockSubRepo.On("ActivateSubscription", 3).Return(errors.New("db error"))
+			},
+			expectedError:         true,
+			expectedErrorContains: "db error",
+			expectCommitted:       true,
+			expectRolledBack:      true,
+		},
+		{
+			name:   "earlier successful charge is settled without charging again",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				completedAt := time.Now()
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Type: "adjustment", Status: "pending"}, nil)
+				mockBillRepo.On("LockByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Type: "adjustment", Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, Status: "active"}, nil)
+				mockSubRepo.On("LockByID", 3).Return(&models.Subscription{ID: 3, Status: "active"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{{Status: "succeeded", CompletedAt: &completedAt}}, nil)
+				mockBillRepo.On("MarkAsPaid", 1).Return(nil)
+			},
+			expectedError:   false,
+			expectCommitted: true,
+		},
+		{
+			name:   "bill paid by a concurrent request is not settled twice",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "hold"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{}, nil)
+				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.PaymentAttempt")).Return(nil)
+				mockSubRepo.On("LockByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "active"}, nil)
+				mockBillRepo.On("LockByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "paid"}, nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "no longer pending",
+			expectCommitted:       true,
+			expectRolledBack:      true,
+		},
+		{
+			name:   "bill written off while being charged leaves the subscription cancelled",
+			billID: 1,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockPaymentRepo *MockPaymentAttemptRepository) {
+				mockBillRepo.On("GetByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "pending"}, nil)
+				mockSubRepo.On("GetByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "past_due"}, nil)
+				mockPaymentRepo.On("GetByBillID", 1).Return([]*models.PaymentAttempt{}, nil)
+				mockPaymentRepo.On("Create", mock.AnythingOfType("*models.PaymentAttempt")).Return(nil)
+				mockSubRepo.On("LockByID", 3).Return(&models.Subscription{ID: 3, ProductID: 2, Status: "cancelled"}, nil)
+				mockBillRepo.On("LockByID", 1).Return(&models.Bill{ID: 1, SubscriptionID: 3, Status: "uncollectible"}, nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "no longer pending",
+			expectCommitted:       true,
+			expectRolledBack:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockUserRepo := new(MockUserRepository)
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			mockPaymentRepo := uow.Repos.Payments.(*MockPaymentAttemptRepository)
+			mockMethodRepo := uow.Repos.PaymentMethods.(*MockPaymentMethodRepository)
+			mockMethodRepo.On("GetDefaultByUserID", 0).Return(&models.PaymentMethod{ID: 7, Token: "tok_visa"}, nil).Maybe()
+			mockMethodRepo.On("GetDefaultByUserID", 6).Return(nil, nil).Maybe()
+			mockMethodRepo.On("GetByID", 8).Return(&models.PaymentMethod{ID: 8, UserID: 9, Token: "tok_other"}, nil).Maybe()
+
+			tt.mockSetup(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockPaymentRepo)
+
+			provider := payments.NewFakeProvider()
+			if tt.outcome != "" {
+				provider.Script(tt.outcome)
+			}
+
+			service := services.NewBillingService(
+				mockSubscriptionRepo,
+				mockProductRepo,
+				mockBillRepo,
+				mockUserRepo,
+				uow,
+				provider,
+				services.NewLogNotifier(),
+				nil,
+				nil,
+			)
+
+			err := service.PayBill(context.Background(), tt.billID, tt.paymentMethodID)
+
+			if tt.expectedError {
+				assert.Error(t, err)
+				if tt.expectedErrorContains != "" {
+					assert.Contains(t, err.Error(), tt.expectedErrorContains)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectCommitted, uow.Committed)
+			assert.Equal(t, tt.expectRolledBack, uow.RolledBack)
+
+			mockSubscriptionRepo.AssertExpectations(t)
+			mockProductRepo.AssertExpectations(t)
+			mockBillRepo.AssertExpectations(t)
+			mockPaymentRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBillingService_GenerateBills(t *testing.T) {
+	now := time.Now()
+	pausedAt := now.Add(-10 * 24 * time.Hour)
+	resumeAt := now.Add(-time.Hour)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{
+		{
+			ID:              4,
+			ProductID:       2,
+			Status:          "paused",
+			BillingAnchor:   now.Add(-20 * 24 * time.Hour),
+			StartDate:       now.Add(-20 * 24 * time.Hour),
+			NextBillingDate: now.Add(10 * 24 * time.Hour),
+			PausedAt:        &pausedAt,
+			ResumeAt:        &resumeAt,
+		},
+	}, nil)
+	shift := resumeAt.Sub(pausedAt)
+	mockSubscriptionRepo.On("Resume", 4, now.Add(-20*24*time.Hour).Add(shift), now.Add(-20*24*time.Hour).Add(shift), now.Add(10*24*time.Hour).Add(shift)).Return(nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, ProductID: 2, Status: "active"},
+		{ID: 2, ProductID: 2, Status: "active", CancelAtPeriodEnd: true, NextBillingDate: now, CancellationReason: "moving"},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockSubscriptionRepo.On("Cancel", 2, now, "moving").Return(nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(1999, "USD")}, nil)
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.SubscriptionID == 1 && bill.Status == "pending" && bill.Amount == models.NewMoney(1999, "USD")
+	})).Return(nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	assert.True(t, uow.Committed)
+	mockSubscriptionRepo.AssertExpectations(t)
+	mockProductRepo.AssertExpectations(t)
+	mockBillRepo.AssertExpectations(t)
+}
+
+func TestBillingService_GenerateBillsAutoCollect(t *testing.T) {
+	anchor := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	mockPaymentRepo := uow.Repos.Payments.(*MockPaymentAttemptRepository)
+	mockMethodRepo := uow.Repos.PaymentMethods.(*MockPaymentMethodRepository)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 2, Status: "active", AutoCollect: true, BillingAnchor: anchor, NextBillingDate: due},
+		{ID: 2, UserID: 6, ProductID: 2, Status: "active", AutoCollect: true, BillingAnchor: anchor, NextBillingDate: due},
+		{ID: 3, UserID: 7, ProductID: 2, Status: "active", AutoCollect: true, BillingAnchor: anchor, NextBillingDate: due},
+	})
+	for _, id := range []int{1, 2, 3} {
+		mockSubscriptionRepo.On("HoldSubscription", id).Return(nil)
+	}
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	billID := 10
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		billID++
+		args.Get(0).(*models.Bill).ID = billID
+	})
+
+	mockMethodRepo.On("GetDefaultByUserID", 5).Return(&models.PaymentMethod{ID: 1, Token: "tok_good"}, nil)
+	mockMethodRepo.On("GetDefaultByUserID", 6).Return(&models.PaymentMethod{ID: 2, Token: "tok_bad"}, nil)
+	mockMethodRepo.On("GetDefaultByUserID", 7).Return(nil, nil)
+
+	mockPaymentRepo.On("Create", mock.MatchedBy(func(attempt *models.PaymentAttempt) bool {
+		return attempt.Status == "succeeded"
+	})).Return(nil).Once()
+	mockPaymentRepo.On("Create", mock.MatchedBy(func(attempt *models.PaymentAttempt) bool {
+		return attempt.Status == "failed" && attempt.FailureCode == payments.FailureCodeDeclined
+	})).Return(nil).Once()
+
+	// Only the successfully charged renewal is paid and moved on, keeping
+	// its month-end anchor.
+	mockBillRepo.On("MarkAsPaid", mock.AnythingOfType("int")).Return(nil).Once()
+	mockSubscriptionRepo.On("UpdateStartDate", 1, due).Return(nil)
+	mockSubscriptionRepo.On("UpdateNextBillingDate", 1, time.Date(2025, time.April, 30, 0, 0, 0, 0, time.UTC)).Return(nil)
+	mockSubscriptionRepo.On("ActivateSubscription", 1).Return(nil)
+
+	provider := payments.NewFakeProvider()
+	provider.Script(payments.OutcomeSuccess, payments.OutcomeDecline)
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, provider, services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockSubscriptionRepo.AssertExpectations(t)
+	mockBillRepo.AssertExpectations(t)
+	mockPaymentRepo.AssertExpectations(t)
+	mockMethodRepo.AssertExpectations(t)
+	mockSubscriptionRepo.AssertNotCalled(t, "ActivateSubscription", 2)
+	mockSubscriptionRepo.AssertNotCalled(t, "ActivateSubscription", 3)
+}
+
+func TestBillingService_GenerateBillsAppliesCredit(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	mockBalanceRepo := uow.Repos.Balance.(*MockBalanceRepository)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 2, Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+		{ID: 2, UserID: 6, ProductID: 2, Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockSubscriptionRepo.On("HoldSubscription", 2).Return(nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+	mockBalanceRepo.On("GetBalance", 5, "USD").Return(models.NewMoney(5000, "USD"), nil)
+	mockBalanceRepo.On("GetBalance", 6, "USD").Return(models.NewMoney(500, "USD"), nil)
+
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.SubscriptionID == 1 && bill.CreditApplied == models.NewMoney(1999, "USD")
+	})).Return(nil).Run(func(args mock.Arguments) { args.Get(0).(*models.Bill).ID = 11 })
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.SubscriptionID == 2 && bill.CreditApplied == models.NewMoney(500, "USD") && bill.AmountDue() == models.NewMoney(1499, "USD")
+	})).Return(nil).Run(func(args mock.Arguments) { args.Get(0).(*models.Bill).ID = 12 })
+	mockBalanceRepo.On("Create", mock.MatchedBy(func(entry *models.BalanceEntry) bool {
+		return entry.UserID == 5 && entry.Amount == models.NewMoney(-1999, "USD") && *entry.BillID == 11
+	})).Return(nil)
+	mockBalanceRepo.On("Create", mock.MatchedBy(func(entry *models.BalanceEntry) bool {
+		return entry.UserID == 6 && entry.Amount == models.NewMoney(-500, "USD") && *entry.BillID == 12
+	})).Return(nil)
+
+	// The fully credited renewal is paid and renewed without a charge; the
+	// partly credited one waits on hold for the rest.
+	mockBillRepo.On("MarkAsPaid", 11).Return(nil)
+	mockSubscriptionRepo.On("UpdateStartDate", 1, due).Return(nil)
+	mockSubscriptionRepo.On("UpdateNextBillingDate", 1, due.AddDate(0, 1, 0)).Return(nil)
+	mockSubscriptionRepo.On("ActivateSubscription", 1).Return(nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockSubscriptionRepo.AssertExpectations(t)
+	mockBillRepo.AssertExpectations(t)
+	mockBalanceRepo.AssertExpectations(t)
+	mockSubscriptionRepo.AssertNotCalled(t, "ActivateSubscription", 2)
+}
+
+func TestBillingService_GenerateBillsIsolatesFailures(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, ProductID: 9, Currency: "USD", Status: "active", BillingAnchor: due, NextBillingDate: due},
+		{ID: 2, ProductID: 2, Currency: "USD", Status: "active", BillingAnchor: due, NextBillingDate: due},
+		{ID: 3, ProductID: 2, Currency: "USD", Status: "active", BillingAnchor: due, NextBillingDate: due},
+	})
+	for _, id := range []int{1, 2, 3} {
+		mockSubscriptionRepo.On("HoldSubscription", id).Return(nil)
+	}
+	mockProductRepo.On("GetByID", 9).Return(nil, errors.New("product 9 not found"))
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+	// Subscription 3 was billed for the period by an earlier run that
+	// stopped before moving it on.
+	var created *models.Bill
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.SubscriptionID == 2
+	})).Return(nil).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*models.Bill)
+	})
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.SubscriptionID == 3
+	})).Return(models.ErrPeriodAlreadyBilled)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	report, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.SubscriptionsScanned)
+	assert.Equal(t, 1, report.BillsCreated)
+	assert.Equal(t, 1, report.AlreadyBilled)
+	assert.Equal(t, []models.BillingRunFailure{{SubscriptionID: 1, Reason: "product 9 not found"}}, report.Failures)
+	if assert.NotNil(t, created) && assert.NotNil(t, created.PeriodStart) {
+		assert.Equal(t, due, *created.PeriodStart)
+	}
+	mockBillRepo.AssertExpectations(t)
+}
+
+func TestBillingService_GenerateBillsRereadsSubscriptions(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+
+	// Subscription 1 is cancelled and subscription 2 goes up to three
+	// seats after the run has listed them.
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	mockSubscriptionRepo.On("GetDueForBilling", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{
+		{ID: 1, ProductID: 2, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: due, NextBillingDate: due},
+		{ID: 2, ProductID: 2, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: due, NextBillingDate: due},
+	}, nil)
+	mockSubscriptionRepo.On("LockDueForBilling", 1, mock.AnythingOfType("time.Time")).Return(nil, nil)
+	mockSubscriptionRepo.On("LockDueForBilling", 2, mock.AnythingOfType("time.Time")).Return(&models.Subscription{
+		ID: 2, ProductID: 2, Currency: "USD", Quantity: 3, Status: "active", BillingAnchor: due, NextBillingDate: due,
+	}, nil)
+	mockSubscriptionRepo.On("HoldSubscription", 2).Return(nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Basic Plan", Price: models.NewMoney(1000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+	var created *models.Bill
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*models.Bill)
+	})
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	report, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.SubscriptionsScanned)
+	assert.Equal(t, 1, report.BillsCreated)
+	assert.Empty(t, report.Failures)
+	mockSubscriptionRepo.AssertNotCalled(t, "HoldSubscription", 1)
+	if assert.NotNil(t, created) {
+		assert.Equal(t, 2, created.SubscriptionID)
+		assert.Equal(t, models.NewMoney(3000, "USD"), created.Amount)
+	}
+}
+
+func TestBillingService_GenerateBillsCollectsLeftOverRenewals(t *testing.T) {
+	anchor := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+	due := time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	mockPaymentRepo := uow.Repos.Payments.(*MockPaymentAttemptRepository)
+
+	// An earlier run stopped after creating bill 20 but before charging it.
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{
+		{ID: 20, SubscriptionID: 1, Type: models.BillTypeSubscription, Amount: models.NewMoney(1999, "USD"), Status: models.BillStatusPending},
+	}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{})
+	mockSubscriptionRepo.On("LockByID", 1).Return(&models.Subscription{
+		ID: 1, UserID: 5, ProductID: 2, Currency: "USD", Status: models.SubscriptionStatusHold, AutoCollect: true, BillingAnchor: anchor, NextBillingDate: due,
+	}, nil)
+	mockBillRepo.On("LockByID", 20).Return(&models.Bill{
+		ID: 20, SubscriptionID: 1, Type: models.BillTypeSubscription, Amount: models.NewMoney(1999, "USD"), Status: models.BillStatusPending,
+	}, nil)
+	mockPaymentRepo.On("GetByBillID", 20).Return([]*models.PaymentAttempt{}, nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	uow.Repos.PaymentMethods.(*MockPaymentMethodRepository).On("GetDefaultByUserID", 5).Return(&models.PaymentMethod{ID: 1, Token: "tok_good"}, nil)
+
+	mockPaymentRepo.On("Create", mock.MatchedBy(func(attempt *models.PaymentAttempt) bool {
+		return attempt.BillID == 20 && attempt.Status == models.PaymentAttemptStatusSucceeded
+	})).Return(nil).Once()
+	mockBillRepo.On("MarkAsPaid", 20).Return(nil)
+	mockSubscriptionRepo.On("UpdateStartDate", 1, due).Return(nil)
+	mockSubscriptionRepo.On("UpdateNextBillingDate", 1, time.Date(2025, time.April, 30, 0, 0, 0, 0, time.UTC)).Return(nil)
+	mockSubscriptionRepo.On("ActivateSubscription", 1).Return(nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	report, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	assert.Empty(t, report.Failures)
+	mockPaymentRepo.AssertExpectations(t)
+	mockBillRepo.AssertExpectations(t)
+	mockSubscriptionRepo.AssertExpectations(t)
+}
+
+func TestBillingService_GenerateBillsRechecksLeftOverRenewals(t *testing.T) {
+	pending := &models.Bill{ID: 20, SubscriptionID: 1, Type: models.BillTypeSubscription, Amount: models.NewMoney(1999, "USD"), Status: models.BillStatusPending}
+	held := &models.Subscription{ID: 1, UserID: 5, ProductID: 2, Currency: "USD", Status: models.SubscriptionStatusHold, AutoCollect: true}
+
+	tests := []struct {
+		name           string
+		subscription   *models.Subscription
+		bill           *models.Bill
+		attempts       []*models.PaymentAttempt
+		defaultMethod  *models.PaymentMethod
+		expectedReason string
+	}{
+		{
+			name:         "paid since it was listed",
+			subscription: &models.Subscription{ID: 1, UserID: 5, ProductID: 2, Status: models.SubscriptionStatusActive, AutoCollect: true},
+			bill:         &models.Bill{ID: 20, SubscriptionID: 1, Type: models.BillTypeSubscription, Status: models.BillStatusPaid},
+		},
+		{
+			name:         "written off since it was listed",
+			subscription: held,
+			bill:         &models.Bill{ID: 20, SubscriptionID: 1, Type: models.BillTypeSubscription, Status: models.BillStatusUncollectible},
+		},
+		{
+			name:         "charged since it was listed",
+			subscription: held,
+			bill:         pending,
+			attempts:     []*models.PaymentAttempt{{BillID: 20, Status: models.PaymentAttemptStatusFailed}},
+		},
+		{
+			name:           "user without a default payment method",
+			subscription:   held,
+			bill:           pending,
+			expectedReason: "collecting bill 20: user has no default payment method",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+			mockPaymentRepo := uow.Repos.Payments.(*MockPaymentAttemptRepository)
+
+			mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+			mockBillRepo.On("GetUncollected").Return([]*models.Bill{pending}, nil)
+			expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{})
+			mockSubscriptionRepo.On("LockByID", 1).Return(tt.subscription, nil)
+			mockBillRepo.On("LockByID", 20).Return(tt.bill, nil).Maybe()
+			mockPaymentRepo.On("GetByBillID", 20).Return(tt.attempts, nil).Maybe()
+			mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil).Maybe()
+			uow.Repos.PaymentMethods.(*MockPaymentMethodRepository).On("GetDefaultByUserID", 5).Return(tt.defaultMethod, nil).Maybe()
+
+			service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+			report, err := service.GenerateBills(context.Background())
+
+			assert.NoError(t, err)
+			if tt.expectedReason != "" {
+				assert.Equal(t, []models.BillingRunFailure{{SubscriptionID: 1, Reason: tt.expectedReason}}, report.Failures)
+			} else {
+				assert.Empty(t, report.Failures)
+			}
+			mockPaymentRepo.AssertNotCalled(t, "Create", mock.Anything)
+			mockBillRepo.AssertNotCalled(t, "MarkAsPaid", mock.Anything)
+		})
+	}
+}
+
+func TestBillingService_GenerateBillsStopsWhenCancelled(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, ProductID: 2, Status: "active"},
+	})
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, new(MockProductRepository), mockBillRepo, new(MockUserRepository))
+	service := services.NewBillingService(mockSubscriptionRepo, new(MockProductRepository), mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := service.GenerateBills(ctx)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, report.SubscriptionsScanned)
+	mockSubscriptionRepo.AssertNotCalled(t, "HoldSubscription", 1)
+}
+
+func TestBillingService_PreviewBills(t *testing.T) {
+	asOf := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	mockBalanceRepo := uow.Repos.Balance.(*MockBalanceRepository)
+	mockBalanceRepo.On("GetBalances", 5).Return([]models.Money{models.NewMoney(500, "USD")}, nil)
+
+	mockSubscriptionRepo.On("GetDueForBilling", asOf).Return([]*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 2, Currency: "USD", Status: "active", AutoCollect: true, BillingAnchor: asOf, NextBillingDate: asOf},
+	}, nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Basic Plan", Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	uow.Repos.PaymentMethods.(*MockPaymentMethodRepository).On("GetDefaultByUserID", 5).Return(&models.PaymentMethod{ID: 1, Token: "tok_good"}, nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	preview, err := service.PreviewBills(context.Background(), asOf)
+
+	// The bill is worked out in full, credit included, but never written,
+	// charged or locked for.
+	assert.NoError(t, err)
+	assert.True(t, uow.RolledBack)
+	assert.False(t, uow.Committed)
+	assert.Equal(t, asOf, preview.AsOf)
+	assert.Equal(t, 1, preview.BillsCreated)
+	if assert.Len(t, preview.Bills, 1) {
+		assert.Equal(t, 0, preview.Bills[0].ID)
+		assert.Equal(t, models.NewMoney(1999, "USD"), preview.Bills[0].Amount)
+		assert.Equal(t, models.NewMoney(500, "USD"), preview.Bills[0].CreditApplied)
+	}
+	mockSubscriptionRepo.AssertNotCalled(t, "GetDueForResume", mock.Anything)
+	mockSubscriptionRepo.AssertNotCalled(t, "HoldSubscription", mock.Anything)
+	mockBillRepo.AssertNotCalled(t, "Create", mock.Anything)
+	mockBillRepo.AssertNotCalled(t, "MarkAsPaid", mock.Anything)
+	mockBalanceRepo.AssertNotCalled(t, "GetBalance", mock.Anything, mock.Anything)
+	mockBalanceRepo.AssertNotCalled(t, "Create", mock.Anything)
+	uow.Repos.PendingItems.(*MockPendingItemRepository).AssertNotCalled(t, "MarkBilled", mock.Anything, mock.Anything)
+	uow.Repos.Payments.(*MockPaymentAttemptRepository).AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestBillingService_RefundBill(t *testing.T) {
+	usd := func(amount int64) models.Money { return models.NewMoney(amount, "USD") }
+
+	tests := []struct {
+		name                  string
+		bill                  *models.Bill
+		attempts              []*models.PaymentAttempt
+		amount                int64
+		expectedRefund        models.Money
+		expectedRefunded      models.Money
+		expectedStatus        string
+		expectProviderRefund  bool
+		expectedErrorContains string
+	}{
+		{
+			name:                 "partial refund of a charged bill",
+			bill:                 &models.Bill{ID: 1, Amount: usd(1999), AmountRefunded: usd(0), Status: "paid"},
+			attempts:             []*models.PaymentAttempt{{Status: "failed"}, {Status: "succeeded", ProviderReference: "charge"}},
+			amount:               500,
+			expectedRefund:       usd(500),
+			expectedRefunded:     usd(500),
+			expectedStatus:       "partially_refunded",
+			expectProviderRefund: true,
+		},
+		{
+			name:             "full refund of the remainder",
+			bill:             &models.Bill{ID: 1, Amount: usd(1999), AmountRefunded: usd(500), Status: "partially_refunded"},
+			expectedRefund:   usd(1499),
+			expectedRefunded: usd(1999),
+			expectedStatus:   "refunded",
+		},
+		{
+			name:                  "refund larger than what is left",
+			bill:                  &models.Bill{ID: 1, Amount: usd(1999), AmountRefunded: usd(500), Status: "partially_refunded"},
+			amount:                1500,
+			expectedErrorContains: "between 1 and 1499",
+		},
+		{
+			name:                  "already fully refunded",
+			bill:                  &models.Bill{ID: 1, Amount: usd(1999), AmountRefunded: usd(1999), Status: "refunded"},
+			expectedErrorContains: "already fully refunded",
+		},
+		{
+			name:                  "unpaid bill",
+			bill:                  &models.Bill{ID: 1, Amount: usd(1999), AmountRefunded: usd(0), Status: "pending"},
+			expectedErrorContains: "only paid bills",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBillRepo := new(MockBillRepository)
+			uow := newMockUnitOfWork(new(MockSubscriptionRepository), new(MockProductRepository), mockBillRepo, new(MockUserRepository))
+			mockPaymentRepo := uow.Repos.Payments.(*MockPaymentAttemptRepository)
+			mockCreditNoteRepo := uow.Repos.CreditNotes.(*MockCreditNoteRepository)
+
+			mockBillRepo.On("LockByID", 1).Return(tt.bill, nil)
+			mockPaymentRepo.On("GetByBillID", 1).Return(tt.attempts, nil).Maybe()
+			mockCreditNoteRepo.On("GetByBillID", 1).Return([]*models.CreditNote{}, nil).Maybe()
+			if tt.expectedErrorContains == "" {
+				mockCreditNoteRepo.On("Create", mock.MatchedBy(func(note *models.CreditNote) bool {
+					return note.BillID == 1 && note.Amount == tt.expectedRefund && (note.ProviderReference != "") == tt.expectProviderRefund
+				})).Return(nil)
+				mockBillRepo.On("UpdateRefunded", 1, tt.expectedRefunded, tt.expectedStatus).Return(nil)
+			}
+
+			provider := payments.NewFakeProvider()
+			service := services.NewBillingService(new(MockSubscriptionRepository), new(MockProductRepository), mockBillRepo, new(MockUserRepository), uow, provider, services.NewLogNotifier(), nil, nil)
+
+			if tt.expectProviderRefund {
+				charge, err := provider.Charge(context.Background(), payments.ChargeRequest{Amount: tt.bill.Amount, PaymentMethod: "tok_visa"})
+				assert.NoError(t, err)
+				tt.attempts[1].ProviderReference = charge.Reference
+			}
+
+			note, err := service.RefundBill(context.Background(), 1, tt.amount, "goodwill")
+
+			if tt.expectedErrorContains != "" {
+				assert.ErrorContains(t, err, tt.expectedErrorContains)
+				mockCreditNoteRepo.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedRefund, note.Amount)
+			assert.Equal(t, "goodwill", note.Reason)
+			mockBillRepo.AssertExpectations(t)
+			mockCreditNoteRepo.AssertExpectations(t)
+		})
+	}
+}
+
+type MockNotifier struct {
+	mock.Mock
+}
+
+func (m *MockNotifier) SendPaymentReminder(ctx context.Context, user *models.User, bill *models.Bill, attempt int) error {
+	args := m.Called(user.ID, bill.ID, attempt)
+	return args.Error(0)
+}
+
+func TestBillingService_RunDunning(t *testing.T) {
+	now := time.Now()
+	schedule := models.DunningSchedule{
+		{AfterDays: 1, Action: models.DunningActionRemind},
+		{AfterDays: 3, Action: models.DunningActionRemind},
+		{AfterDays: 14, Action: models.DunningActionCancel},
+	}
+
+	tests := []struct {
+		name      string
+		bill      *models.Bill
+		locked    *models.Bill
+		status    string
+		product   *models.Product
+		mockSetup func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository, mockDunningRepo *MockDunningRepository, mockUserRepo *MockUserRepository, notifier *MockNotifier)
+	}{
+		{
+			name:    "first reminder marks the subscription past due",
+			bill:    &models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", CreatedAt: now.AddDate(0, 0, -2)},
+			product: &models.Product{ID: 2},
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository, mockDunningRepo *MockDunningRepository, mockUserRepo *MockUserRepository, notifier *MockNotifier) {
+				mockDunningRepo.On("GetByBillID", 1).Return([]*models.DunningAttempt{}, nil)
+				mockDunningRepo.On("Create", mock.MatchedBy(func(attempt *models.DunningAttempt) bool {
+					return attempt.BillID == 1 && attempt.Step == 1 && attempt.Action == models.DunningActionRemind
+				})).Return(nil)
+				mockSubRepo.On("MarkPastDue", 3).Return(nil)
+				mockUserRepo.On("GetByID", 5).Return(&models.User{ID: 5}, nil)
+				notifier.On("SendPaymentReminder", 5, 1, 1).Return(nil)
+			},
+		},
+		{
+			name:    "next step not due yet",
+			bill:    &models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", CreatedAt: now.AddDate(0, 0, -2)},
+			product: &models.Product{ID: 2},
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository, mockDunningRepo *MockDunningRepository, mockUserRepo *MockUserRepository, notifier *MockNotifier) {
+				mockDunningRepo.On("GetByBillID", 1).Return([]*models.DunningAttempt{{Step: 1}}, nil)
+			},
+		},
+		{
+			name:    "final step cancels and writes off the bill",
+			bill:    &models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", CreatedAt: now.AddDate(0, 0, -15)},
+			product: &models.Product{ID: 2},
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository, mockDunningRepo *MockDunningRepository, mockUserRepo *MockUserRepository, notifier *MockNotifier) {
+				mockDunningRepo.On("GetByBillID", 1).Return([]*models.DunningAttempt{{Step: 1}, {Step: 2}}, nil)
+				mockDunningRepo.On("Create", mock.MatchedBy(func(attempt *models.DunningAttempt) bool {
+					return attempt.Step == 3 && attempt.Action == models.DunningActionCancel
+				})).Return(nil)
+				mockSubRepo.On("Cancel", 3, mock.AnythingOfType("time.Time"), "unpaid bill").Return(nil)
+				mockBillRepo.On("MarkUncollectible", 1).Return(nil)
+			},
+		},
+		{
+			name: "product schedule overrides the default",
+			bill: &models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", CreatedAt: now.AddDate(0, 0, -2)},
+			product: &models.Product{ID: 2, DunningSchedule: models.DunningSchedule{
+				{AfterDays: 1, Action: models.DunningActionMarkUnpaid},
+			}},
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository, mockDunningRepo *MockDunningRepository, mockUserRepo *MockUserRepository, notifier *MockNotifier) {
+				mockDunningRepo.On("GetByBillID", 1).Return([]*models.DunningAttempt{}, nil)
+				mockDunningRepo.On("Create", mock.MatchedBy(func(attempt *models.DunningAttempt) bool {
+					return attempt.Step == 1 && attempt.Action == models.DunningActionMarkUnpaid
+				})).Return(nil)
+				mockSubRepo.On("MarkUnpaid", 3).Return(nil)
+			},
+		},
+		{
+			name:    "bill paid since it was listed",
+			bill:    &models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", CreatedAt: now.AddDate(0, 0, -15)},
+			locked:  &models.Bill{ID: 1, SubscriptionID: 3, Status: "paid", CreatedAt: now.AddDate(0, 0, -15)},
+			product: &models.Product{ID: 2},
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository, mockDunningRepo *MockDunningRepository, mockUserRepo *MockUserRepository, notifier *MockNotifier) {
+			},
+		},
+		{
+			name:    "subscription cancelled since the bill was listed",
+			bill:    &models.Bill{ID: 1, SubscriptionID: 3, Status: "pending", CreatedAt: now.AddDate(0, 0, -15)},
+			status:  "cancelled",
+			product: &models.Product{ID: 2},
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository, mockDunningRepo *MockDunningRepository, mockUserRepo *MockUserRepository, notifier *MockNotifier) {
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockUserRepo := new(MockUserRepository)
+			notifier := new(MockNotifier)
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			mockDunningRepo := uow.Repos.Dunning.(*MockDunningRepository)
+
+			status := tt.status
+			if status == "" {
+				status = "hold"
+			}
+			locked := tt.locked
+			if locked == nil {
+				locked = tt.bill
+			}
+
+			mockBillRepo.On("GetOverdue").Return([]*models.Bill{tt.bill}, nil)
+			mockBillRepo.On("LockByID", 1).Return(locked, nil).Maybe()
+			mockSubscriptionRepo.On("LockByID", 3).Return(&models.Subscription{ID: 3, UserID: 5, ProductID: 2, Status: status}, nil)
+			mockProductRepo.On("GetByID", 2).Return(tt.product, nil).Maybe()
+			tt.mockSetup(mockSubscriptionRepo, mockBillRepo, mockDunningRepo, mockUserRepo, notifier)
+
+			service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, payments.NewFakeProvider(), notifier, schedule, nil)
+
+			err := service.RunDunning(context.Background())
+
+			assert.NoError(t, err)
+			mockSubscriptionRepo.AssertExpectations(t)
+			mockBillRepo.AssertExpectations(t)
+			mockDunningRepo.AssertExpectations(t)
+			mockUserRepo.AssertExpectations(t)
+			notifier.AssertExpectations(t)
+			if locked.Status != "pending" || status != "hold" {
+				mockDunningRepo.AssertNotCalled(t, "Create", mock.Anything)
+				mockSubscriptionRepo.AssertNotCalled(t, "Cancel", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestParseDunningSchedule(t *testing.T) {
+	schedule, err := models.ParseDunningSchedule("1:remind, 3:remind,14:cancel")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DunningSchedule{
+		{AfterDays: 1, Action: models.DunningActionRemind},
+		{AfterDays: 3, Action: models.DunningActionRemind},
+		{AfterDays: 14, Action: models.DunningActionCancel},
+	}, schedule)
+	assert.Equal(t, "1:remind,3:remind,14:cancel", schedule.String())
+
+	for _, value := range []string{"1", "x:remind", "1:notify", "3:remind,1:remind", "1:cancel,3:remind"} {
+		_, err := models.ParseDunningSchedule(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestCoupon_Discount(t *testing.T) {
+	fiveDollars := models.NewMoney(500, "USD")
+
+	tests := []struct {
+		name        string
+		coupon      models.Coupon
+		amount      models.Money
+		expected    models.Money
+		expectedErr error
+	}{
+		{
+			name:     "percent off rounds to the nearest minor unit",
+			coupon:   models.Coupon{DiscountType: models.CouponDiscountPercent, PercentOff: 15},
+			amount:   models.NewMoney(1999, "USD"),
+			expected: models.NewMoney(300, "USD"),
+		},
+		{
+			name:     "fixed amount off",
+			coupon:   models.Coupon{DiscountType: models.CouponDiscountFixed, AmountOff: &fiveDollars},
+			amount:   models.NewMoney(1999, "USD"),
+			expected: models.NewMoney(500, "USD"),
+		},
+		{
+			name:     "fixed amount is capped at the bill amount",
+			coupon:   models.Coupon{DiscountType: models.CouponDiscountFixed, AmountOff: &fiveDollars},
+			amount:   models.NewMoney(300, "USD"),
+			expected: models.NewMoney(300, "USD"),
+		},
+		{
+			name:        "fixed amount in another currency",
+			coupon:      models.Coupon{DiscountType: models.CouponDiscountFixed, AmountOff: &fiveDollars},
+			amount:      models.NewMoney(1999, "EUR"),
+			expectedErr: models.ErrCurrencyMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount, err := tt.coupon.Discount(tt.amount)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, discount)
+		})
+	}
+}
+
+func TestCoupon_Validate(t *testing.T) {
+	tests := []struct {
+		name          string
+		coupon        models.Coupon
+		errorContains string
+	}{
+		{
+			name:   "percent once",
+			coupon: models.Coupon{Code: "WELCOME", DiscountType: models.CouponDiscountPercent, PercentOff: 20, Duration: models.CouponDurationOnce},
+		},
+		{
+			name:          "percent over 100",
+			coupon:        models.Coupon{Code: "TOOMUCH", DiscountType: models.CouponDiscountPercent, PercentOff: 120, Duration: models.CouponDurationForever},
+			errorContains: "percent_off",
+		},
+		{
+			name:          "fixed without amount",
+			coupon:        models.Coupon{Code: "FIVE", DiscountType: models.CouponDiscountFixed, Duration: models.CouponDurationOnce},
+			errorContains: "amount_off",
+		},
+		{
+			name:          "repeating without cycles",
+			coupon:        models.Coupon{Code: "LOOP", DiscountType: models.CouponDiscountPercent, PercentOff: 10, Duration: models.CouponDurationRepeating},
+			errorContains: "duration_cycles",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.coupon.Validate()
+
+			if tt.errorContains != "" {
+				assert.ErrorContains(t, err, tt.errorContains)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSubscriptionService_CreateSubscriptionWithCoupon(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	product := &models.Product{ID: 4, Price: models.NewMoney(2000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}
+
+	tests := []struct {
+		name               string
+		coupon             *models.Coupon
+		redeemErr          error
+		expectedErr        error
+		expectedAmount     int64
+		expectedDiscount   int64
+		expectedCyclesLeft *int
+	}{
+		{
+			name:               "repeating coupon discounts the initial bill",
+			coupon:             &models.Coupon{ID: 7, Code: "SPRING", DiscountType: models.CouponDiscountPercent, PercentOff: 25, Duration: models.CouponDurationRepeating, DurationCycles: 3},
+			expectedAmount:     1500,
+			expectedDiscount:   500,
+			expectedCyclesLeft: intPtr(2),
+		},
+		{
+			name:             "forever coupon has no cycles to count",
+			coupon:           &models.Coupon{ID: 7, Code: "SPRING", DiscountType: models.CouponDiscountPercent, PercentOff: 10, Duration: models.CouponDurationForever},
+			expectedAmount:   1800,
+			expectedDiscount: 200,
+		},
+		{
+			name:        "expired coupon",
+			coupon:      &models.Coupon{ID: 7, Code: "SPRING", DiscountType: models.CouponDiscountPercent, PercentOff: 25, Duration: models.CouponDurationOnce, ExpiresAt: &expired},
+			expectedErr: models.ErrInvalidCoupon,
+		},
+		{
+			name:        "coupon restricted to other products",
+			coupon:      &models.Coupon{ID: 7, Code: "SPRING", DiscountType: models.CouponDiscountPercent, PercentOff: 25, Duration: models.CouponDurationOnce, ProductIDs: []int{1, 2}},
+			expectedErr: models.ErrInvalidCoupon,
+		},
+		{
+			name:        "coupon out of redemptions",
+			coupon:      &models.Coupon{ID: 7, Code: "SPRING", DiscountType: models.CouponDiscountPercent, PercentOff: 25, Duration: models.CouponDurationOnce, MaxRedemptions: intPtr(100)},
+			redeemErr:   models.ErrInvalidCoupon,
+			expectedErr: models.ErrInvalidCoupon,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockUserRepo := new(MockUserRepository)
+
+			mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 4).Return(nil, nil)
+			mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1}, nil)
+			mockProductRepo.On("GetByID", 4).Return(product, nil)
+			mockSubscriptionRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil).Maybe()
+			mockSubscriptionRepo.On("UseCouponCycle", mock.Anything).Return(nil).Maybe()
+			mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Maybe()
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			mockCouponRepo := uow.Repos.Coupons.(*MockCouponRepository)
+			mockCouponRepo.On("GetByCode", "SPRING").Return(tt.coupon, nil)
+			mockCouponRepo.On("GetByID", 7).Return(tt.coupon, nil).Maybe()
+			mockCouponRepo.On("Redeem", 7).Return(tt.redeemErr).Maybe()
+
+			service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+			subscription, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{
+				UserID:     1,
+				ProductID:  4,
+				CouponCode: "spring",
+			})
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.True(t, uow.RolledBack)
+				mockBillRepo.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, 7, *subscription.CouponID)
+			assert.Equal(t, tt.expectedCyclesLeft, subscription.CouponCyclesLeft)
+			assert.Equal(t, models.NewMoney(tt.expectedAmount, "USD"), bill.Amount)
+			assert.Equal(t, models.NewMoney(tt.expectedDiscount, "USD"), bill.Discount)
+			assert.Equal(t, 7, *bill.CouponID)
+			mockCouponRepo.AssertCalled(t, "Redeem", 7)
+			if tt.expectedCyclesLeft == nil {
+				mockSubscriptionRepo.AssertNotCalled(t, "UseCouponCycle", mock.Anything)
+			} else {
+				mockSubscriptionRepo.AssertCalled(t, "UseCouponCycle", subscription.ID)
+			}
+		})
+	}
+}
+
+func TestBillingService_GenerateBillsWithCoupon(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	coupon := &models.Coupon{ID: 7, Code: "SPRING", DiscountType: models.CouponDiscountPercent, PercentOff: 50, Duration: models.CouponDurationRepeating, DurationCycles: 3}
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+	uow.Repos.Coupons.(*MockCouponRepository).On("GetByID", 7).Return(coupon, nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 2, Status: "active", NextBillingDate: due, CouponID: &coupon.ID, CouponCyclesLeft: intPtr(1)},
+		{ID: 2, UserID: 6, ProductID: 2, Status: "active", NextBillingDate: due, CouponID: &coupon.ID, CouponCyclesLeft: intPtr(0)},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockSubscriptionRepo.On("HoldSubscription", 2).Return(nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	mockSubscriptionRepo.On("UseCouponCycle", 1).Return(nil)
+
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.SubscriptionID == 1 && bill.Amount == models.NewMoney(999, "USD") &&
+			bill.Discount == models.NewMoney(1000, "USD") && *bill.CouponID == 7
+	})).Return(nil)
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.SubscriptionID == 2 && bill.Amount == models.NewMoney(1999, "USD") && bill.CouponID == nil
+	})).Return(nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockSubscriptionRepo.AssertExpectations(t)
+	mockBillRepo.AssertExpectations(t)
+	mockSubscriptionRepo.AssertNotCalled(t, "UseCouponCycle", 2)
+}
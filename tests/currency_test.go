@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func multiCurrencyProduct() *models.Product {
+	return &models.Product{
+		ID:                   4,
+		Name:                 "Coffee Plan",
+		Price:                models.NewMoney(1999, "USD"),
+		Prices:               []models.Money{models.NewMoney(1999, "USD"), models.NewMoney(1899, "EUR")},
+		BillingInterval:      "month",
+		BillingIntervalCount: 1,
+	}
+}
+
+func TestProduct_PriceIn(t *testing.T) {
+	product := multiCurrencyProduct()
+
+	price, err := product.PriceIn("")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1999, "USD"), price)
+
+	price, err = product.PriceIn("eur")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1899, "EUR"), price)
+
+	_, err = product.PriceIn("GBP")
+	assert.ErrorIs(t, err, models.ErrPriceUnavailable)
+}
+
+func TestSubscriptionService_CreateSubscriptionCurrency(t *testing.T) {
+	tests := []struct {
+		name             string
+		userCurrency     string
+		currency         string
+		expectedErr      error
+		expectedCurrency string
+		expectedAmount   int64
+	}{
+		{
+			name:             "product's default currency",
+			expectedCurrency: "USD",
+			expectedAmount:   1999,
+		},
+		{
+			name:             "user's preferred currency",
+			userCurrency:     "EUR",
+			expectedCurrency: "EUR",
+			expectedAmount:   1899,
+		},
+		{
+			name:             "requested currency beats the user's",
+			userCurrency:     "EUR",
+			currency:         "usd",
+			expectedCurrency: "USD",
+			expectedAmount:   1999,
+		},
+		{
+			name:        "currency the product is not sold in",
+			currency:    "GBP",
+			expectedErr: models.ErrPriceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockUserRepo := new(MockUserRepository)
+
+			mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 4).Return(nil, nil)
+			mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1, Currency: tt.userCurrency}, nil)
+			mockProductRepo.On("GetByID", 4).Return(multiCurrencyProduct(), nil)
+			mockSubscriptionRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil).Maybe()
+			mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Maybe()
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+			subscription, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{
+				UserID:    1,
+				ProductID: 4,
+				Currency:  tt.currency,
+			})
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				mockSubscriptionRepo.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCurrency, subscription.Currency)
+			assert.Equal(t, models.NewMoney(tt.expectedAmount, tt.expectedCurrency), bill.Amount)
+		})
+	}
+}
+
+func TestSubscriptionService_ChangePlanRequiresPriceInCurrency(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{ID: 1, UserID: 1, ProductID: 4, Currency: "EUR", Status: "active"}, nil)
+	mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 5).Return(nil, nil)
+	mockProductRepo.On("GetByID", 5).Return(&models.Product{ID: 5, Price: models.NewMoney(2999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+	_, _, err := service.ChangePlan(context.Background(), 1, 5, services.PlanChangeAtRenewal)
+
+	assert.ErrorIs(t, err, models.ErrPriceUnavailable)
+	mockSubscriptionRepo.AssertNotCalled(t, "SchedulePlanChange", mock.Anything, mock.Anything)
+}
+
+func TestProductService_GetAllProductsInCurrency(t *testing.T) {
+	mockProductRepo := new(MockProductRepository)
+	mockProductRepo.On("GetAll").Return([]*models.Product{
+		multiCurrencyProduct(),
+		{ID: 5, Name: "Tea Plan", Price: models.NewMoney(999, "USD"), Prices: []models.Money{models.NewMoney(999, "USD")}},
+	}, nil)
+
+	service := services.NewProductService(mockProductRepo)
+
+	products, err := service.GetAllProducts(context.Background(), "eur")
+
+	assert.NoError(t, err)
+	if assert.Len(t, products, 1) {
+		assert.Equal(t, 4, products[0].ID)
+		assert.Equal(t, models.NewMoney(1899, "EUR"), products[0].Price)
+	}
+}
+
+func TestBillingService_GenerateBillsInSubscriptionCurrency(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "EUR").Return(models.NewMoney(0, "EUR"), nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 4, Currency: "EUR", Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockProductRepo.On("GetByID", 4).Return(multiCurrencyProduct(), nil)
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.Amount == models.NewMoney(1899, "EUR")
+	})).Return(nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockBillRepo.AssertExpectations(t)
+}
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+)
+
+func TestFakeProvider_ScriptedOutcomes(t *testing.T) {
+	ctx := context.Background()
+	provider := payments.NewFakeProvider()
+	provider.Script(payments.OutcomeDecline, payments.OutcomeTimeout)
+
+	request := payments.ChargeRequest{Amount: models.NewMoney(1999, "USD"), PaymentMethod: "tok_visa"}
+
+	_, err := provider.Charge(ctx, request)
+	assert.Equal(t, payments.FailureCodeDeclined, payments.FailureCode(err))
+
+	_, err = provider.Charge(ctx, request)
+	assert.Equal(t, payments.FailureCodeTimeout, payments.FailureCode(err))
+
+	charge, err := provider.Charge(ctx, request)
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1999, "USD"), charge.Amount)
+}
+
+func TestFakeProvider_TokenOutcomes(t *testing.T) {
+	ctx := context.Background()
+	provider := payments.NewFakeProvider()
+
+	token, err := provider.Tokenize(ctx, payments.PaymentMethodDetails{Type: payments.PaymentMethodCard, Number: payments.FakeCardDecline})
+	assert.NoError(t, err)
+	assert.Equal(t, "0002", token.Last4)
+
+	_, err = provider.Charge(ctx, payments.ChargeRequest{Amount: models.NewMoney(1999, "USD"), PaymentMethod: token.Token})
+	assert.Equal(t, payments.FailureCodeDeclined, payments.FailureCode(err))
+
+	_, err = provider.Tokenize(ctx, payments.PaymentMethodDetails{Type: "cash", Number: "1234"})
+	assert.Error(t, err)
+}
+
+func TestFakeProvider_IdempotencyAndRefunds(t *testing.T) {
+	ctx := context.Background()
+	provider := payments.NewFakeProvider()
+
+	request := payments.ChargeRequest{Amount: models.NewMoney(1999, "USD"), PaymentMethod: "tok_visa", IdempotencyKey: "bill-1-attempt-1"}
+	first, err := provider.Charge(ctx, request)
+	assert.NoError(t, err)
+	second, err := provider.Charge(ctx, request)
+	assert.NoError(t, err)
+	assert.Equal(t, first.Reference, second.Reference)
+
+	_, err = provider.Refund(ctx, payments.RefundRequest{ChargeReference: first.Reference, Amount: models.NewMoney(1000, "USD")})
+	assert.NoError(t, err)
+
+	_, err = provider.Refund(ctx, payments.RefundRequest{ChargeReference: first.Reference, Amount: models.NewMoney(1000, "USD")})
+	assert.Error(t, err)
+
+	_, err = provider.Refund(ctx, payments.RefundRequest{ChargeReference: "fake_ch_missing", Amount: models.NewMoney(1, "USD")})
+	assert.Error(t, err)
+}
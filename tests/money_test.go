@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zaher1307/subscription-service/internal/models"
+)
+
+func TestMoney_MulRat(t *testing.T) {
+	tests := []struct {
+		name        string
+		money       models.Money
+		numerator   int64
+		denominator int64
+		expected    int64
+	}{
+		{name: "exact", money: models.NewMoney(1000, "USD"), numerator: 1, denominator: 4, expected: 250},
+		{name: "rounds down below half", money: models.NewMoney(1999, "USD"), numerator: 1, denominator: 3, expected: 666},
+		{name: "rounds half away from zero", money: models.NewMoney(1, "USD"), numerator: 1, denominator: 2, expected: 1},
+		{name: "negative half away from zero", money: models.NewMoney(-1, "USD"), numerator: 1, denominator: 2, expected: -1},
+		{name: "negative denominator", money: models.NewMoney(1999, "USD"), numerator: 1, denominator: -2, expected: -1000},
+		{name: "proration by seconds", money: models.NewMoney(1999, "USD"), numerator: 15 * 86400, denominator: 30 * 86400, expected: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.money.MulRat(tt.numerator, tt.denominator)
+			assert.Equal(t, tt.expected, result.Amount)
+			assert.Equal(t, tt.money.Currency, result.Currency)
+		})
+	}
+}
+
+func TestMoney_AddCurrencyMismatch(t *testing.T) {
+	sum, err := models.NewMoney(1999, "usd").Add(models.NewMoney(1, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(2000, "USD"), sum)
+
+	_, err = models.NewMoney(1999, "USD").Add(models.NewMoney(1, "EUR"))
+	assert.ErrorIs(t, err, models.ErrCurrencyMismatch)
+}
+
+func TestMoney_StringAndJSON(t *testing.T) {
+	assert.Equal(t, "19.99 USD", models.NewMoney(1999, "USD").String())
+	assert.Equal(t, "-0.05 EUR", models.NewMoney(-5, "EUR").String())
+	assert.Equal(t, "1999 JPY", models.NewMoney(1999, "JPY").String())
+	assert.Equal(t, "1.999 KWD", models.NewMoney(1999, "KWD").String())
+
+	encoded, err := json.Marshal(models.NewMoney(1999, "USD"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount": 1999, "currency": "USD"}`, string(encoded))
+}
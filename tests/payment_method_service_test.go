@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func TestPaymentMethodService_AddPaymentMethod(t *testing.T) {
+	card := payments.PaymentMethodDetails{Type: payments.PaymentMethodCard, Number: "4242424242424242", ExpMonth: 12, ExpYear: 2030}
+
+	tests := []struct {
+		name            string
+		makeDefault     bool
+		currentDefault  *models.PaymentMethod
+		expectIsDefault bool
+	}{
+		{name: "first method becomes the default", expectIsDefault: true},
+		{name: "later method keeps the current default", currentDefault: &models.PaymentMethod{ID: 4}},
+		{name: "later method made default on request", makeDefault: true, currentDefault: &models.PaymentMethod{ID: 4}, expectIsDefault: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserRepo := new(MockUserRepository)
+			uow := newMockUnitOfWork(new(MockSubscriptionRepository), new(MockProductRepository), new(MockBillRepository), mockUserRepo)
+			mockMethodRepo := uow.Repos.PaymentMethods.(*MockPaymentMethodRepository)
+
+			mockUserRepo.On("GetByID", 5).Return(&models.User{ID: 5}, nil)
+			mockMethodRepo.On("Create", mock.MatchedBy(func(method *models.PaymentMethod) bool {
+				return method.UserID == 5 && method.Last4 == "4242" && method.Token != "" && *method.ExpYear == 2030
+			})).Return(nil)
+			if tt.currentDefault != nil {
+				mockMethodRepo.On("GetDefaultByUserID", 5).Return(tt.currentDefault, nil)
+			} else {
+				mockMethodRepo.On("GetDefaultByUserID", 5).Return(nil, nil)
+			}
+			if tt.expectIsDefault {
+				mockMethodRepo.On("SetDefault", 5, 1).Return(nil)
+			}
+
+			service := services.NewPaymentMethodService(uow, payments.NewFakeProvider())
+			method, err := service.AddPaymentMethod(context.Background(), 5, card, tt.makeDefault)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectIsDefault, method.IsDefault)
+			assert.True(t, uow.Committed)
+			mockMethodRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPaymentMethodService_OtherUsersMethod(t *testing.T) {
+	uow := newMockUnitOfWork(new(MockSubscriptionRepository), new(MockProductRepository), new(MockBillRepository), new(MockUserRepository))
+	mockMethodRepo := uow.Repos.PaymentMethods.(*MockPaymentMethodRepository)
+	mockMethodRepo.On("GetByID", 3).Return(&models.PaymentMethod{ID: 3, UserID: 9}, nil)
+	mockMethodRepo.On("GetByID", 4).Return(nil, errors.New("payment method 4 not found"))
+
+	service := services.NewPaymentMethodService(uow, payments.NewFakeProvider())
+
+	_, err := service.SetDefaultPaymentMethod(context.Background(), 5, 3)
+	assert.EqualError(t, err, "payment method 3 not found")
+
+	err = service.RemovePaymentMethod(context.Background(), 5, 3)
+	assert.EqualError(t, err, "payment method 3 not found")
+
+	err = service.RemovePaymentMethod(context.Background(), 5, 4)
+	assert.Error(t, err)
+
+	mockMethodRepo.AssertNotCalled(t, "SetDefault", mock.Anything, mock.Anything)
+	mockMethodRepo.AssertNotCalled(t, "Delete", mock.Anything)
+}
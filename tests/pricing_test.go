@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func tieredProduct(scheme string) *models.Product {
+	return &models.Product{
+		ID:                   7,
+		Name:                 "Team Plan",
+		Price:                models.NewMoney(1000, "USD"),
+		Prices:               []models.Money{models.NewMoney(1000, "USD")},
+		BillingInterval:      "month",
+		BillingIntervalCount: 1,
+		PricingScheme:        scheme,
+		Tiers: []models.PriceTier{
+			{UpTo: int64Ptr(5), UnitAmount: models.NewMoney(1000, "USD")},
+			{UpTo: int64Ptr(20), UnitAmount: models.NewMoney(800, "USD")},
+			{UnitAmount: models.NewMoney(500, "USD")},
+		},
+	}
+}
+
+func TestProductService_QuotePrice(t *testing.T) {
+	packaged := tieredProduct(models.PricingSchemePackage)
+	packaged.PackageSize = 10
+
+	tests := []struct {
+		name                 string
+		product              *models.Product
+		quantity             int64
+		currency             string
+		expectedErr          error
+		expectedErrContains  string
+		expectedDescriptions []string
+		expectedAmounts      []int64
+		expectedAmount       int64
+	}{
+		{
+			name:                 "flat",
+			product:              tieredProduct(models.PricingSchemeFlat),
+			quantity:             12,
+			expectedDescriptions: []string{"Team Plan"},
+			expectedAmounts:      []int64{1000},
+			expectedAmount:       1000,
+		},
+		{
+			name:                 "per unit by default",
+			product:              tieredProduct(""),
+			quantity:             12,
+			expectedDescriptions: []string{"Team Plan"},
+			expectedAmounts:      []int64{12000},
+			expectedAmount:       12000,
+		},
+		{
+			name:                 "graduated",
+			product:              tieredProduct(models.PricingSchemeGraduated),
+			quantity:             25,
+			expectedDescriptions: []string{"Team Plan (1 to 5)", "Team Plan (6 to 20)", "Team Plan (21 and above)"},
+			expectedAmounts:      []int64{5000, 12000, 2500},
+			expectedAmount:       19500,
+		},
+		{
+			name:                 "volume",
+			product:              tieredProduct(models.PricingSchemeVolume),
+			quantity:             12,
+			expectedDescriptions: []string{"Team Plan (6 to 20)"},
+			expectedAmounts:      []int64{9600},
+			expectedAmount:       9600,
+		},
+		{
+			name:                 "package rounds up to whole packages",
+			product:              packaged,
+			quantity:             25,
+			expectedDescriptions: []string{"Team Plan (packages of 10)"},
+			expectedAmounts:      []int64{3000},
+			expectedAmount:       3000,
+		},
+		{
+			name:           "nothing to price",
+			product:        tieredProduct(models.PricingSchemeGraduated),
+			quantity:       0,
+			expectedAmount: 0,
+		},
+		{
+			name:        "no tiers in currency",
+			product:     tieredProduct(models.PricingSchemeVolume),
+			quantity:    3,
+			currency:    "EUR",
+			expectedErr: models.ErrPriceUnavailable,
+		},
+		{
+			name:                "package without a size",
+			product:             tieredProduct(models.PricingSchemePackage),
+			quantity:            3,
+			expectedErrContains: "no package size",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProductRepo := new(MockProductRepository)
+			mockProductRepo.On("GetByID", 7).Return(tt.product, nil)
+
+			service := services.NewProductService(mockProductRepo)
+
+			quote, err := service.QuotePrice(context.Background(), 7, tt.currency, tt.quantity)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			if tt.expectedErrContains != "" {
+				assert.ErrorContains(t, err, tt.expectedErrContains)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.quantity, quote.Quantity)
+			assert.Equal(t, models.NewMoney(tt.expectedAmount, "USD"), quote.Amount)
+			if assert.Len(t, quote.Lines, len(tt.expectedAmounts)) {
+				for i, line := range quote.Lines {
+					assert.Equal(t, tt.expectedDescriptions[i], line.Description)
+					assert.Equal(t, models.NewMoney(tt.expectedAmounts[i], "USD"), line.Amount)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionService_CreateSubscriptionGraduated(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 7).Return(nil, nil)
+	mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1}, nil)
+	mockProductRepo.On("GetByID", 7).Return(tieredProduct(models.PricingSchemeGraduated), nil)
+	mockSubscriptionRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil)
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+	_, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{UserID: 1, ProductID: 7, Quantity: 8})
+
+	assert.NoError(t, err)
+	if assert.Len(t, bill.Items, 2) {
+		assert.Equal(t, "Team Plan (1 to 5)", bill.Items[0].Description)
+		assert.Equal(t, models.NewMoney(5000, "USD"), bill.Items[0].Amount)
+		assert.Equal(t, "Team Plan (6 to 20)", bill.Items[1].Description)
+		assert.Equal(t, models.NewMoney(2400, "USD"), bill.Items[1].Amount)
+	}
+	assert.Equal(t, models.NewMoney(7400, "USD"), bill.Amount)
+}
+
+func TestSubscriptionService_ChangeQuantityVolume(t *testing.T) {
+	start := time.Now().AddDate(0, 0, -15)
+	next := time.Now().AddDate(0, 0, 15)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+
+	mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{
+		ID: 1, UserID: 1, ProductID: 7, Currency: "USD", Quantity: 4, Status: "active", StartDate: start, NextBillingDate: next,
+	}, nil)
+	mockSubscriptionRepo.On("UpdateQuantity", 1, 6).Return(nil)
+	mockProductRepo.On("GetByID", 7).Return(tieredProduct(models.PricingSchemeVolume), nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository))
+	uow.Repos.PendingItems.(*MockPendingItemRepository).On("Create", mock.AnythingOfType("*models.PendingItem")).Return(nil)
+
+	service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository), uow, nil)
+
+	_, item, err := service.ChangeQuantity(context.Background(), 1, 6)
+
+	// 6 seats at 8.00 cost 8.00 more a month than 4 at 10.00; half the
+	// period is left.
+	assert.NoError(t, err)
+	if assert.NotNil(t, item) {
+		assert.Equal(t, "Remaining time on Team Plan", item.Description)
+		assert.Equal(t, 1, item.Quantity)
+		assert.InDelta(t, 400, item.UnitAmount.Amount, 2)
+	}
+}
@@ -0,0 +1,295 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func TestSubscriptionService_CreateSubscriptionWithQuantity(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 4).Return(nil, nil)
+	mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1}, nil)
+	mockProductRepo.On("GetByID", 4).Return(&models.Product{ID: 4, Name: "Team Plan", Price: models.NewMoney(1000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	mockSubscriptionRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil)
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+	subscription, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{UserID: 1, ProductID: 4, Quantity: 10})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 10, subscription.Quantity)
+	assert.Equal(t, models.NewMoney(10000, "USD"), bill.Amount)
+	if assert.Len(t, bill.Items, 1) {
+		assert.Equal(t, 10, bill.Items[0].Quantity)
+		assert.Equal(t, models.NewMoney(1000, "USD"), bill.Items[0].UnitAmount)
+	}
+}
+
+func TestSubscriptionService_ChangeQuantity(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-15 * 24 * time.Hour)
+	next := now.Add(15 * 24 * time.Hour)
+
+	tests := []struct {
+		name                string
+		status              string
+		quantity            int
+		expectedErrContains string
+		expectItem          bool
+		expectedDescription string
+		expectedQuantity    int
+		expectCredit        bool
+	}{
+		{
+			name:                "adding seats charges the rest of the period",
+			status:              models.SubscriptionStatusActive,
+			quantity:            15,
+			expectItem:          true,
+			expectedDescription: "Remaining time on Team Plan",
+			expectedQuantity:    5,
+		},
+		{
+			name:                "removing seats credits the rest of the period",
+			status:              models.SubscriptionStatusActive,
+			quantity:            4,
+			expectItem:          true,
+			expectedDescription: "Unused time on Team Plan",
+			expectedQuantity:    6,
+			expectCredit:        true,
+		},
+		{
+			name:     "trialing subscription has nothing to prorate",
+			status:   models.SubscriptionStatusTrialing,
+			quantity: 15,
+		},
+		{
+			name:                "same quantity",
+			status:              models.SubscriptionStatusActive,
+			quantity:            10,
+			expectedErrContains: "already has this quantity",
+		},
+		{
+			name:                "paused subscription",
+			status:              models.SubscriptionStatusPaused,
+			quantity:            15,
+			expectedErrContains: "only active or trialing",
+		},
+		{
+			name:                "zero quantity",
+			status:              models.SubscriptionStatusActive,
+			quantity:            0,
+			expectedErrContains: "at least 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+
+			mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{
+				ID: 1, UserID: 1, ProductID: 4, Currency: "USD", Quantity: 10, Status: tt.status, StartDate: start, NextBillingDate: next,
+			}, nil)
+			mockSubscriptionRepo.On("UpdateQuantity", 1, tt.quantity).Return(nil).Maybe()
+			mockProductRepo.On("GetByID", 4).Return(&models.Product{ID: 4, Name: "Team Plan", Price: models.NewMoney(3000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository))
+			mockPendingItemRepo := uow.Repos.PendingItems.(*MockPendingItemRepository)
+			mockPendingItemRepo.On("Create", mock.AnythingOfType("*models.PendingItem")).Return(nil).Maybe()
+
+			service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository), uow, nil)
+
+			subscription, item, err := service.ChangeQuantity(context.Background(), 1, tt.quantity)
+
+			if tt.expectedErrContains != "" {
+				assert.ErrorContains(t, err, tt.expectedErrContains)
+				mockSubscriptionRepo.AssertNotCalled(t, "UpdateQuantity", mock.Anything, mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.quantity, subscription.Quantity)
+			mockSubscriptionRepo.AssertCalled(t, "UpdateQuantity", 1, tt.quantity)
+
+			if !tt.expectItem {
+				assert.Nil(t, item)
+				mockPendingItemRepo.AssertNotCalled(t, "Create", mock.Anything)
+				return
+			}
+
+			if assert.NotNil(t, item) {
+				assert.Equal(t, models.BillItemKindProration, item.Kind)
+				assert.Equal(t, tt.expectedDescription, item.Description)
+				assert.Equal(t, tt.expectedQuantity, item.Quantity)
+				assert.InDelta(t, 1500, abs(item.UnitAmount.Amount), 2)
+				assert.Equal(t, tt.expectCredit, item.UnitAmount.IsNegative())
+				assert.Equal(t, next, *item.PeriodEnd)
+			}
+		})
+	}
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func TestBillingService_GenerateBillsAddsPendingItems(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	periodStart := time.Date(2025, time.February, 25, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+	expectNoAddOns(uow)
+
+	mockPendingItemRepo := uow.Repos.PendingItems.(*MockPendingItemRepository)
+	mockPendingItemRepo.On("GetUnbilled", 1).Return([]*models.PendingItem{
+		{ID: 3, SubscriptionID: 1, Kind: models.BillItemKindProration, Description: "Remaining time on Team Plan", Quantity: 5, UnitAmount: models.NewMoney(500, "USD"), PeriodStart: &periodStart, PeriodEnd: &due},
+	}, nil)
+	mockPendingItemRepo.On("MarkBilled", []int{3}, 1).Return(nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 4, Currency: "USD", Quantity: 15, Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockProductRepo.On("GetByID", 4).Return(&models.Product{ID: 4, Name: "Team Plan", Price: models.NewMoney(1000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+	var created *models.Bill
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*models.Bill)
+	})
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	if assert.Len(t, created.Items, 2) {
+		assert.Equal(t, models.NewMoney(15000, "USD"), created.Items[0].Amount)
+		assert.Equal(t, "Remaining time on Team Plan", created.Items[1].Description)
+		assert.Equal(t, models.NewMoney(2500, "USD"), created.Items[1].Amount)
+	}
+	assert.Equal(t, models.NewMoney(17500, "USD"), created.Amount)
+	mockPendingItemRepo.AssertExpectations(t)
+}
+
+func TestBillingService_GenerateBillsCreditsNegativeRenewal(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+
+	mockPendingItemRepo := uow.Repos.PendingItems.(*MockPendingItemRepository)
+	mockPendingItemRepo.On("GetUnbilled", 1).Return([]*models.PendingItem{
+		{ID: 3, SubscriptionID: 1, Kind: models.BillItemKindProration, Description: "Unused time on Team Plan", Quantity: 9, UnitAmount: models.NewMoney(-500, "USD")},
+	}, nil)
+	mockPendingItemRepo.On("MarkBilled", []int{3}, 1).Return(nil)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("Create", mock.MatchedBy(func(entry *models.BalanceEntry) bool {
+		return entry.UserID == 5 && entry.Amount == models.NewMoney(3500, "USD")
+	})).Return(nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 4, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockSubscriptionRepo.On("UpdateStartDate", 1, due).Return(nil)
+	mockSubscriptionRepo.On("UpdateNextBillingDate", 1, due.AddDate(0, 1, 0)).Return(nil)
+	mockSubscriptionRepo.On("ActivateSubscription", 1).Return(nil)
+	mockProductRepo.On("GetByID", 4).Return(&models.Product{ID: 4, Name: "Team Plan", Price: models.NewMoney(1000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.Amount == models.NewMoney(-3500, "USD") && bill.Status == models.BillStatusCredit
+	})).Return(nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockBillRepo.AssertExpectations(t)
+	mockSubscriptionRepo.AssertExpectations(t)
+	mockBillRepo.AssertNotCalled(t, "MarkAsPaid", mock.Anything)
+}
+
+func TestSubscriptionService_CancelBillsPendingItemsOnPayableFinalBill(t *testing.T) {
+	start := time.Now().AddDate(0, 0, -10)
+	next := start.AddDate(0, 1, 0)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+
+	mockSubscriptionRepo.On("LockByID", 1).Return(&models.Subscription{
+		ID: 1, UserID: 5, ProductID: 4, Currency: "USD", Quantity: 15, Status: "active", StartDate: start, NextBillingDate: next,
+	}, nil).Once()
+	mockBillRepo.On("MarkOpenUncollectible", 1).Return(nil)
+	mockSubscriptionRepo.On("Cancel", 1, mock.AnythingOfType("time.Time"), "too expensive").Return(nil)
+	mockProductRepo.On("GetByID", 4).Return(&models.Product{ID: 4, Name: "Team Plan", Price: models.NewMoney(1000, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+	mockPendingItemRepo := uow.Repos.PendingItems.(*MockPendingItemRepository)
+	mockPendingItemRepo.On("GetUnbilled", 1).Return([]*models.PendingItem{
+		{ID: 3, SubscriptionID: 1, Kind: models.BillItemKindProration, Description: "Remaining time on Team Plan", Quantity: 5, UnitAmount: models.NewMoney(500, "USD"), PeriodStart: &start, PeriodEnd: &next},
+	}, nil)
+	mockPendingItemRepo.On("MarkBilled", []int{3}, 1).Return(nil)
+
+	var final *models.Bill
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		final = args.Get(0).(*models.Bill)
+	})
+
+	subscriptionService := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, nil)
+
+	_, bill, err := subscriptionService.CancelSubscription(context.Background(), 1, services.CancelImmediately, "too expensive", false)
+
+	assert.NoError(t, err)
+	if !assert.NotNil(t, bill) {
+		return
+	}
+	assert.Equal(t, models.BillTypeAdjustment, bill.Type)
+	assert.Equal(t, models.BillStatusPending, bill.Status)
+	assert.Equal(t, models.NewMoney(2500, "USD"), bill.Amount)
+
+	mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{ID: 1, UserID: 5, ProductID: 4, Status: "cancelled"}, nil)
+	mockBillRepo.On("GetByID", final.ID).Return(final, nil)
+	mockSubscriptionRepo.On("LockByID", 1).Return(&models.Subscription{ID: 1, UserID: 5, ProductID: 4, Status: "cancelled"}, nil)
+	mockBillRepo.On("LockByID", final.ID).Return(final, nil)
+	mockBillRepo.On("MarkAsPaid", final.ID).Return(nil)
+	uow.Repos.Payments.(*MockPaymentAttemptRepository).On("GetByBillID", final.ID).Return([]*models.PaymentAttempt{}, nil)
+	uow.Repos.Payments.(*MockPaymentAttemptRepository).On("Create", mock.MatchedBy(func(attempt *models.PaymentAttempt) bool {
+		return attempt.Status == models.PaymentAttemptStatusSucceeded && attempt.Amount == models.NewMoney(2500, "USD")
+	})).Return(nil)
+	uow.Repos.PaymentMethods.(*MockPaymentMethodRepository).On("GetDefaultByUserID", 5).Return(&models.PaymentMethod{ID: 7, UserID: 5, Token: "tok_visa"}, nil)
+
+	billingService := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	err = billingService.PayBill(context.Background(), final.ID, 0)
+
+	assert.NoError(t, err)
+	mockBillRepo.AssertCalled(t, "MarkAsPaid", final.ID)
+	mockSubscriptionRepo.AssertNotCalled(t, "ActivateSubscription", mock.Anything)
+}
@@ -2,8 +2,10 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -23,19 +25,52 @@ type MockSubscriptionService struct {
 
 var _ services.ISubscriptionService = (*MockSubscriptionService)(nil)
 
-func (m *MockSubscriptionService) CreateSubscription(userID, productID int) (*models.Subscription, *models.Bill, error) {
-	args := m.Called(userID, productID)
+func (m *MockSubscriptionService) CreateSubscription(ctx context.Context, params services.CreateSubscriptionParams) (*models.Subscription, *models.Bill, error) {
+	args := m.Called(params)
 	subscription, _ := args.Get(0).(*models.Subscription)
 	bill, _ := args.Get(1).(*models.Bill)
 	return subscription, bill, args.Error(2)
 }
 
-func (m *MockSubscriptionService) GetSubscription(id int) (*models.Subscription, error) {
+func (m *MockSubscriptionService) GetSubscription(ctx context.Context, id int) (*models.Subscription, error) {
 	args := m.Called(id)
 	subscription, _ := args.Get(0).(*models.Subscription)
 	return subscription, args.Error(1)
 }
 
+func (m *MockSubscriptionService) CancelSubscription(ctx context.Context, id int, mode services.CancellationMode, reason string, prorateCredit bool) (*models.Subscription, *models.Bill, error) {
+	args := m.Called(id, mode, reason, prorateCredit)
+	subscription, _ := args.Get(0).(*models.Subscription)
+	bill, _ := args.Get(1).(*models.Bill)
+	return subscription, bill, args.Error(2)
+}
+
+func (m *MockSubscriptionService) PauseSubscription(ctx context.Context, id int, resumeAt *time.Time) (*models.Subscription, error) {
+	args := m.Called(id, resumeAt)
+	subscription, _ := args.Get(0).(*models.Subscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockSubscriptionService) ResumeSubscription(ctx context.Context, id int) (*models.Subscription, error) {
+	args := m.Called(id)
+	subscription, _ := args.Get(0).(*models.Subscription)
+	return subscription, args.Error(1)
+}
+
+func (m *MockSubscriptionService) ChangePlan(ctx context.Context, id, productID int, mode services.PlanChangeMode) (*models.Subscription, *models.Bill, error) {
+	args := m.Called(id, productID, mode)
+	subscription, _ := args.Get(0).(*models.Subscription)
+	bill, _ := args.Get(1).(*models.Bill)
+	return subscription, bill, args.Error(2)
+}
+
+func (m *MockSubscriptionService) ChangeQuantity(ctx context.Context, id, quantity int) (*models.Subscription, *models.PendingItem, error) {
+	args := m.Called(id, quantity)
+	subscription, _ := args.Get(0).(*models.Subscription)
+	item, _ := args.Get(1).(*models.PendingItem)
+	return subscription, item, args.Error(2)
+}
+
 func TestSubscriptionHandler_Create(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -69,12 +104,12 @@ func TestSubscriptionHandler_Create(t *testing.T) {
 				bill := &models.Bill{
 					ID:             1,
 					SubscriptionID: 1,
-					Amount:         99.99,
+					Amount:         models.NewMoney(9999, "USD"),
 					Status:         "paid",
 					PaidAt:         &now,
 				}
 
-				mockService.On("CreateSubscription", 1, 2).Return(subscription, bill, nil)
+				mockService.On("CreateSubscription", services.CreateSubscriptionParams{UserID: 1, ProductID: 2}).Return(subscription, bill, nil)
 			},
 			expectedStatusCode: http.StatusCreated,
 			expectedResponse: map[string]interface{}{
@@ -101,13 +136,42 @@ func TestSubscriptionHandler_Create(t *testing.T) {
 				"product_id": 2,
 			},
 			mockSetup: func(mockService *MockSubscriptionService) {
-				mockService.On("CreateSubscription", 1, 2).Return(nil, nil, errors.New("service error"))
+				mockService.On("CreateSubscription", services.CreateSubscriptionParams{UserID: 1, ProductID: 2}).Return(nil, nil, errors.New("service error"))
 			},
 			expectedStatusCode: http.StatusInternalServerError,
 			expectedResponse: map[string]interface{}{
 				"error": "service error",
 			},
 		},
+		{
+			name: "invalid coupon",
+			requestBody: map[string]interface{}{
+				"user_id":     1,
+				"product_id":  2,
+				"coupon_code": "EXPIRED",
+			},
+			mockSetup: func(mockService *MockSubscriptionService) {
+				mockService.On("CreateSubscription", services.CreateSubscriptionParams{UserID: 1, ProductID: 2, CouponCode: "EXPIRED"}).Return(nil, nil, fmt.Errorf("%w: coupon EXPIRED has expired", models.ErrInvalidCoupon))
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedResponse: map[string]interface{}{
+				"error": "invalid coupon: coupon EXPIRED has expired",
+			},
+		},
+		{
+			name: "user already subscribed",
+			requestBody: map[string]interface{}{
+				"user_id":    1,
+				"product_id": 2,
+			},
+			mockSetup: func(mockService *MockSubscriptionService) {
+				mockService.On("CreateSubscription", services.CreateSubscriptionParams{UserID: 1, ProductID: 2}).Return(nil, nil, models.ErrSubscriptionExists)
+			},
+			expectedStatusCode: http.StatusConflict,
+			expectedResponse: map[string]interface{}{
+				"error": "user already has an active subscription for this product",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -18,14 +19,14 @@ type MockSubscriptionRepository struct {
 
 var _ repositories.ISubscriptionRepository = (*MockSubscriptionRepository)(nil)
 
-func (m *MockSubscriptionRepository) Create(subscription *models.Subscription) error {
+func (m *MockSubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
 	args := m.Called(subscription)
 	subscription.ID = 1
 	subscription.CreatedAt = time.Now()
 	return args.Error(0)
 }
 
-func (m *MockSubscriptionRepository) GetByID(id int) (*models.Subscription, error) {
+func (m *MockSubscriptionRepository) GetByID(ctx context.Context, id int) (*models.Subscription, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -33,7 +34,23 @@ func (m *MockSubscriptionRepository) GetByID(id int) (*models.Subscription, erro
 	return args.Get(0).(*models.Subscription), args.Error(1)
 }
 
-func (m *MockSubscriptionRepository) GetActiveByUserAndProduct(userID, productID int) (*models.Subscription, error) {
+func (m *MockSubscriptionRepository) LockByID(ctx context.Context, id int) (*models.Subscription, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Subscription), args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) ShareLockByID(ctx context.Context, id int) (*models.Subscription, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Subscription), args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) GetActiveByUserAndProduct(ctx context.Context, userID, productID int) (*models.Subscription, error) {
 	args := m.Called(userID, productID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -41,7 +58,7 @@ func (m *MockSubscriptionRepository) GetActiveByUserAndProduct(userID, productID
 	return args.Get(0).(*models.Subscription), args.Error(1)
 }
 
-func (m *MockSubscriptionRepository) GetDueForBilling(date time.Time) ([]*models.Subscription, error) {
+func (m *MockSubscriptionRepository) GetDueForBilling(ctx context.Context, date time.Time) ([]*models.Subscription, error) {
 	args := m.Called(date)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -49,33 +66,109 @@ func (m *MockSubscriptionRepository) GetDueForBilling(date time.Time) ([]*models
 	return args.Get(0).([]*models.Subscription), args.Error(1)
 }
 
-func (m *MockSubscriptionRepository) UpdateNextBillingDate(id int, nextDate time.Time) error {
+func (m *MockSubscriptionRepository) LockDueForBilling(ctx context.Context, id int, date time.Time) (*models.Subscription, error) {
+	args := m.Called(id, date)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Subscription), args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) UpdateNextBillingDate(ctx context.Context, id int, nextDate time.Time) error {
 	args := m.Called(id, nextDate)
 	return args.Error(0)
 }
 
-func (m *MockSubscriptionRepository) UpdateStartDate(id int, nextDate time.Time) error {
+func (m *MockSubscriptionRepository) UpdateStartDate(ctx context.Context, id int, nextDate time.Time) error {
 	args := m.Called(id, nextDate)
 	return args.Error(0)
 }
 
-func (m *MockSubscriptionRepository) HoldSubscription(id int) error {
+func (m *MockSubscriptionRepository) HoldSubscription(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) ActivateSubscription(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) MarkPastDue(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) MarkUnpaid(ctx context.Context, id int) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
-func (m *MockSubscriptionRepository) ActivateSubscription(id int) error {
+func (m *MockSubscriptionRepository) ScheduleCancellation(ctx context.Context, id int, reason string) error {
+	args := m.Called(id, reason)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) Cancel(ctx context.Context, id int, cancelledAt time.Time, reason string) error {
+	args := m.Called(id, cancelledAt, reason)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) GetDueForResume(ctx context.Context, date time.Time) ([]*models.Subscription, error) {
+	args := m.Called(date)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Subscription), args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) Pause(ctx context.Context, id int, pausedAt time.Time, resumeAt *time.Time) error {
+	args := m.Called(id, pausedAt, resumeAt)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) Resume(ctx context.Context, id int, billingAnchor, startDate, nextBillingDate time.Time) error {
+	args := m.Called(id, billingAnchor, startDate, nextBillingDate)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) UpdateBillingAnchor(ctx context.Context, id int, anchor time.Time) error {
+	args := m.Called(id, anchor)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) ChangeProduct(ctx context.Context, id, productID int) error {
+	args := m.Called(id, productID)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) SchedulePlanChange(ctx context.Context, id int, productID *int) error {
+	args := m.Called(id, productID)
+	return args.Error(0)
+}
+
+func (m *MockSubscriptionRepository) HasUsedTrial(ctx context.Context, userID, productID int) (bool, error) {
+	args := m.Called(userID, productID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockSubscriptionRepository) UseCouponCycle(ctx context.Context, id int) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
+func (m *MockSubscriptionRepository) UpdateQuantity(ctx context.Context, id, quantity int) error {
+	args := m.Called(id, quantity)
+	return args.Error(0)
+}
+
 type MockProductRepository struct {
 	mock.Mock
 }
 
 var _ repositories.IProductRepository = (*MockProductRepository)(nil)
 
-func (m *MockProductRepository) GetByID(id int) (*models.Product, error) {
+func (m *MockProductRepository) GetByID(ctx context.Context, id int) (*models.Product, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -83,7 +176,7 @@ func (m *MockProductRepository) GetByID(id int) (*models.Product, error) {
 	return args.Get(0).(*models.Product), args.Error(1)
 }
 
-func (m *MockProductRepository) GetAll() ([]*models.Product, error) {
+func (m *MockProductRepository) GetAll(ctx context.Context) ([]*models.Product, error) {
 	args := m.Called()
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -97,13 +190,15 @@ type MockBillRepository struct {
 
 var _ repositories.IBillRepository = (*MockBillRepository)(nil)
 
-func (m *MockBillRepository) Create(bill *models.Bill) error {
+func (m *MockBillRepository) Create(ctx context.Context, bill *models.Bill) error {
 	args := m.Called(bill)
-	bill.ID = 1
+	if bill.ID == 0 {
+		bill.ID = 1
+	}
 	return args.Error(0)
 }
 
-func (m *MockBillRepository) GetByID(id int) (*models.Bill, error) {
+func (m *MockBillRepository) GetByID(ctx context.Context, id int) (*models.Bill, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -111,7 +206,23 @@ func (m *MockBillRepository) GetByID(id int) (*models.Bill, error) {
 	return args.Get(0).(*models.Bill), args.Error(1)
 }
 
-func (m *MockBillRepository) GetByUserID(userID int) ([]*models.Bill, error) {
+func (m *MockBillRepository) LockByID(ctx context.Context, id int) (*models.Bill, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Bill), args.Error(1)
+}
+
+func (m *MockBillRepository) GetItems(ctx context.Context, billID int) ([]*models.BillItem, error) {
+	args := m.Called(billID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.BillItem), args.Error(1)
+}
+
+func (m *MockBillRepository) GetByUserID(ctx context.Context, userID int) ([]*models.Bill, error) {
 	args := m.Called(userID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -119,25 +230,56 @@ func (m *MockBillRepository) GetByUserID(userID int) ([]*models.Bill, error) {
 	return args.Get(0).([]*models.Bill), args.Error(1)
 }
 
-func (m *MockBillRepository) MarkAsPaid(id int) error {
+func (m *MockBillRepository) MarkAsPaid(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockBillRepository) GetUncollected(ctx context.Context) ([]*models.Bill, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Bill), args.Error(1)
+}
+
+func (m *MockBillRepository) GetOverdue(ctx context.Context) ([]*models.Bill, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Bill), args.Error(1)
+}
+
+func (m *MockBillRepository) MarkUncollectible(ctx context.Context, id int) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
+func (m *MockBillRepository) MarkOpenUncollectible(ctx context.Context, subscriptionID int) error {
+	args := m.Called(subscriptionID)
+	return args.Error(0)
+}
+
+func (m *MockBillRepository) UpdateRefunded(ctx context.Context, id int, refunded models.Money, status string) error {
+	args := m.Called(id, refunded, status)
+	return args.Error(0)
+}
+
 type MockUserRepository struct {
 	mock.Mock
 }
 
 var _ repositories.IUserRepository = (*MockUserRepository)(nil)
 
-func (m *MockUserRepository) Create(user *models.User) error {
+func (m *MockUserRepository) Create(ctx context.Context, user *models.User) error {
 	args := m.Called(user)
 	user.ID = 1
 	user.CreatedAt = time.Now()
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) GetByID(id int) (*models.User, error) {
+func (m *MockUserRepository) GetByID(ctx context.Context, id int) (*models.User, error) {
 	args := m.Called(id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -145,6 +287,375 @@ func (m *MockUserRepository) GetByID(id int) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockUserRepository) UpdateBillingDetails(ctx context.Context, user *models.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+type MockDunningRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IDunningRepository = (*MockDunningRepository)(nil)
+
+func (m *MockDunningRepository) Create(ctx context.Context, attempt *models.DunningAttempt) error {
+	args := m.Called(attempt)
+	attempt.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockDunningRepository) GetByBillID(ctx context.Context, billID int) ([]*models.DunningAttempt, error) {
+	args := m.Called(billID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.DunningAttempt), args.Error(1)
+}
+
+type MockPaymentAttemptRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IPaymentAttemptRepository = (*MockPaymentAttemptRepository)(nil)
+
+func (m *MockPaymentAttemptRepository) Create(ctx context.Context, attempt *models.PaymentAttempt) error {
+	args := m.Called(attempt)
+	attempt.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockPaymentAttemptRepository) GetByBillID(ctx context.Context, billID int) ([]*models.PaymentAttempt, error) {
+	args := m.Called(billID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PaymentAttempt), args.Error(1)
+}
+
+type MockPaymentMethodRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IPaymentMethodRepository = (*MockPaymentMethodRepository)(nil)
+
+func (m *MockPaymentMethodRepository) Create(ctx context.Context, method *models.PaymentMethod) error {
+	args := m.Called(method)
+	method.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockPaymentMethodRepository) GetByID(ctx context.Context, id int) (*models.PaymentMethod, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentMethod), args.Error(1)
+}
+
+func (m *MockPaymentMethodRepository) GetByUserID(ctx context.Context, userID int) ([]*models.PaymentMethod, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PaymentMethod), args.Error(1)
+}
+
+func (m *MockPaymentMethodRepository) GetDefaultByUserID(ctx context.Context, userID int) (*models.PaymentMethod, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PaymentMethod), args.Error(1)
+}
+
+func (m *MockPaymentMethodRepository) SetDefault(ctx context.Context, userID, id int) error {
+	args := m.Called(userID, id)
+	return args.Error(0)
+}
+
+func (m *MockPaymentMethodRepository) Delete(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockCreditNoteRepository struct {
+	mock.Mock
+}
+
+var _ repositories.ICreditNoteRepository = (*MockCreditNoteRepository)(nil)
+
+func (m *MockCreditNoteRepository) Create(ctx context.Context, note *models.CreditNote) error {
+	args := m.Called(note)
+	note.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockCreditNoteRepository) GetByBillID(ctx context.Context, billID int) ([]*models.CreditNote, error) {
+	args := m.Called(billID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.CreditNote), args.Error(1)
+}
+
+type MockBalanceRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IBalanceRepository = (*MockBalanceRepository)(nil)
+
+func (m *MockBalanceRepository) Create(ctx context.Context, entry *models.BalanceEntry) error {
+	args := m.Called(entry)
+	entry.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockBalanceRepository) GetByUserID(ctx context.Context, userID int) ([]*models.BalanceEntry, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.BalanceEntry), args.Error(1)
+}
+
+func (m *MockBalanceRepository) GetBalances(ctx context.Context, userID int) ([]models.Money, error) {
+	args := m.Called(userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Money), args.Error(1)
+}
+
+func (m *MockBalanceRepository) GetBalance(ctx context.Context, userID int, currency string) (models.Money, error) {
+	args := m.Called(userID, currency)
+	return args.Get(0).(models.Money), args.Error(1)
+}
+
+type MockCouponRepository struct {
+	mock.Mock
+}
+
+var _ repositories.ICouponRepository = (*MockCouponRepository)(nil)
+
+func (m *MockCouponRepository) Create(ctx context.Context, coupon *models.Coupon) error {
+	args := m.Called(coupon)
+	coupon.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockCouponRepository) GetByID(ctx context.Context, id int) (*models.Coupon, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Coupon), args.Error(1)
+}
+
+func (m *MockCouponRepository) GetByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	args := m.Called(code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Coupon), args.Error(1)
+}
+
+func (m *MockCouponRepository) Redeem(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockPendingItemRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IPendingItemRepository = (*MockPendingItemRepository)(nil)
+
+func (m *MockPendingItemRepository) Create(ctx context.Context, item *models.PendingItem) error {
+	args := m.Called(item)
+	item.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockPendingItemRepository) GetUnbilled(ctx context.Context, subscriptionID int) ([]*models.PendingItem, error) {
+	args := m.Called(subscriptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PendingItem), args.Error(1)
+}
+
+func (m *MockPendingItemRepository) MarkBilled(ctx context.Context, ids []int, billID int) error {
+	args := m.Called(ids, billID)
+	return args.Error(0)
+}
+
+type MockUsageRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IUsageRepository = (*MockUsageRepository)(nil)
+
+func (m *MockUsageRepository) Create(ctx context.Context, record *models.UsageRecord) (*models.UsageRecord, bool, error) {
+	args := m.Called(record)
+	if args.Get(0) == nil {
+		return nil, false, args.Error(2)
+	}
+	return args.Get(0).(*models.UsageRecord), args.Bool(1), args.Error(2)
+}
+
+func (m *MockUsageRepository) GetForPeriod(ctx context.Context, subscriptionID int, from, to time.Time) ([]*models.UsageRecord, error) {
+	args := m.Called(subscriptionID, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.UsageRecord), args.Error(1)
+}
+
+func (m *MockUsageRepository) Aggregate(ctx context.Context, subscriptionID int, aggregation string, from, to time.Time) (int64, error) {
+	args := m.Called(subscriptionID, aggregation, from, to)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockAddOnRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IAddOnRepository = (*MockAddOnRepository)(nil)
+
+func (m *MockAddOnRepository) Create(ctx context.Context, addOn *models.SubscriptionAddOn) error {
+	args := m.Called(addOn)
+	addOn.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockAddOnRepository) GetByID(ctx context.Context, id int) (*models.SubscriptionAddOn, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SubscriptionAddOn), args.Error(1)
+}
+
+func (m *MockAddOnRepository) GetBySubscriptionID(ctx context.Context, subscriptionID int) ([]*models.SubscriptionAddOn, error) {
+	args := m.Called(subscriptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.SubscriptionAddOn), args.Error(1)
+}
+
+func (m *MockAddOnRepository) Delete(ctx context.Context, id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+type MockBillingRunRepository struct {
+	mock.Mock
+}
+
+var _ repositories.IBillingRunRepository = (*MockBillingRunRepository)(nil)
+
+func (m *MockBillingRunRepository) Create(ctx context.Context, run *models.BillingRun) error {
+	args := m.Called(run)
+	run.ID = 1
+	return args.Error(0)
+}
+
+func (m *MockBillingRunRepository) Finish(ctx context.Context, run *models.BillingRun) error {
+	args := m.Called(run)
+	return args.Error(0)
+}
+
+func (m *MockBillingRunRepository) GetByID(ctx context.Context, id int) (*models.BillingRun, error) {
+	args := m.Called(id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.BillingRun), args.Error(1)
+}
+
+func (m *MockBillingRunRepository) GetRecent(ctx context.Context, limit int) ([]*models.BillingRun, error) {
+	args := m.Called(limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.BillingRun), args.Error(1)
+}
+
+func (m *MockBillingRunRepository) GetFailures(ctx context.Context, runID int) ([]models.BillingRunFailure, error) {
+	args := m.Called(runID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.BillingRunFailure), args.Error(1)
+}
+
+type MockUnitOfWork struct {
+	Repos      *repositories.Repositories
+	Committed  bool
+	RolledBack bool
+}
+
+var _ repositories.IUnitOfWork = (*MockUnitOfWork)(nil)
+
+func (m *MockUnitOfWork) Do(ctx context.Context, fn func(repos *repositories.Repositories) error) error {
+	if err := fn(m.Repos); err != nil {
+		m.RolledBack = true
+		return err
+	}
+	m.Committed = true
+	return nil
+}
+
+func newMockUnitOfWork(
+	mockSubRepo *MockSubscriptionRepository,
+	mockProductRepo *MockProductRepository,
+	mockBillRepo *MockBillRepository,
+	mockUserRepo *MockUserRepository,
+) *MockUnitOfWork {
+	return &MockUnitOfWork{
+		Repos: &repositories.Repositories{
+			Subscriptions:  mockSubRepo,
+			Products:       mockProductRepo,
+			Bills:          mockBillRepo,
+			Users:          mockUserRepo,
+			Dunning:        new(MockDunningRepository),
+			Payments:       new(MockPaymentAttemptRepository),
+			PaymentMethods: new(MockPaymentMethodRepository),
+			CreditNotes:    new(MockCreditNoteRepository),
+			Balance:        new(MockBalanceRepository),
+			Coupons:        new(MockCouponRepository),
+			PendingItems:   new(MockPendingItemRepository),
+			Usage:          new(MockUsageRepository),
+			AddOns:         new(MockAddOnRepository),
+			BillingRuns:    new(MockBillingRunRepository),
+		},
+	}
+}
+
+// expectNoAddOns sets up the unit of work for subscriptions without
+// add-ons.
+func expectNoAddOns(uow *MockUnitOfWork) {
+	uow.Repos.AddOns.(*MockAddOnRepository).On("GetBySubscriptionID", mock.Anything).Return([]*models.SubscriptionAddOn{}, nil)
+}
+
+// expectNoPendingItems sets up the unit of work for subscriptions that have
+// no pending items to bill.
+func expectNoPendingItems(uow *MockUnitOfWork) {
+	mockPendingItemRepo := uow.Repos.PendingItems.(*MockPendingItemRepository)
+	mockPendingItemRepo.On("GetUnbilled", mock.Anything).Return([]*models.PendingItem{}, nil)
+	mockPendingItemRepo.On("MarkBilled", mock.Anything, mock.Anything).Return(nil)
+}
+
+// expectDueForBilling sets up the subscriptions a billing run finds due,
+// each still due when it is locked for billing.
+func expectDueForBilling(mockSubscriptionRepo *MockSubscriptionRepository, subscriptions []*models.Subscription) {
+	mockSubscriptionRepo.On("GetDueForBilling", mock.AnythingOfType("time.Time")).Return(subscriptions, nil)
+	for _, subscription := range subscriptions {
+		mockSubscriptionRepo.On("LockDueForBilling", subscription.ID, mock.AnythingOfType("time.Time")).Return(subscription, nil)
+	}
+}
+
 func TestSubscriptionService_CreateSubscription(t *testing.T) {
 	tests := []struct {
 		name                  string
@@ -165,7 +676,7 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 
 				mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1, Name: "Test User"}, nil)
 
-				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Test Product", Price: 99.99}, nil)
+				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Test Product", Price: models.NewMoney(9999, "USD")}, nil)
 
 				mockSubRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil)
 
@@ -180,7 +691,7 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 			expectedBill: &models.Bill{
 				ID:             1,
 				SubscriptionID: 1,
-				Amount:         99.99,
+				Amount:         models.NewMoney(9999, "USD"),
 				Status:         "paid",
 			},
 			expectedError: false,
@@ -203,6 +714,18 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 			expectedError:         true,
 			expectedErrorContains: "user already has an active subscription",
 		},
+		{
+			name:      "user already has a paused subscription",
+			userID:    1,
+			productID: 2,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockUserRepo *MockUserRepository) {
+				mockSubRepo.On("GetActiveByUserAndProduct", 1, 2).Return(&models.Subscription{ID: 1, UserID: 1, ProductID: 2, Status: "paused"}, nil)
+			},
+			expectedSubscription:  nil,
+			expectedBill:          nil,
+			expectedError:         true,
+			expectedErrorContains: "user already has an active subscription",
+		},
 		{
 			name:      "user not found",
 			userID:    999,
@@ -237,7 +760,7 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockUserRepo *MockUserRepository) {
 				mockSubRepo.On("GetActiveByUserAndProduct", 1, 2).Return(nil, nil)
 				mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1, Name: "Test User"}, nil)
-				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Test Product", Price: 99.99}, nil)
+				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Test Product", Price: models.NewMoney(9999, "USD")}, nil)
 				mockSubRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(errors.New("db error"))
 			},
 			expectedSubscription:  nil,
@@ -252,7 +775,7 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository, mockUserRepo *MockUserRepository) {
 				mockSubRepo.On("GetActiveByUserAndProduct", 1, 2).Return(nil, nil)
 				mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1, Name: "Test User"}, nil)
-				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Test Product", Price: 99.99}, nil)
+				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Test Product", Price: models.NewMoney(9999, "USD")}, nil)
 				mockSubRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil)
 				mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(errors.New("db error"))
 			},
@@ -272,14 +795,18 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 
 			tt.mockSetup(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
 
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+
 			service := services.NewSubscriptionService(
 				mockSubscriptionRepo,
 				mockProductRepo,
 				mockBillRepo,
 				mockUserRepo,
+				uow,
+				nil,
 			)
 
-			subscription, bill, err := service.CreateSubscription(tt.userID, tt.productID)
+			subscription, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{UserID: tt.userID, ProductID: tt.productID})
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -288,6 +815,7 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 				}
 				assert.Nil(t, subscription)
 				assert.Nil(t, bill)
+				assert.True(t, uow.RolledBack)
 			} else {
 				assert.NoError(t, err)
 				assert.NotNil(t, subscription)
@@ -297,6 +825,7 @@ func TestSubscriptionService_CreateSubscription(t *testing.T) {
 				assert.Equal(t, tt.expectedSubscription.Status, subscription.Status)
 				assert.Equal(t, tt.expectedBill.Amount, bill.Amount)
 				assert.Equal(t, tt.expectedBill.Status, bill.Status)
+				assert.True(t, uow.Committed)
 			}
 
 			mockSubscriptionRepo.AssertExpectations(t)
@@ -362,9 +891,11 @@ func TestSubscriptionService_GetSubscription(t *testing.T) {
 			mockBillRepo := new(MockBillRepository)
 			mockUserRepo := new(MockUserRepository)
 
-			service := services.NewSubscriptionService(mockRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			uow := newMockUnitOfWork(mockRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+
+			service := services.NewSubscriptionService(mockRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
 
-			subscription, err := service.GetSubscription(tt.subscriptionID)
+			subscription, err := service.GetSubscription(context.Background(), tt.subscriptionID)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -384,3 +915,356 @@ func TestSubscriptionService_GetSubscription(t *testing.T) {
 		})
 	}
 }
+
+func TestSubscriptionService_CancelSubscription(t *testing.T) {
+	now := time.Now()
+	halfwaySubscription := func(status string) *models.Subscription {
+		return &models.Subscription{
+			ID:              1,
+			UserID:          1,
+			ProductID:       2,
+			StartDate:       now.Add(-15 * 24 * time.Hour),
+			NextBillingDate: now.Add(15 * 24 * time.Hour),
+			Status:          status,
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		mode                  services.CancellationMode
+		prorate               bool
+		mockSetup             func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository)
+		expectedStatus        string
+		expectedCredit        int64
+		expectedError         bool
+		expectedErrorContains string
+	}{
+		{
+			name: "cancel at period end",
+			mode: services.CancelAtPeriodEnd,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository) {
+				mockSubRepo.On("LockByID", 1).Return(halfwaySubscription("active"), nil)
+				mockSubRepo.On("ScheduleCancellation", 1, "too expensive").Return(nil)
+			},
+			expectedStatus: "active",
+		},
+		{
+			name:    "cancel now with prorated credit",
+			mode:    services.CancelImmediately,
+			prorate: true,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository) {
+				mockSubRepo.On("LockByID", 1).Return(halfwaySubscription("active"), nil)
+				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(2000, "USD")}, nil)
+				mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+					return bill.Status == "credit"
+				})).Return(nil)
+				mockBillRepo.On("MarkOpenUncollectible", 1).Return(nil)
+				mockSubRepo.On("Cancel", 1, mock.AnythingOfType("time.Time"), "too expensive").Return(nil)
+			},
+			expectedStatus: "cancelled",
+			expectedCredit: -1000,
+		},
+		{
+			name:    "cancel now without credit for held subscription writes off its renewal",
+			mode:    services.CancelImmediately,
+			prorate: true,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository) {
+				mockSubRepo.On("LockByID", 1).Return(halfwaySubscription("hold"), nil)
+				mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Price: models.NewMoney(2000, "USD")}, nil)
+				mockBillRepo.On("MarkOpenUncollectible", 1).Return(nil)
+				mockSubRepo.On("Cancel", 1, mock.AnythingOfType("time.Time"), "too expensive").Return(nil)
+			},
+			expectedStatus: "cancelled",
+		},
+		{
+			name: "already cancelled",
+			mode: services.CancelImmediately,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository) {
+				mockSubRepo.On("LockByID", 1).Return(halfwaySubscription("cancelled"), nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "already cancelled",
+		},
+		{
+			name:    "prorated credit at period end",
+			mode:    services.CancelAtPeriodEnd,
+			prorate: true,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockProductRepo *MockProductRepository, mockBillRepo *MockBillRepository) {
+				mockSubRepo.On("LockByID", 1).Return(halfwaySubscription("active"), nil)
+			},
+			expectedError:         true,
+			expectedErrorContains: "only available when cancelling immediately",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockUserRepo := new(MockUserRepository)
+
+			tt.mockSetup(mockSubscriptionRepo, mockProductRepo, mockBillRepo)
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			expectNoPendingItems(uow)
+			expectNoAddOns(uow)
+			mockBalanceRepo := uow.Repos.Balance.(*MockBalanceRepository)
+			if tt.expectedCredit != 0 {
+				mockBalanceRepo.On("Create", mock.MatchedBy(func(entry *models.BalanceEntry) bool {
+					return entry.UserID == 1 && entry.Amount.Amount == -tt.expectedCredit && *entry.SubscriptionID == 1
+				})).Return(nil)
+			}
+
+			service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+			subscription, credit, err := service.CancelSubscription(context.Background(), 1, tt.mode, "too expensive", tt.prorate)
+
+			if tt.expectedError {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedErrorContains)
+				assert.True(t, uow.RolledBack)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStatus, subscription.Status)
+				assert.Equal(t, "too expensive", subscription.CancellationReason)
+				if tt.expectedCredit != 0 {
+					assert.NotNil(t, credit)
+					assert.Equal(t, tt.expectedCredit, credit.Amount.Amount)
+				} else {
+					assert.Nil(t, credit)
+				}
+			}
+
+			mockSubscriptionRepo.AssertExpectations(t)
+			mockProductRepo.AssertExpectations(t)
+			mockBillRepo.AssertExpectations(t)
+			mockBalanceRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSubscriptionService_PauseAndResume(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-20 * 24 * time.Hour)
+	next := now.Add(10 * 24 * time.Hour)
+	pausedAt := now.Add(-5 * 24 * time.Hour)
+
+	t.Run("pause active subscription", func(t *testing.T) {
+		mockSubRepo := new(MockSubscriptionRepository)
+		resumeAt := now.Add(30 * 24 * time.Hour)
+		mockSubRepo.On("GetByID", 1).Return(&models.Subscription{ID: 1, Status: "active", StartDate: start, NextBillingDate: next}, nil)
+		mockSubRepo.On("Pause", 1, mock.AnythingOfType("time.Time"), &resumeAt).Return(nil)
+
+		uow := newMockUnitOfWork(mockSubRepo, new(MockProductRepository), new(MockBillRepository), new(MockUserRepository))
+		service := services.NewSubscriptionService(mockSubRepo, nil, nil, nil, uow, nil)
+
+		subscription, err := service.PauseSubscription(context.Background(), 1, &resumeAt)
+		assert.NoError(t, err)
+		assert.Equal(t, "paused", subscription.Status)
+		assert.Equal(t, &resumeAt, subscription.ResumeAt)
+		mockSubRepo.AssertExpectations(t)
+	})
+
+	t.Run("pause held subscription", func(t *testing.T) {
+		mockSubRepo := new(MockSubscriptionRepository)
+		mockSubRepo.On("GetByID", 1).Return(&models.Subscription{ID: 1, Status: "hold"}, nil)
+
+		uow := newMockUnitOfWork(mockSubRepo, new(MockProductRepository), new(MockBillRepository), new(MockUserRepository))
+		service := services.NewSubscriptionService(mockSubRepo, nil, nil, nil, uow, nil)
+
+		_, err := service.PauseSubscription(context.Background(), 1, nil)
+		assert.ErrorContains(t, err, "only active subscriptions can be paused")
+		mockSubRepo.AssertExpectations(t)
+	})
+
+	t.Run("resume shifts the period by the paused duration", func(t *testing.T) {
+		mockSubRepo := new(MockSubscriptionRepository)
+		mockSubRepo.On("GetByID", 1).Return(&models.Subscription{ID: 1, ProductID: 2, Status: "paused", StartDate: start, NextBillingDate: next, PausedAt: &pausedAt}, nil)
+		mockSubRepo.On("Resume", 1, mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(nil)
+		mockProductRepo := new(MockProductRepository)
+		mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, BillingInterval: "month", BillingIntervalCount: 1}, nil)
+
+		uow := newMockUnitOfWork(mockSubRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository))
+		service := services.NewSubscriptionService(mockSubRepo, nil, nil, nil, uow, nil)
+
+		subscription, err := service.ResumeSubscription(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "active", subscription.Status)
+		assert.Nil(t, subscription.PausedAt)
+		assert.WithinDuration(t, next.Add(5*24*time.Hour), subscription.NextBillingDate, time.Minute)
+		assert.Equal(t, subscription.NextBillingDate.Sub(subscription.StartDate), next.Sub(start))
+		mockSubRepo.AssertExpectations(t)
+	})
+}
+
+func TestSubscriptionService_ChangePlan(t *testing.T) {
+	now := time.Now()
+	standard := &models.Product{ID: 2, Name: "Standard Coffee Subscription", Price: models.NewMoney(1500, "USD")}
+	premium := &models.Product{ID: 1, Name: "Premium Coffee Subscription", Price: models.NewMoney(2000, "USD")}
+
+	tests := []struct {
+		name                  string
+		from                  *models.Product
+		to                    *models.Product
+		mode                  services.PlanChangeMode
+		mockSetup             func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository)
+		expectedProductID     int
+		expectedPending       bool
+		expectedAdjustment    int64
+		expectedAdjustStatus  string
+		expectedError         bool
+		expectedErrorContains string
+	}{
+		{
+			name: "upgrade immediately charges the prorated difference",
+			from: standard,
+			to:   premium,
+			mode: services.PlanChangeImmediately,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository) {
+				mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil)
+				mockSubRepo.On("ChangeProduct", 1, 1).Return(nil)
+			},
+			expectedProductID:    1,
+			expectedAdjustment:   250,
+			expectedAdjustStatus: "pending",
+		},
+		{
+			name: "downgrade immediately credits the prorated difference",
+			from: premium,
+			to:   standard,
+			mode: services.PlanChangeImmediately,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository) {
+				mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil)
+				mockSubRepo.On("ChangeProduct", 1, 2).Return(nil)
+			},
+			expectedProductID:    2,
+			expectedAdjustment:   -250,
+			expectedAdjustStatus: "credit",
+		},
+		{
+			name: "change at renewal only schedules the product",
+			from: standard,
+			to:   premium,
+			mode: services.PlanChangeAtRenewal,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository) {
+				mockSubRepo.On("SchedulePlanChange", 1, mock.AnythingOfType("*int")).Return(nil)
+			},
+			expectedProductID: 2,
+			expectedPending:   true,
+		},
+		{
+			name: "same product",
+			from: standard,
+			to:   standard,
+			mode: services.PlanChangeImmediately,
+			mockSetup: func(mockSubRepo *MockSubscriptionRepository, mockBillRepo *MockBillRepository) {
+			},
+			expectedError:         true,
+			expectedErrorContains: "already on this product",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockUserRepo := new(MockUserRepository)
+
+			mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{
+				ID:              1,
+				UserID:          1,
+				ProductID:       tt.from.ID,
+				StartDate:       now.Add(-15 * 24 * time.Hour),
+				NextBillingDate: now.Add(15 * 24 * time.Hour),
+				Status:          "active",
+			}, nil)
+			mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, tt.to.ID).Return(nil, nil).Maybe()
+			mockProductRepo.On("GetByID", tt.from.ID).Return(tt.from, nil).Maybe()
+			mockProductRepo.On("GetByID", tt.to.ID).Return(tt.to, nil).Maybe()
+			tt.mockSetup(mockSubscriptionRepo, mockBillRepo)
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			mockBalanceRepo := uow.Repos.Balance.(*MockBalanceRepository)
+			if tt.expectedAdjustStatus == "credit" {
+				mockBalanceRepo.On("Create", mock.MatchedBy(func(entry *models.BalanceEntry) bool {
+					return entry.UserID == 1 && entry.Amount.Amount > 0 && entry.Reason == "proration credit"
+				})).Return(nil)
+			}
+			service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+			subscription, adjustment, err := service.ChangePlan(context.Background(), 1, tt.to.ID, tt.mode)
+
+			if tt.expectedError {
+				assert.ErrorContains(t, err, tt.expectedErrorContains)
+				assert.True(t, uow.RolledBack)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedProductID, subscription.ProductID)
+				assert.Equal(t, tt.expectedPending, subscription.PendingProductID != nil)
+				if tt.expectedAdjustment != 0 {
+					assert.Equal(t, "adjustment", adjustment.Type)
+					assert.Equal(t, tt.expectedAdjustStatus, adjustment.Status)
+					assert.InDelta(t, tt.expectedAdjustment, adjustment.Amount.Amount, 1)
+				} else {
+					assert.Nil(t, adjustment)
+				}
+			}
+
+			mockSubscriptionRepo.AssertExpectations(t)
+			mockBillRepo.AssertExpectations(t)
+			mockBalanceRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSubscriptionService_CreateSubscriptionWithTrial(t *testing.T) {
+	tests := []struct {
+		name           string
+		usedTrial      bool
+		expectedStatus string
+		expectBill     bool
+	}{
+		{name: "first trial starts trialing without a bill", usedTrial: false, expectedStatus: "trialing", expectBill: false},
+		{name: "trial already used starts a paid subscription", usedTrial: true, expectedStatus: "active", expectBill: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			mockUserRepo := new(MockUserRepository)
+
+			mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 4).Return(nil, nil)
+			mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1}, nil)
+			mockProductRepo.On("GetByID", 4).Return(&models.Product{ID: 4, Price: models.NewMoney(1299, "USD"), TrialDays: 14}, nil)
+			mockSubscriptionRepo.On("HasUsedTrial", 1, 4).Return(tt.usedTrial, nil)
+			mockSubscriptionRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil)
+			if tt.expectBill {
+				mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil)
+			}
+
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+			service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+			subscription, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{UserID: 1, ProductID: 4})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, subscription.Status)
+			if tt.expectBill {
+				assert.NotNil(t, bill)
+				assert.Nil(t, subscription.TrialEndsAt)
+			} else {
+				assert.Nil(t, bill)
+				assert.NotNil(t, subscription.TrialEndsAt)
+				assert.Equal(t, *subscription.TrialEndsAt, subscription.NextBillingDate)
+				assert.WithinDuration(t, time.Now().AddDate(0, 0, 14), subscription.NextBillingDate, time.Minute)
+			}
+
+			mockSubscriptionRepo.AssertExpectations(t)
+			mockBillRepo.AssertExpectations(t)
+		})
+	}
+}
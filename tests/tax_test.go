@@ -0,0 +1,252 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+	"github.com/zaher1307/subscription-service/internal/tax"
+)
+
+func loadTaxTable(t *testing.T) *tax.Table {
+	t.Helper()
+
+	table, err := tax.Load("../config/tax_rates.json")
+	if err != nil {
+		t.Fatalf("loading tax table: %v", err)
+	}
+	return table
+}
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    tax.Percent
+		expectError bool
+	}{
+		{value: "19", expected: 19000},
+		{value: "8.875", expected: 8875},
+		{value: "5.5", expected: 5500},
+		{value: "0", expected: 0},
+		{value: "1.2345", expectError: true},
+		{value: "101", expectError: true},
+		{value: "-5", expectError: true},
+		{value: "abc", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			p, err := tax.ParsePercent(tt.value)
+
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, p)
+			assert.Equal(t, tt.value, p.String())
+		})
+	}
+}
+
+func TestTaxTable_Calculate(t *testing.T) {
+	table := loadTaxTable(t)
+
+	tests := []struct {
+		name                string
+		address             *models.Address
+		taxID               string
+		category            string
+		amount              models.Money
+		expectNoTax         bool
+		expectedAmount      int64
+		expectedDescription string
+		expectedInclusive   bool
+	}{
+		{
+			name:                "inclusive VAT for a consumer",
+			address:             &models.Address{Country: "DE"},
+			amount:              models.NewMoney(1999, "EUR"),
+			expectedAmount:      319,
+			expectedDescription: "VAT 19%",
+			expectedInclusive:   true,
+		},
+		{
+			name:                "category rate beats the country rate",
+			address:             &models.Address{Country: "de"},
+			category:            "reduced",
+			amount:              models.NewMoney(1999, "EUR"),
+			expectedAmount:      131,
+			expectedDescription: "VAT 7%",
+			expectedInclusive:   true,
+		},
+		{
+			name:                "exclusive sales tax by region",
+			address:             &models.Address{Country: "US", Region: "NY"},
+			amount:              models.NewMoney(1000, "USD"),
+			expectedAmount:      89,
+			expectedDescription: "Sales tax 8.875%",
+		},
+		{
+			name:                "reverse charge for a foreign business",
+			address:             &models.Address{Country: "FR"},
+			taxID:               "FR12345678901",
+			amount:              models.NewMoney(1999, "EUR"),
+			expectedAmount:      0,
+			expectedDescription: "VAT reverse charge",
+			expectedInclusive:   true,
+		},
+		{
+			name:                "no reverse charge in the seller's country",
+			address:             &models.Address{Country: "DE"},
+			taxID:               "DE123456789",
+			amount:              models.NewMoney(1999, "EUR"),
+			expectedAmount:      319,
+			expectedDescription: "VAT 19%",
+			expectedInclusive:   true,
+		},
+		{
+			name:        "region without a rate",
+			address:     &models.Address{Country: "US", Region: "OR"},
+			amount:      models.NewMoney(1000, "USD"),
+			expectNoTax: true,
+		},
+		{
+			name:        "no billing address",
+			amount:      models.NewMoney(1000, "USD"),
+			expectNoTax: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := table.Calculate(tax.Request{Address: tt.address, TaxID: tt.taxID, Category: tt.category, Amount: tt.amount})
+
+			if tt.expectNoTax {
+				assert.Nil(t, line)
+				return
+			}
+			if assert.NotNil(t, line) {
+				assert.Equal(t, models.NewMoney(tt.expectedAmount, tt.amount.Currency), line.Amount)
+				assert.Equal(t, tt.expectedDescription, line.Description())
+				assert.Equal(t, tt.expectedInclusive, line.Inclusive)
+			}
+		})
+	}
+
+	var noTable *tax.Table
+	assert.Nil(t, noTable.Calculate(tax.Request{Address: &models.Address{Country: "DE"}, Amount: models.NewMoney(1999, "EUR")}))
+}
+
+func TestSubscriptionService_CreateSubscriptionWithInclusiveTax(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 4).Return(nil, nil)
+	mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1, BillingAddress: &models.Address{Country: "DE"}}, nil)
+	mockProductRepo.On("GetByID", 4).Return(&models.Product{ID: 4, Name: "Coffee Plan", Price: models.NewMoney(1999, "EUR"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	mockSubscriptionRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil)
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, loadTaxTable(t))
+
+	_, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{UserID: 1, ProductID: 4})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1999, "EUR"), bill.Amount)
+	assert.Equal(t, models.NewMoney(319, "EUR"), bill.Tax)
+	if assert.Len(t, bill.Items, 2) {
+		assert.Equal(t, models.BillItemKindTax, bill.Items[1].Kind)
+		assert.True(t, bill.Items[1].Inclusive)
+	}
+}
+
+func TestBillingService_GenerateBillsWithExclusiveTax(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	expectNoPendingItems(uow)
+	expectNoAddOns(uow)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 2, Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockUserRepo.On("GetByID", 5).Return(&models.User{ID: 5, BillingAddress: &models.Address{Country: "US", Region: "NY"}}, nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Coffee Plan", Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	mockBillRepo.On("Create", mock.MatchedBy(func(bill *models.Bill) bool {
+		return bill.Amount == models.NewMoney(2176, "USD") && bill.Tax == models.NewMoney(177, "USD") &&
+			len(bill.Items) == 2 && bill.Items[1].Description == "Sales tax 8.875%" && !bill.Items[1].Inclusive
+	})).Return(nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, loadTaxTable(t))
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockBillRepo.AssertExpectations(t)
+}
+
+func TestBillingService_GenerateBillsTaxesEachLineAtItsProductsRate(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	addOnID := 8
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "EUR").Return(models.NewMoney(0, "EUR"), nil)
+	uow.Repos.AddOns.(*MockAddOnRepository).On("GetBySubscriptionID", 1).Return([]*models.SubscriptionAddOn{
+		{ID: 2, SubscriptionID: 1, ProductID: addOnID, Quantity: 1},
+	}, nil)
+	mockPendingItemRepo := uow.Repos.PendingItems.(*MockPendingItemRepository)
+	mockPendingItemRepo.On("GetUnbilled", 1).Return([]*models.PendingItem{
+		{ID: 3, SubscriptionID: 1, Kind: models.BillItemKindProration, Description: "Unused time on Recipe Book", Quantity: 1, UnitAmount: models.NewMoney(-535, "EUR"), ProductID: &addOnID},
+	}, nil)
+	mockPendingItemRepo.On("MarkBilled", []int{3}, mock.Anything).Return(nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 2, Currency: "EUR", Quantity: 1, Status: "active", BillingAnchor: due.AddDate(0, -1, 0), NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockUserRepo.On("GetByID", 5).Return(&models.User{ID: 5, BillingAddress: &models.Address{Country: "DE"}}, nil)
+	mockProductRepo.On("GetByID", 2).Return(&models.Product{ID: 2, Name: "Coffee Plan", Price: models.NewMoney(1190, "EUR"), BillingInterval: "month", BillingIntervalCount: 1}, nil)
+	mockProductRepo.On("GetByID", addOnID).Return(&models.Product{ID: addOnID, Name: "Recipe Book", Price: models.NewMoney(1070, "EUR"), BillingInterval: "month", BillingIntervalCount: 1, AddOn: true, TaxCategory: "reduced"}, nil)
+
+	var created *models.Bill
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		created = args.Get(0).(*models.Bill)
+	})
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, loadTaxTable(t))
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, created) && assert.Len(t, created.Items, 5) {
+		assert.Equal(t, "VAT 19%", created.Items[3].Description)
+		assert.Equal(t, models.NewMoney(190, "EUR"), created.Items[3].Amount)
+		assert.Equal(t, "VAT 7%", created.Items[4].Description)
+		assert.Equal(t, models.NewMoney(35, "EUR"), created.Items[4].Amount)
+		assert.Equal(t, models.NewMoney(1725, "EUR"), created.Amount)
+		assert.Equal(t, models.NewMoney(225, "EUR"), created.Tax)
+	}
+}
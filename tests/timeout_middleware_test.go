@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zaher1307/subscription-service/internal/middleware"
+)
+
+func TestLoadTimeouts(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "3s")
+	t.Setenv("ENDPOINT_TIMEOUTS", "POST /api/bills/:id/pay=30s, GET  /api/products=1s")
+
+	timeouts, err := middleware.LoadTimeouts()
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, timeouts.For(http.MethodPost, "/api/bills/:id/pay"))
+	assert.Equal(t, time.Second, timeouts.For(http.MethodGet, "/api/products"))
+	assert.Equal(t, 3*time.Second, timeouts.For(http.MethodGet, "/api/bills/:id"))
+
+	t.Setenv("ENDPOINT_TIMEOUTS", "GET /api/products")
+	_, err = middleware.LoadTimeouts()
+	assert.Error(t, err)
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	timeouts := middleware.Timeouts{
+		Default:   time.Minute,
+		Endpoints: map[string]time.Duration{"GET /slow/:id": time.Hour},
+	}
+
+	var remaining time.Duration
+	router := gin.New()
+	router.Use(middleware.Timeout(timeouts))
+	router.GET("/slow/:id", func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		assert.True(t, ok)
+		remaining = time.Until(deadline)
+		c.Status(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/slow/1", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Greater(t, remaining, time.Minute)
+}
@@ -0,0 +1,402 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/zaher1307/subscription-service/internal/models"
+	"github.com/zaher1307/subscription-service/internal/payments"
+	"github.com/zaher1307/subscription-service/internal/services"
+)
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func meteredProduct() *models.Product {
+	return &models.Product{
+		ID:                   6,
+		Name:                 "API Calls",
+		Price:                models.NewMoney(10, "USD"),
+		Prices:               []models.Money{models.NewMoney(10, "USD")},
+		BillingInterval:      "month",
+		BillingIntervalCount: 1,
+		UsageType:            models.UsageTypeMetered,
+		UsageAggregation:     models.UsageAggregationSum,
+	}
+}
+
+func TestBillingService_GenerateBillsForUsage(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	periodStart := due.AddDate(0, -1, 0)
+
+	tiered := meteredProduct()
+	tiered.PricingScheme = models.PricingSchemeGraduated
+	tiered.Tiers = []models.PriceTier{
+		{UpTo: int64Ptr(100), UnitAmount: models.NewMoney(10, "USD")},
+		{UnitAmount: models.NewMoney(5, "USD")},
+	}
+
+	tests := []struct {
+		name                 string
+		product              *models.Product
+		usage                int64
+		expectedDescriptions []string
+		expectedAmounts      []int64
+	}{
+		{
+			name:                 "per unit",
+			product:              meteredProduct(),
+			usage:                150,
+			expectedDescriptions: []string{"API Calls usage"},
+			expectedAmounts:      []int64{1500},
+		},
+		{
+			name:                 "graduated tiers",
+			product:              tiered,
+			usage:                150,
+			expectedDescriptions: []string{"API Calls usage (1 to 100)", "API Calls usage (101 and above)"},
+			expectedAmounts:      []int64{1000, 250},
+		},
+		{
+			name:                 "within the first tier",
+			product:              tiered,
+			usage:                40,
+			expectedDescriptions: []string{"API Calls usage (1 to 100)"},
+			expectedAmounts:      []int64{400},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			mockBillRepo := new(MockBillRepository)
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+			expectNoPendingItems(uow)
+			uow.Repos.Balance.(*MockBalanceRepository).On("GetBalance", mock.Anything, "USD").Return(models.NewMoney(0, "USD"), nil)
+			uow.Repos.Usage.(*MockUsageRepository).On("Aggregate", 1, models.UsageAggregationSum, periodStart, due).Return(tt.usage, nil)
+
+			mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+			mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+			expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+				{ID: 1, UserID: 5, ProductID: 6, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: periodStart, StartDate: periodStart, NextBillingDate: due},
+			})
+			mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+			mockProductRepo.On("GetByID", 6).Return(tt.product, nil)
+
+			var created *models.Bill
+			mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+				created = args.Get(0).(*models.Bill)
+			})
+
+			service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+			_, err := service.GenerateBills(context.Background())
+
+			assert.NoError(t, err)
+			if assert.NotNil(t, created) && assert.Len(t, created.Items, len(tt.expectedAmounts)) {
+				var total int64
+				for i, item := range created.Items {
+					assert.Equal(t, models.BillItemKindUsage, item.Kind)
+					assert.Equal(t, tt.expectedDescriptions[i], item.Description)
+					assert.Equal(t, models.NewMoney(tt.expectedAmounts[i], "USD"), item.Amount)
+					assert.Equal(t, periodStart, *item.PeriodStart)
+					assert.Equal(t, due, *item.PeriodEnd)
+					total += tt.expectedAmounts[i]
+				}
+				assert.Equal(t, models.NewMoney(total, "USD"), created.Amount)
+			}
+		})
+	}
+}
+
+func TestBillingService_GenerateBillsWithoutUsage(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	periodStart := due.AddDate(0, -1, 0)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	uow.Repos.Usage.(*MockUsageRepository).On("Aggregate", 1, models.UsageAggregationSum, periodStart, due).Return(int64(0), nil)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 6, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: periodStart, StartDate: periodStart, NextBillingDate: due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockSubscriptionRepo.On("UpdateStartDate", 1, due).Return(nil)
+	mockSubscriptionRepo.On("UpdateNextBillingDate", 1, due.AddDate(0, 1, 0)).Return(nil)
+	mockSubscriptionRepo.On("ActivateSubscription", 1).Return(nil)
+	mockProductRepo.On("GetByID", 6).Return(meteredProduct(), nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockBillRepo.AssertNotCalled(t, "Create", mock.Anything)
+	mockSubscriptionRepo.AssertExpectations(t)
+}
+
+func TestBillingService_GenerateBillsUsageDuringTrialIsFree(t *testing.T) {
+	due := time.Date(2025, time.March, 10, 0, 0, 0, 0, time.UTC)
+	periodStart := due.AddDate(0, 0, -14)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+
+	mockSubscriptionRepo.On("GetDueForResume", mock.AnythingOfType("time.Time")).Return([]*models.Subscription{}, nil)
+	mockBillRepo.On("GetUncollected").Return([]*models.Bill{}, nil)
+	expectDueForBilling(mockSubscriptionRepo, []*models.Subscription{
+		{ID: 1, UserID: 5, ProductID: 6, Currency: "USD", Quantity: 1, Status: models.SubscriptionStatusTrialing, BillingAnchor: due, StartDate: periodStart, NextBillingDate: due, TrialEndsAt: &due},
+	})
+	mockSubscriptionRepo.On("HoldSubscription", 1).Return(nil)
+	mockSubscriptionRepo.On("UpdateStartDate", 1, due).Return(nil)
+	mockSubscriptionRepo.On("UpdateNextBillingDate", 1, due.AddDate(0, 1, 0)).Return(nil)
+	mockSubscriptionRepo.On("ActivateSubscription", 1).Return(nil)
+	mockProductRepo.On("GetByID", 6).Return(meteredProduct(), nil)
+
+	service := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	_, err := service.GenerateBills(context.Background())
+
+	assert.NoError(t, err)
+	mockBillRepo.AssertNotCalled(t, "Create", mock.Anything)
+	uow.Repos.Usage.(*MockUsageRepository).AssertNotCalled(t, "Aggregate", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUsageService_RecordUsage(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	periodStart := now.AddDate(0, 0, -10)
+	saved := &models.UsageRecord{ID: 7, SubscriptionID: 1, IdempotencyKey: "req-1", Quantity: 20, Timestamp: now.Add(-time.Hour)}
+
+	tests := []struct {
+		name                string
+		product             *models.Product
+		record              models.UsageRecord
+		existing            bool
+		expectedCreated     bool
+		expectedErr         error
+		expectedErrContains string
+	}{
+		{
+			name:            "new record",
+			product:         meteredProduct(),
+			record:          models.UsageRecord{SubscriptionID: 1, IdempotencyKey: "req-1", Quantity: 20, Timestamp: now.Add(-time.Hour)},
+			expectedCreated: true,
+		},
+		{
+			name:     "retried record",
+			product:  meteredProduct(),
+			record:   models.UsageRecord{SubscriptionID: 1, IdempotencyKey: "req-1", Quantity: 20, Timestamp: now.Add(-time.Hour)},
+			existing: true,
+		},
+		{
+			name:        "key reused for different usage",
+			product:     meteredProduct(),
+			record:      models.UsageRecord{SubscriptionID: 1, IdempotencyKey: "req-1", Quantity: 25, Timestamp: now.Add(-time.Hour)},
+			existing:    true,
+			expectedErr: models.ErrUsageKeyReused,
+		},
+		{
+			name:                "usage in a billed period",
+			product:             meteredProduct(),
+			record:              models.UsageRecord{SubscriptionID: 1, IdempotencyKey: "req-2", Quantity: 5, Timestamp: periodStart.Add(-time.Hour)},
+			expectedErrContains: "already been billed",
+		},
+		{
+			name:                "usage in the future",
+			product:             meteredProduct(),
+			record:              models.UsageRecord{SubscriptionID: 1, IdempotencyKey: "req-2", Quantity: 5, Timestamp: now.Add(time.Hour)},
+			expectedErrContains: "in the future",
+		},
+		{
+			name:                "licensed product",
+			product:             &models.Product{ID: 6, Name: "Coffee Plan", Price: models.NewMoney(1999, "USD"), BillingInterval: "month", BillingIntervalCount: 1},
+			record:              models.UsageRecord{SubscriptionID: 1, IdempotencyKey: "req-2", Quantity: 5},
+			expectedErrContains: "not for a metered product",
+		},
+		{
+			name:                "missing idempotency key",
+			product:             meteredProduct(),
+			record:              models.UsageRecord{SubscriptionID: 1, Quantity: 5},
+			expectedErrContains: "idempotency key is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSubscriptionRepo := new(MockSubscriptionRepository)
+			mockProductRepo := new(MockProductRepository)
+			uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository))
+			mockUsageRepo := uow.Repos.Usage.(*MockUsageRepository)
+
+			mockSubscriptionRepo.On("ShareLockByID", 1).Return(&models.Subscription{
+				ID: 1, UserID: 5, ProductID: 6, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: periodStart, StartDate: periodStart, NextBillingDate: periodStart.AddDate(0, 1, 0),
+			}, nil)
+			mockProductRepo.On("GetByID", 6).Return(tt.product, nil)
+			returned := &models.UsageRecord{ID: 8, SubscriptionID: 1, IdempotencyKey: tt.record.IdempotencyKey, Quantity: tt.record.Quantity, Timestamp: tt.record.Timestamp}
+			if tt.existing {
+				returned = saved
+			}
+			mockUsageRepo.On("Create", mock.AnythingOfType("*models.UsageRecord")).Return(returned, !tt.existing, nil).Maybe()
+
+			service := services.NewUsageService(uow)
+
+			record := tt.record
+			result, created, err := service.RecordUsage(context.Background(), &record)
+
+			if tt.expectedErr != nil || tt.expectedErrContains != "" {
+				if tt.expectedErr != nil {
+					assert.ErrorIs(t, err, tt.expectedErr)
+				} else {
+					assert.ErrorContains(t, err, tt.expectedErrContains)
+				}
+				assert.Nil(t, result)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedCreated, created)
+			assert.Equal(t, int64(20), result.Quantity)
+		})
+	}
+}
+
+func TestSubscriptionService_CreateMeteredSubscription(t *testing.T) {
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	mockUserRepo := new(MockUserRepository)
+
+	mockSubscriptionRepo.On("GetActiveByUserAndProduct", 1, 6).Return(nil, nil)
+	mockUserRepo.On("GetByID", 1).Return(&models.User{ID: 1}, nil)
+	mockProductRepo.On("GetByID", 6).Return(meteredProduct(), nil)
+	mockSubscriptionRepo.On("Create", mock.AnythingOfType("*models.Subscription")).Return(nil)
+
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo)
+	service := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, mockUserRepo, uow, nil)
+
+	subscription, bill, err := service.CreateSubscription(context.Background(), services.CreateSubscriptionParams{UserID: 1, ProductID: 6})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.SubscriptionStatusActive, subscription.Status)
+	assert.Nil(t, bill)
+	mockBillRepo.AssertNotCalled(t, "Create", mock.Anything)
+}
+
+func TestSubscriptionService_CancelMeteredBillsUsageOnPayableFinalBill(t *testing.T) {
+	start := time.Now().AddDate(0, 0, -10)
+	next := start.AddDate(0, 1, 0)
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	mockBillRepo := new(MockBillRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository))
+	expectNoPendingItems(uow)
+	uow.Repos.Usage.(*MockUsageRepository).On("Aggregate", 1, models.UsageAggregationSum, start, mock.AnythingOfType("time.Time")).Return(int64(150), nil)
+
+	mockSubscriptionRepo.On("LockByID", 1).Return(&models.Subscription{
+		ID: 1, UserID: 5, ProductID: 6, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: start, StartDate: start, NextBillingDate: next,
+	}, nil).Once()
+	mockBillRepo.On("MarkOpenUncollectible", 1).Return(nil)
+	mockSubscriptionRepo.On("Cancel", 1, mock.AnythingOfType("time.Time"), "").Return(nil)
+	mockProductRepo.On("GetByID", 6).Return(meteredProduct(), nil)
+
+	var final *models.Bill
+	mockBillRepo.On("Create", mock.AnythingOfType("*models.Bill")).Return(nil).Run(func(args mock.Arguments) {
+		final = args.Get(0).(*models.Bill)
+	})
+
+	subscriptionService := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, nil)
+
+	_, bill, err := subscriptionService.CancelSubscription(context.Background(), 1, services.CancelImmediately, "", false)
+
+	assert.NoError(t, err)
+	if !assert.NotNil(t, bill) {
+		return
+	}
+	assert.Equal(t, models.BillStatusPending, bill.Status)
+	assert.Equal(t, models.NewMoney(1500, "USD"), bill.Amount)
+
+	mockSubscriptionRepo.On("GetByID", 1).Return(&models.Subscription{ID: 1, UserID: 5, ProductID: 6, Status: "cancelled"}, nil)
+	mockBillRepo.On("GetByID", final.ID).Return(final, nil)
+	mockSubscriptionRepo.On("LockByID", 1).Return(&models.Subscription{ID: 1, UserID: 5, ProductID: 6, Status: "cancelled"}, nil)
+	mockBillRepo.On("LockByID", final.ID).Return(final, nil)
+	mockBillRepo.On("MarkAsPaid", final.ID).Return(nil)
+	uow.Repos.Payments.(*MockPaymentAttemptRepository).On("GetByBillID", final.ID).Return([]*models.PaymentAttempt{}, nil)
+	uow.Repos.Payments.(*MockPaymentAttemptRepository).On("Create", mock.MatchedBy(func(attempt *models.PaymentAttempt) bool {
+		return attempt.Status == models.PaymentAttemptStatusSucceeded && attempt.Amount == models.NewMoney(1500, "USD")
+	})).Return(nil)
+	uow.Repos.PaymentMethods.(*MockPaymentMethodRepository).On("GetDefaultByUserID", 5).Return(&models.PaymentMethod{ID: 7, UserID: 5, Token: "tok_visa"}, nil)
+
+	billingService := services.NewBillingService(mockSubscriptionRepo, mockProductRepo, mockBillRepo, new(MockUserRepository), uow, payments.NewFakeProvider(), services.NewLogNotifier(), nil, nil)
+
+	err = billingService.PayBill(context.Background(), final.ID, 0)
+
+	assert.NoError(t, err)
+	mockBillRepo.AssertCalled(t, "MarkAsPaid", final.ID)
+	mockSubscriptionRepo.AssertNotCalled(t, "UpdateStartDate", mock.Anything, mock.Anything)
+}
+
+func TestSubscriptionService_PauseAndResumeKeepsMeteredUsage(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	start := now.AddDate(0, 0, -20)
+	next := now.AddDate(0, 0, 10)
+	subscription := &models.Subscription{
+		ID: 1, UserID: 5, ProductID: 6, Currency: "USD", Quantity: 1, Status: "active", BillingAnchor: start, StartDate: start, NextBillingDate: next,
+	}
+
+	mockSubscriptionRepo := new(MockSubscriptionRepository)
+	mockProductRepo := new(MockProductRepository)
+	uow := newMockUnitOfWork(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository))
+	mockUsageRepo := uow.Repos.Usage.(*MockUsageRepository)
+
+	mockSubscriptionRepo.On("ShareLockByID", 1).Return(subscription, nil)
+	mockSubscriptionRepo.On("GetByID", 1).Return(subscription, nil)
+	mockProductRepo.On("GetByID", 6).Return(meteredProduct(), nil)
+	mockSubscriptionRepo.On("Pause", 1, mock.AnythingOfType("time.Time"), (*time.Time)(nil)).Return(nil)
+	mockSubscriptionRepo.On("Resume", 1, mock.AnythingOfType("time.Time"), start, mock.AnythingOfType("time.Time")).Return(nil)
+
+	record := &models.UsageRecord{SubscriptionID: 1, IdempotencyKey: "req-1", Quantity: 40, Timestamp: start.AddDate(0, 0, 1)}
+	mockUsageRepo.On("Create", record).Return(record, true, nil)
+
+	usageService := services.NewUsageService(uow)
+	subscriptionService := services.NewSubscriptionService(mockSubscriptionRepo, mockProductRepo, new(MockBillRepository), new(MockUserRepository), uow, nil)
+
+	_, _, err := usageService.RecordUsage(context.Background(), record)
+	assert.NoError(t, err)
+
+	_, err = subscriptionService.PauseSubscription(context.Background(), 1, nil)
+	assert.NoError(t, err)
+
+	// The subscription has been paused for five days by the time it resumes.
+	pausedAt := now.AddDate(0, 0, -5)
+	subscription.PausedAt = &pausedAt
+
+	resumed, err := subscriptionService.ResumeSubscription(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, start, resumed.StartDate)
+	assert.WithinDuration(t, next.AddDate(0, 0, 5), resumed.NextBillingDate, time.Minute)
+
+	mockUsageRepo.On("GetForPeriod", 1, start, resumed.NextBillingDate).Return([]*models.UsageRecord{record}, nil)
+	mockUsageRepo.On("Aggregate", 1, models.UsageAggregationSum, start, resumed.NextBillingDate).Return(int64(40), nil)
+
+	summary, err := usageService.GetUsage(context.Background(), 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, start, summary.PeriodStart)
+	assert.Equal(t, int64(40), summary.Quantity)
+	mockSubscriptionRepo.AssertExpectations(t)
+	mockUsageRepo.AssertExpectations(t)
+}